@@ -0,0 +1,25 @@
+module code.cloudfoundry.org/loggregator-tools/latency-common
+
+go 1.25.0
+
+require (
+	code.cloudfoundry.org/go-loggregator/v10 v10.3.1
+	github.com/onsi/ginkgo v1.16.5
+	github.com/onsi/gomega v1.42.1
+)
+
+require (
+	code.cloudfoundry.org/go-diodes v0.0.0-20260209061029-a81ffbc46978 // indirect
+	code.cloudfoundry.org/tlsconfig v0.46.0 // indirect
+	github.com/fsnotify/fsnotify v1.4.9 // indirect
+	github.com/google/go-cmp v0.7.0 // indirect
+	github.com/nxadm/tail v1.4.8 // indirect
+	go.yaml.in/yaml/v3 v3.0.4 // indirect
+	golang.org/x/net v0.56.0 // indirect
+	golang.org/x/sys v0.46.0 // indirect
+	golang.org/x/text v0.38.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260226221140-a57be14db171 // indirect
+	google.golang.org/grpc v1.79.1 // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+	gopkg.in/tomb.v1 v1.0.0-20141024135613-dd632973f1e7 // indirect
+)
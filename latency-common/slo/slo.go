@@ -0,0 +1,212 @@
+// Package slo monitors the latency of Loggregator against a latency SLO:
+// the fraction of the messages within a rolling window that were slower
+// than the SLO threshold or lost must stay below the error budget.
+package slo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator/v10"
+)
+
+// HistogramBounds are the upper bounds of the latency histogram buckets.
+var HistogramBounds = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Config is how often the latency is sampled and the SLO it is held to.
+type Config struct {
+	Interval  time.Duration
+	Window    time.Duration
+	Samples   int
+	Threshold time.Duration
+	Target    float64
+}
+
+// Input reads the Config from MONITOR_INTERVAL, MONITOR_WINDOW (default 1
+// hour), MONITOR_SAMPLES (up to 1000), SLO_THRESHOLD (default 1 second)
+// and SLO_TARGET (default 0.99). It returns false if MONITOR_INTERVAL is
+// not set.
+func Input(defaultSamples int) (Config, bool, error) {
+	interval := os.Getenv("MONITOR_INTERVAL")
+	if interval == "" {
+		return Config{}, false, nil
+	}
+
+	c := Config{
+		Window:    time.Hour,
+		Samples:   defaultSamples,
+		Threshold: time.Second,
+		Target:    0.99,
+	}
+
+	var err error
+	c.Interval, err = time.ParseDuration(interval)
+	if err != nil || c.Interval <= 0 {
+		return Config{}, false, fmt.Errorf("invalid monitor interval: %q", interval)
+	}
+
+	if w := os.Getenv("MONITOR_WINDOW"); w != "" {
+		c.Window, err = time.ParseDuration(w)
+		if err != nil || c.Window <= 0 {
+			return Config{}, false, fmt.Errorf("invalid monitor window: %q", w)
+		}
+	}
+
+	if s := os.Getenv("MONITOR_SAMPLES"); s != "" {
+		c.Samples, err = strconv.Atoi(s)
+		if err != nil || c.Samples < 1 || c.Samples > 1000 {
+			return Config{}, false, fmt.Errorf("invalid monitor samples: %q", s)
+		}
+	}
+
+	if t := os.Getenv("SLO_THRESHOLD"); t != "" {
+		c.Threshold, err = time.ParseDuration(t)
+		if err != nil || c.Threshold <= 0 {
+			return Config{}, false, fmt.Errorf("invalid slo threshold: %q", t)
+		}
+	}
+
+	if t := os.Getenv("SLO_TARGET"); t != "" {
+		c.Target, err = strconv.ParseFloat(t, 64)
+		if err != nil || c.Target <= 0 || c.Target >= 1 {
+			return Config{}, false, fmt.Errorf("invalid slo target: %q", t)
+		}
+	}
+
+	return c, true, nil
+}
+
+// Breached reports whether the burn exceeds the error budget.
+func (c Config) Breached(burn float64) bool {
+	return burn > 1-c.Target
+}
+
+// Window holds monitored latencies. The histogram counts every message
+// since the monitor started, while the samples only cover the rolling
+// window.
+type Window struct {
+	Buckets []uint64
+	Count   uint64
+	Sum     time.Duration
+	Lost    uint64
+
+	samples []sample
+}
+
+type sample struct {
+	time time.Time
+	slow bool
+}
+
+// NewWindow returns an empty Window.
+func NewWindow() *Window {
+	return &Window{Buckets: make([]uint64, len(HistogramBounds))}
+}
+
+// Record adds the latencies of the received messages and the lost messages
+// of a test that finished at now.
+func (w *Window) Record(now time.Time, received []time.Duration, lost int, threshold time.Duration) {
+	for _, d := range received {
+		for i, bound := range HistogramBounds {
+			if d <= bound {
+				w.Buckets[i]++
+			}
+		}
+		w.Count++
+		w.Sum += d
+
+		w.samples = append(w.samples, sample{time: now, slow: d > threshold})
+	}
+
+	w.Lost += uint64(lost)
+	for i := 0; i < lost; i++ {
+		w.samples = append(w.samples, sample{time: now, slow: true})
+	}
+}
+
+// Burn removes the samples from before the start of the window and
+// returns the fraction of the others that were slow or lost, or false if
+// there are none.
+func (w *Window) Burn(start time.Time) (float64, bool) {
+	i := 0
+	for i < len(w.samples) && w.samples[i].time.Before(start) {
+		i++
+	}
+	w.samples = w.samples[i:]
+
+	if len(w.samples) == 0 {
+		return 0, false
+	}
+
+	var slow int
+	for _, s := range w.samples {
+		if s.slow {
+			slow++
+		}
+	}
+
+	return float64(slow) / float64(len(w.samples)), true
+}
+
+// WriteHistogram writes the series of the histogram in the Prometheus text
+// exposition format. The labels, e.g. `path="stream"`, are added to each
+// series.
+func (w *Window) WriteHistogram(out io.Writer, name, labels string) {
+	bucketLabels, seriesLabels := "", ""
+	if labels != "" {
+		bucketLabels = labels + ","
+		seriesLabels = "{" + labels + "}"
+	}
+
+	for i, bound := range HistogramBounds {
+		fmt.Fprintf(out, "%s_bucket{%sle=%q} %d\n",
+			name, bucketLabels, strconv.FormatFloat(bound.Seconds(), 'g', -1, 64), w.Buckets[i])
+	}
+	fmt.Fprintf(out, "%s_bucket{%sle=\"+Inf\"} %d\n", name, bucketLabels, w.Count)
+	fmt.Fprintf(out, "%s_sum%s %g\n", name, seriesLabels, w.Sum.Seconds())
+	fmt.Fprintf(out, "%s_count%s %d\n", name, seriesLabels, w.Count)
+}
+
+// IngressInput builds a client for the Loggregator agent if AGENT_ADDR is
+// set. The mTLS credentials are read from AGENT_CA_FILE, AGENT_CERT_FILE
+// and AGENT_KEY_FILE.
+func IngressInput() (*loggregator.IngressClient, error) {
+	addr := os.Getenv("AGENT_ADDR")
+	if addr == "" {
+		return nil, nil
+	}
+
+	caFile := os.Getenv("AGENT_CA_FILE")
+	certFile := os.Getenv("AGENT_CERT_FILE")
+	keyFile := os.Getenv("AGENT_KEY_FILE")
+	if caFile == "" || certFile == "" || keyFile == "" {
+		return nil, errors.New("agent addr requires AGENT_CA_FILE, AGENT_CERT_FILE and AGENT_KEY_FILE")
+	}
+
+	tlsConfig, err := loggregator.NewIngressTLSConfig(caFile, certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid agent credentials: %s", err)
+	}
+
+	return loggregator.NewIngressClient(tlsConfig,
+		loggregator.WithAddr(addr),
+		loggregator.WithLogger(log.New(os.Stdout, "ingress: ", 0)),
+	)
+}
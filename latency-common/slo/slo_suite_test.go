@@ -0,0 +1,13 @@
+package slo
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSLO(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SLO Suite")
+}
@@ -0,0 +1,167 @@
+package slo
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Window", func() {
+	It("records the latencies in cumulative buckets and the window", func() {
+		w := NewWindow()
+		now := time.Now()
+
+		w.Record(now, []time.Duration{5 * time.Millisecond, 300 * time.Millisecond, 2 * time.Second}, 2, time.Second)
+
+		Expect(w.Buckets[0]).To(Equal(uint64(1)))
+		Expect(w.Buckets[5]).To(Equal(uint64(1)))
+		Expect(w.Buckets[6]).To(Equal(uint64(2)))
+		Expect(w.Buckets[8]).To(Equal(uint64(3)))
+		Expect(w.Count).To(Equal(uint64(3)))
+		Expect(w.Sum).To(Equal(2305 * time.Millisecond))
+		Expect(w.Lost).To(Equal(uint64(2)))
+		Expect(w.samples).To(Equal([]sample{
+			{time: now, slow: false},
+			{time: now, slow: false},
+			{time: now, slow: true},
+			{time: now, slow: true},
+			{time: now, slow: true},
+		}))
+	})
+
+	It("computes the burn from the slow and lost messages in the window", func() {
+		w := NewWindow()
+		now := time.Now()
+		w.Record(now.Add(-time.Hour), nil, 1, time.Second)
+		w.Record(now, []time.Duration{time.Millisecond, 2 * time.Second}, 0, time.Second)
+
+		burn, ok := w.Burn(now.Add(-2 * time.Hour))
+		Expect(ok).To(BeTrue())
+		Expect(burn).To(BeNumerically("~", 2.0/3))
+
+		burn, ok = w.Burn(now.Add(-time.Minute))
+		Expect(ok).To(BeTrue())
+		Expect(burn).To(Equal(0.5))
+		Expect(w.Lost).To(Equal(uint64(1)))
+
+		_, ok = w.Burn(now.Add(time.Minute))
+		Expect(ok).To(BeFalse())
+		Expect(w.samples).To(BeEmpty())
+	})
+
+	It("writes the histogram in the Prometheus text exposition format", func() {
+		w := NewWindow()
+		w.Record(time.Now(), []time.Duration{5 * time.Millisecond, 2 * time.Second}, 1, time.Second)
+
+		var b strings.Builder
+		w.WriteHistogram(&b, "some_seconds", "")
+		lines := strings.Split(b.String(), "\n")
+		Expect(lines).To(HaveLen(len(HistogramBounds) + 4))
+		Expect(lines).To(ContainElements(
+			`some_seconds_bucket{le="0.005"} 1`,
+			`some_seconds_bucket{le="2.5"} 2`,
+			`some_seconds_bucket{le="+Inf"} 2`,
+			"some_seconds_sum 2.005",
+			"some_seconds_count 2",
+		))
+
+		b.Reset()
+		w.WriteHistogram(&b, "some_seconds", `path="stream"`)
+		Expect(strings.Split(b.String(), "\n")).To(ContainElements(
+			`some_seconds_bucket{path="stream",le="0.005"} 1`,
+			`some_seconds_bucket{path="stream",le="+Inf"} 2`,
+			`some_seconds_sum{path="stream"} 2.005`,
+			`some_seconds_count{path="stream"} 2`,
+		))
+	})
+})
+
+var _ = Describe("Config", func() {
+	It("is breached only above the error budget", func() {
+		c := Config{Target: 0.75}
+
+		Expect(c.Breached(0.25)).To(BeFalse())
+		Expect(c.Breached(0.375)).To(BeTrue())
+	})
+})
+
+var _ = Describe("Input", func() {
+	AfterEach(func() {
+		for _, name := range []string{
+			"MONITOR_INTERVAL", "MONITOR_WINDOW", "MONITOR_SAMPLES", "SLO_THRESHOLD", "SLO_TARGET",
+		} {
+			Expect(os.Unsetenv(name)).To(Succeed())
+		}
+	})
+
+	It("is disabled without an interval", func() {
+		_, ok, err := Input(10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+
+	It("defaults to a window of an hour and a target of 99% under a second", func() {
+		Expect(os.Setenv("MONITOR_INTERVAL", "30s")).To(Succeed())
+
+		c, ok, err := Input(10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(c).To(Equal(Config{
+			Interval:  30 * time.Second,
+			Window:    time.Hour,
+			Samples:   10,
+			Threshold: time.Second,
+			Target:    0.99,
+		}))
+	})
+
+	It("accepts up to 1000 samples", func() {
+		Expect(os.Setenv("MONITOR_INTERVAL", "30s")).To(Succeed())
+
+		Expect(os.Setenv("MONITOR_SAMPLES", "1000")).To(Succeed())
+		c, _, err := Input(10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Samples).To(Equal(1000))
+
+		Expect(os.Setenv("MONITOR_SAMPLES", "1001")).To(Succeed())
+		_, _, err = Input(10)
+		Expect(err).To(MatchError(`invalid monitor samples: "1001"`))
+	})
+
+	It("rejects a target that is not a fraction", func() {
+		Expect(os.Setenv("MONITOR_INTERVAL", "30s")).To(Succeed())
+		Expect(os.Setenv("SLO_TARGET", "99")).To(Succeed())
+
+		_, _, err := Input(10)
+		Expect(err).To(MatchError(`invalid slo target: "99"`))
+	})
+
+	It("rejects an interval that is not positive", func() {
+		Expect(os.Setenv("MONITOR_INTERVAL", "0s")).To(Succeed())
+
+		_, _, err := Input(10)
+		Expect(err).To(MatchError(`invalid monitor interval: "0s"`))
+	})
+})
+
+var _ = Describe("IngressInput", func() {
+	AfterEach(func() {
+		Expect(os.Unsetenv("AGENT_ADDR")).To(Succeed())
+	})
+
+	It("does not build a client without an agent address", func() {
+		c, err := IngressInput()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(BeNil())
+	})
+
+	It("requires the mTLS credentials of the agent", func() {
+		Expect(os.Setenv("AGENT_ADDR", "localhost:3458")).To(Succeed())
+
+		_, err := IngressInput()
+		Expect(err).To(MatchError("agent addr requires AGENT_CA_FILE, AGENT_CERT_FILE and AGENT_KEY_FILE"))
+	})
+})
@@ -0,0 +1,207 @@
+// Package uaa provides the tokens the latency tools authenticate to
+// Loggregator with.
+package uaa
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshBefore is how long before a UAA token expires it is refreshed.
+// Tokens with a shorter lifetime are refreshed halfway through it.
+const refreshBefore = 5 * time.Minute
+
+// TokenSource provides the value of the Authorization header.
+type TokenSource interface {
+	Token() (string, error)
+}
+
+// StaticToken is a token that never changes, e.g. from `cf oauth-token`.
+type StaticToken string
+
+func (t StaticToken) Token() (string, error) {
+	return string(t), nil
+}
+
+// uaaTokenSource fetches tokens from UAA and caches them until shortly
+// before they expire. Tokens are refreshed with the refresh token if UAA
+// issued one, otherwise the original grant is repeated.
+type uaaTokenSource struct {
+	addr       string
+	grant      url.Values
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu           sync.Mutex
+	token        string
+	refreshToken string
+	refreshAt    time.Time
+	expiresAt    time.Time
+}
+
+// NewClientCredentialsTokenSource returns a TokenSource for the client
+// credentials grant.
+func NewClientCredentialsTokenSource(addr, clientID, clientSecret string, c *http.Client) *uaaTokenSource {
+	return newUAATokenSource(addr, c, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	})
+}
+
+// NewPasswordTokenSource returns a TokenSource for the password grant. The
+// client secret may be empty, e.g. for the cf client.
+func NewPasswordTokenSource(addr, clientID, clientSecret, username, password string, c *http.Client) *uaaTokenSource {
+	return newUAATokenSource(addr, c, url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"username":      {username},
+		"password":      {password},
+	})
+}
+
+func newUAATokenSource(addr string, c *http.Client, grant url.Values) *uaaTokenSource {
+	return &uaaTokenSource{
+		addr:       addr,
+		grant:      grant,
+		httpClient: c,
+		now:        time.Now,
+	}
+}
+
+// Token returns the cached token, or fetches a new one if the cached token
+// is about to expire. If UAA can not be reached, the cached token is used
+// until it expires.
+func (s *uaaTokenSource) Token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.token != "" && now.Before(s.refreshAt) {
+		return s.token, nil
+	}
+
+	err := s.fetch(now)
+	if err != nil {
+		if s.token != "" && now.Before(s.expiresAt) {
+			log.Printf("failed to refresh token, using the current one: %s", err)
+			return s.token, nil
+		}
+		return "", err
+	}
+
+	return s.token, nil
+}
+
+// fetch requests a new token. It must be called with the mu held.
+func (s *uaaTokenSource) fetch(now time.Time) error {
+	if s.refreshToken != "" {
+		err := s.request(now, url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {s.refreshToken},
+			"client_id":     s.grant["client_id"],
+			"client_secret": s.grant["client_secret"],
+		})
+		if err == nil {
+			return nil
+		}
+		log.Printf("failed to use refresh token, requesting a new token: %s", err)
+		s.refreshToken = ""
+	}
+
+	return s.request(now, s.grant)
+}
+
+func (s *uaaTokenSource) request(now time.Time, form url.Values) error {
+	req, err := http.NewRequest(http.MethodPost, s.addr+"/oauth/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected 200 status code from /oauth/token, got %d", resp.StatusCode)
+	}
+
+	var t struct {
+		AccessToken  string `json:"access_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&t)
+	if err != nil {
+		return fmt.Errorf("invalid UAA oauth response: %s", err)
+	}
+	if t.AccessToken == "" {
+		return errors.New("no access_token on UAA oauth response")
+	}
+
+	lifetime := time.Duration(t.ExpiresIn) * time.Second
+	s.token = "bearer " + t.AccessToken
+	s.expiresAt = now.Add(lifetime)
+	s.refreshAt = now.Add(lifetime - min(refreshBefore, lifetime/2))
+	if t.RefreshToken != "" {
+		s.refreshToken = t.RefreshToken
+	}
+
+	return nil
+}
+
+// Input builds the TokenSource. If UAA_URL is set, tokens are fetched
+// from UAA with the password grant if UAA_USERNAME is set, and with the
+// client credentials grant otherwise. Without UAA_URL, the static TOKEN is
+// used.
+func Input() (TokenSource, error) {
+	uaaURL := os.Getenv("UAA_URL")
+	if uaaURL == "" {
+		token := os.Getenv("TOKEN")
+		if token == "" {
+			return nil, errors.New("empty token")
+		}
+		return StaticToken(token), nil
+	}
+
+	clientID := os.Getenv("UAA_CLIENT_ID")
+	if clientID == "" {
+		return nil, errors.New("empty uaa client id")
+	}
+	clientSecret := os.Getenv("UAA_CLIENT_SECRET")
+
+	skipCertVerify, _ := strconv.ParseBool(os.Getenv("UAA_SKIP_CERT_VERIFY"))
+	c := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: skipCertVerify, //nolint:gosec
+			},
+		},
+	}
+
+	if username := os.Getenv("UAA_USERNAME"); username != "" {
+		return NewPasswordTokenSource(uaaURL, clientID, clientSecret, username, os.Getenv("UAA_PASSWORD"), c), nil
+	}
+
+	if clientSecret == "" {
+		return nil, errors.New("empty uaa client secret")
+	}
+	return NewClientCredentialsTokenSource(uaaURL, clientID, clientSecret, c), nil
+}
@@ -0,0 +1,213 @@
+package uaa
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeUAA is a UAA token endpoint. Each token it issues is numbered.
+type fakeUAA struct {
+	server *httptest.Server
+
+	mu            sync.Mutex
+	forms         []url.Values
+	issued        int
+	expiresIn     int
+	refreshTokens bool
+	status        int
+	rejectRefresh bool
+}
+
+func newFakeUAA() *fakeUAA {
+	f := &fakeUAA{expiresIn: 3600, status: http.StatusOK}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveToken))
+	return f
+}
+
+func (f *fakeUAA) serveToken(w http.ResponseWriter, r *http.Request) {
+	Expect(r.Method).To(Equal(http.MethodPost))
+	Expect(r.URL.Path).To(Equal("/oauth/token"))
+	Expect(r.ParseForm()).To(Succeed())
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.forms = append(f.forms, r.PostForm)
+	if f.status != http.StatusOK {
+		w.WriteHeader(f.status)
+		return
+	}
+	if f.rejectRefresh && r.PostForm.Get("grant_type") == "refresh_token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.issued++
+	refreshToken := ""
+	if f.refreshTokens {
+		refreshToken = fmt.Sprintf("refresh-%d", f.issued)
+	}
+	_, _ = fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d,"refresh_token":%q}`,
+		f.issued, f.expiresIn, refreshToken)
+}
+
+func (f *fakeUAA) requests() []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]url.Values(nil), f.forms...)
+}
+
+func (f *fakeUAA) set(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fn()
+}
+
+var _ = Describe("uaaTokenSource", func() {
+	var (
+		uaa *fakeUAA
+		now time.Time
+	)
+
+	BeforeEach(func() {
+		uaa = newFakeUAA()
+		now = time.Now()
+	})
+
+	AfterEach(func() {
+		uaa.server.Close()
+	})
+
+	clientCredentials := func() *uaaTokenSource {
+		s := NewClientCredentialsTokenSource(uaa.server.URL, "some-client", "some-secret", http.DefaultClient)
+		s.now = func() time.Time { return now }
+		return s
+	}
+
+	It("fetches a token with the client credentials grant", func() {
+		token, err := clientCredentials().Token()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("bearer token-1"))
+
+		Expect(uaa.requests()).To(HaveLen(1))
+		form := uaa.requests()[0]
+		Expect(form.Get("grant_type")).To(Equal("client_credentials"))
+		Expect(form.Get("client_id")).To(Equal("some-client"))
+		Expect(form.Get("client_secret")).To(Equal("some-secret"))
+	})
+
+	It("fetches a token with the password grant", func() {
+		s := NewPasswordTokenSource(uaa.server.URL, "cf", "", "some-user", "some-password", http.DefaultClient)
+
+		token, err := s.Token()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("bearer token-1"))
+
+		form := uaa.requests()[0]
+		Expect(form.Get("grant_type")).To(Equal("password"))
+		Expect(form.Get("client_id")).To(Equal("cf"))
+		Expect(form.Get("username")).To(Equal("some-user"))
+		Expect(form.Get("password")).To(Equal("some-password"))
+	})
+
+	It("caches the token until shortly before it expires", func() {
+		s := clientCredentials()
+		_, err := s.Token()
+		Expect(err).ToNot(HaveOccurred())
+
+		now = now.Add(54 * time.Minute)
+		token, err := s.Token()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("bearer token-1"))
+		Expect(uaa.requests()).To(HaveLen(1))
+
+		now = now.Add(2 * time.Minute)
+		token, err = s.Token()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("bearer token-2"))
+		Expect(uaa.requests()).To(HaveLen(2))
+	})
+
+	It("refreshes short-lived tokens halfway through their lifetime", func() {
+		uaa.set(func() { uaa.expiresIn = 60 })
+		s := clientCredentials()
+		_, err := s.Token()
+		Expect(err).ToNot(HaveOccurred())
+
+		now = now.Add(29 * time.Second)
+		_, _ = s.Token()
+		Expect(uaa.requests()).To(HaveLen(1))
+
+		now = now.Add(2 * time.Second)
+		token, err := s.Token()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("bearer token-2"))
+	})
+
+	It("uses the refresh token when UAA issued one", func() {
+		uaa.set(func() { uaa.refreshTokens = true })
+		s := clientCredentials()
+		_, err := s.Token()
+		Expect(err).ToNot(HaveOccurred())
+
+		now = now.Add(time.Hour)
+		token, err := s.Token()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("bearer token-2"))
+
+		form := uaa.requests()[1]
+		Expect(form.Get("grant_type")).To(Equal("refresh_token"))
+		Expect(form.Get("refresh_token")).To(Equal("refresh-1"))
+		Expect(form.Get("client_id")).To(Equal("some-client"))
+	})
+
+	It("repeats the grant when the refresh token is rejected", func() {
+		uaa.set(func() {
+			uaa.refreshTokens = true
+			uaa.rejectRefresh = true
+		})
+		s := clientCredentials()
+		_, err := s.Token()
+		Expect(err).ToNot(HaveOccurred())
+
+		now = now.Add(time.Hour)
+		token, err := s.Token()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("bearer token-2"))
+
+		Expect(uaa.requests()).To(HaveLen(3))
+		Expect(uaa.requests()[2].Get("grant_type")).To(Equal("client_credentials"))
+	})
+
+	It("uses the current token while UAA is unavailable until it expires", func() {
+		s := clientCredentials()
+		_, err := s.Token()
+		Expect(err).ToNot(HaveOccurred())
+		uaa.set(func() { uaa.status = http.StatusInternalServerError })
+
+		now = now.Add(58 * time.Minute)
+		token, err := s.Token()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("bearer token-1"))
+
+		now = now.Add(2 * time.Minute)
+		_, err = s.Token()
+		Expect(err).To(MatchError("expected 200 status code from /oauth/token, got 500"))
+	})
+
+	It("returns an error when UAA rejects the credentials", func() {
+		uaa.set(func() { uaa.status = http.StatusUnauthorized })
+
+		_, err := clientCredentials().Token()
+		Expect(err).To(MatchError("expected 200 status code from /oauth/token, got 401"))
+	})
+})
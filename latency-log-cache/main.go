@@ -18,7 +18,8 @@ import (
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 
 	client "code.cloudfoundry.org/go-log-cache/v3"
-	uuid "github.com/nu7hatch/gouuid"
+	"code.cloudfoundry.org/loggregator-tools/latency-common/slo"
+	"code.cloudfoundry.org/loggregator-tools/latency-common/uaa"
 )
 
 const (
@@ -30,18 +31,42 @@ func main() {
 	log.SetOutput(os.Stdout)
 	log.Print("starting")
 
-	addr, token, location, err := input()
+	addr, tokens, location, err := input()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	ingress, err := slo.IngressInput()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	probe, err := probeInput(location, tokens, ingress)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	lh := &latencyHandler{
+		location: location,
+		tokens:   tokens,
+		probe:    probe,
+		runs:     newRunStore(),
+	}
+
 	mux := &http.ServeMux{}
 	mux.Handle("/", &healthHandler{})
-	mux.Handle("/latency", &latencyHandler{
-		location: location,
-		token:    token,
-		mutex:    &sync.Mutex{},
-	})
+	mux.Handle("GET /latency", lh)
+	mux.HandleFunc("POST /latency", lh.startRun)
+	mux.HandleFunc("GET /latency/{id}", lh.getRun)
+
+	m, err := monitorInput(lh.start, ingress)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if m != nil {
+		mux.Handle("GET /metrics", m)
+		go m.run()
+	}
 
 	server := &http.Server{
 		Addr:           addr,
@@ -52,29 +77,29 @@ func main() {
 	log.Fatal(server.ListenAndServe())
 }
 
-func input() (addr, token string, location *url.URL, err error) {
+func input() (addr string, tokens uaa.TokenSource, location *url.URL, err error) {
 	targetURL := os.Getenv("TARGET_URL")
 	if targetURL == "" {
-		return "", "", nil, errors.New("empty target url")
+		return "", nil, nil, errors.New("empty target url")
 	}
 
-	token = os.Getenv("TOKEN")
-	if token == "" {
-		return "", "", nil, errors.New("empty token")
+	tokens, err = uaa.Input()
+	if err != nil {
+		return "", nil, nil, err
 	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
-		return "", "", nil, errors.New("empty port")
+		return "", nil, nil, errors.New("empty port")
 	}
 	addr = ":" + port
 
 	location, err = url.Parse(targetURL)
 	if err != nil {
-		return "", "", nil, fmt.Errorf("invalid target url: %s", err)
+		return "", nil, nil, fmt.Errorf("invalid target url: %s", err)
 	}
 
-	return addr, token, location, nil
+	return addr, tokens, location, nil
 }
 
 func appID() (string, error) {
@@ -99,18 +124,17 @@ func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 type latencyHandler struct {
 	location *url.URL
-	token    string
-
-	sendTimes map[string]time.Time
-
-	mutex *sync.Mutex
+	tokens   uaa.TokenSource
+	probe    *promQLProbe
+	runs     *runStore
 }
 
+// ServeHTTP runs a test and responds with its results once it is finished.
 func (h *latencyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	sampleSize := sampleSize(r)
+	run := h.start(sampleSize(r))
+	<-run.done
 
-	results := h.executeLatencyTest(sampleSize)
-	resultBytes, err := json.Marshal(results)
+	resultBytes, err := json.Marshal(run.status().Results)
 	if err != nil {
 		panic(err)
 	}
@@ -118,6 +142,42 @@ func (h *latencyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(resultBytes)
 }
 
+// startRun starts a test in the background and responds with its ID. The
+// progress and the results of the test are available via getRun.
+func (h *latencyHandler) startRun(w http.ResponseWriter, r *http.Request) {
+	run := h.start(sampleSize(r))
+
+	w.Header().Set("Location", "/latency/"+run.id)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(run.status())
+}
+
+// getRun responds with the progress of a test, and its results once it is
+// finished.
+func (h *latencyHandler) getRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := h.runs.get(r.PathValue("id"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(run.status())
+}
+
+func (h *latencyHandler) start(sampleQuantity int) *run {
+	run := newRun(sampleQuantity)
+	h.runs.add(run)
+
+	go func() {
+		h.executeLatencyTest(run)
+		run.finish()
+	}()
+
+	return run
+}
+
 func sampleSize(r *http.Request) int {
 	samplesQuery := r.URL.Query().Get("samples")
 	if samplesQuery == "" {
@@ -130,19 +190,28 @@ func sampleSize(r *http.Request) int {
 	return sampleSize
 }
 
+// testResults are the results of a run. The PromQL results are only set if
+// the PromQL probe is enabled.
 type testResults struct {
-	AvgSeconds   float64 `json:"avg_seconds"`
-	MaxSeconds   float64 `json:"max_seconds"`
-	LogsReceived int     `json:"logs_received"`
-	LogsExpected int     `json:"logs_expected"`
+	AvgSeconds   float64        `json:"avg_seconds"`
+	MaxSeconds   float64        `json:"max_seconds"`
+	LogsReceived int            `json:"logs_received"`
+	LogsExpected int            `json:"logs_expected"`
+	PromQL       *promQLResults `json:"promql,omitempty"`
 }
 
-func (h *latencyHandler) executeLatencyTest(sampleQuantity int) testResults {
-	h.mutex.Lock()
-	h.sendTimes = make(map[string]time.Time)
-	h.mutex.Unlock()
-
-	startTime := time.Now()
+// executeLatencyTest times the logs of the run, and probes PromQL alongside
+// if the probe is enabled.
+func (h *latencyHandler) executeLatencyTest(run *run) {
+	var wg sync.WaitGroup
+	if h.probe != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			run.setPromQL(h.probe.run(run.id))
+		}()
+	}
+	defer wg.Wait()
 
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	defer cancelFunc()
@@ -153,7 +222,7 @@ func (h *latencyHandler) executeLatencyTest(sampleQuantity int) testResults {
 			cancelFunc()
 		}()
 
-		h.printLogs(sampleQuantity)
+		printLogs(run)
 
 		testTimeout := time.Now().Add(30 * time.Second)
 		ticker := time.NewTicker(time.Second)
@@ -165,44 +234,41 @@ func (h *latencyHandler) executeLatencyTest(sampleQuantity int) testResults {
 		}
 	}()
 
-	results := h.walk(ctx, sampleQuantity, startTime)
-	return computeTestResults(results, sampleQuantity)
+	h.walk(ctx, run)
 }
 
-func (h *latencyHandler) walk(ctx context.Context, sampleQuantity int, startTime time.Time) map[string]time.Duration {
-	results := make(map[string]time.Duration)
-
+func (h *latencyHandler) walk(ctx context.Context, run *run) {
 	appID, _ := appID()
 	lcClient := client.NewClient(h.location.String(),
 		client.WithHTTPClient(&httpClient{
-			AuthToken: h.token,
+			tokens: h.tokens,
 		}))
 
-	visitor := h.visitor(results, sampleQuantity)
+	visitor := visitor(run)
 	for {
-		fmt.Printf("\n%d results recorded so far\n", len(results))
+		fmt.Printf("\n%d results recorded so far\n", run.received())
 
 		select {
 		case <-ctx.Done():
-			return results
+			return
 		default:
 			client.Walk(ctx, appID, visitor, lcClient.Read,
 				client.WithWalkEnvelopeTypes(logcache_v1.EnvelopeType_LOG),
 				client.WithWalkLimit(1000),
 				client.WithWalkLogger(log.New(os.Stdout, "walk: ", 0)),
 				client.WithWalkBackoff(client.NewAlwaysRetryBackoff(100*time.Millisecond)),
-				client.WithWalkStartTime(startTime.Add(-time.Second)),
+				client.WithWalkStartTime(run.startTime.Add(-time.Second)),
 				client.WithWalkDelay(time.Nanosecond),
 			)
 
-			if len(results) == sampleQuantity {
-				return results
+			if run.received() == run.samples {
+				return
 			}
 		}
 	}
 }
 
-func (h *latencyHandler) visitor(results map[string]time.Duration, sampleQuantity int) client.Visitor {
+func visitor(run *run) client.Visitor {
 	return func(envelopes []*loggregator_v2.Envelope) bool {
 		for _, envelope := range envelopes {
 			end := time.Now()
@@ -210,59 +276,26 @@ func (h *latencyHandler) visitor(results map[string]time.Duration, sampleQuantit
 			switch envelope.GetMessage().(type) {
 			case *loggregator_v2.Envelope_Log:
 				message := string(envelope.GetLog().GetPayload())
-				if strings.Contains(message, messagePrefix) {
-					h.recordResult(results, message, end)
+				if strings.HasPrefix(message, run.prefix) && run.receive(message, end) {
+					return false
 				}
 			default:
 				continue
 			}
-
-			if len(results) == sampleQuantity {
-				return false
-			}
 		}
 
-		return !h.pastDoneSendingTime(results, envelopes[len(envelopes)-1].GetTimestamp())
+		return !run.pastDoneSendingTime(envelopes[len(envelopes)-1].GetTimestamp())
 	}
 }
 
-func (h *latencyHandler) pastDoneSendingTime(results map[string]time.Duration, lastEnvelopeTimestamp int64) bool {
-	h.mutex.Lock()
-	doneSendingTime, ok := h.sendTimes["done_sending"]
-	h.mutex.Unlock()
-
-	return ok && time.Unix(0, lastEnvelopeTimestamp).After(doneSendingTime.Add(5*time.Second))
-}
-
-func (h *latencyHandler) recordResult(results map[string]time.Duration, message string, end time.Time) {
-	_, alreadyReceived := results[message]
-	if alreadyReceived {
-		return
-	}
-
-	h.mutex.Lock()
-	start, ok := h.sendTimes[message]
-	h.mutex.Unlock()
-
-	if ok {
-		results[message] = end.Sub(start)
-	}
-}
-
-func (h *latencyHandler) printLogs(sampleQuantity int) {
+func printLogs(run *run) {
 	defer println("done printing log messages")
-	for i := 0; i < sampleQuantity; i++ {
-		sampleMessage := generateRandomMessage()
-		h.mutex.Lock()
-		h.sendTimes[sampleMessage] = time.Now()
-		fmt.Println(sampleMessage)
-		h.mutex.Unlock()
+	for i := 0; i < run.samples; i++ {
+		run.send(i)
 		time.Sleep(time.Millisecond)
 	}
 
-	h.mutex.Lock()
-	h.sendTimes["done_sending"] = time.Now()
-	h.mutex.Unlock()
+	run.doneSending()
 }
 
 func computeTestResults(results map[string]time.Duration, sampleQuantity int) testResults {
@@ -290,17 +323,19 @@ func computeTestResults(results map[string]time.Duration, sampleQuantity int) te
 	return r
 }
 
-func generateRandomMessage() string {
-	id, _ := uuid.NewV4()
-	return fmt.Sprint(messagePrefix, id.String())
-}
-
+// httpClient sets the Authorization header of each request to a token from
+// the TokenSource.
 type httpClient struct {
-	AuthToken string
+	tokens uaa.TokenSource
 }
 
 func (c *httpClient) Do(req *http.Request) (*http.Response, error) {
-	req.Header["Authorization"] = []string{c.AuthToken}
+	token, err := c.tokens.Token()
+	if err != nil {
+		fmt.Printf("failed to get token: %s\n", err)
+		return nil, err
+	}
+	req.Header["Authorization"] = []string{token}
 
 	response, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-tools/latency-common/uaa"
+)
+
+var _ = Describe("latencyHandler", func() {
+	var (
+		logCache *httptest.Server
+		h        *latencyHandler
+	)
+
+	BeforeEach(func() {
+		h = &latencyHandler{
+			tokens: uaa.StaticToken("bearer token"),
+			runs:   newRunStore(),
+		}
+
+		// The fake Log Cache returns every message the runs have sent.
+		logCache = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/v1/read/") {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			var envelopes []string
+			h.runs.mu.Lock()
+			for _, run := range h.runs.runs {
+				run.mu.Lock()
+				for msg, sent := range run.sendTimes {
+					envelopes = append(envelopes, fmt.Sprintf(`{"timestamp":"%d","log":{"payload":%q}}`,
+						sent.UnixNano(), base64.StdEncoding.EncodeToString([]byte(msg))))
+				}
+				run.mu.Unlock()
+			}
+			h.runs.mu.Unlock()
+
+			_, _ = fmt.Fprintf(w, `{"envelopes":{"batch":[%s]}}`, strings.Join(envelopes, ","))
+		}))
+
+		location, err := url.Parse(logCache.URL)
+		Expect(err).ToNot(HaveOccurred())
+		h.location = location
+	})
+
+	AfterEach(func() {
+		logCache.Close()
+	})
+
+	getRun := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/latency/"+id, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		h.getRun(rec, req)
+		return rec
+	}
+
+	It("starts a test with POST and returns its results with GET", func() {
+		rec := httptest.NewRecorder()
+		h.startRun(rec, httptest.NewRequest(http.MethodPost, "/latency?samples=3", nil))
+
+		Expect(rec.Code).To(Equal(http.StatusAccepted))
+		var started runStatus
+		Expect(json.Unmarshal(rec.Body.Bytes(), &started)).To(Succeed())
+		Expect(rec.Header().Get("Location")).To(Equal("/latency/" + started.ID))
+		Expect(started.State).To(Equal("running"))
+		Expect(started.Samples).To(Equal(3))
+
+		var status runStatus
+		Eventually(func() string {
+			rec := getRun(started.ID)
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(json.Unmarshal(rec.Body.Bytes(), &status)).To(Succeed())
+			return status.State
+		}, 5*time.Second).Should(Equal("finished"))
+
+		Expect(status.Sent).To(Equal(3))
+		Expect(status.Received).To(Equal(3))
+		Expect(status.Results.LogsReceived).To(Equal(3))
+		Expect(status.Results.LogsExpected).To(Equal(3))
+		Expect(status.Results.MaxSeconds).To(BeNumerically(">=", 0))
+	})
+
+	It("returns 404 for unknown tests", func() {
+		Expect(getRun("unknown").Code).To(Equal(http.StatusNotFound))
+	})
+})
+
+// countingTokens issues a new numbered token each time it is asked for
+// one, or fails with err if it is set.
+type countingTokens struct {
+	mu     sync.Mutex
+	issued int
+	err    error
+}
+
+func (t *countingTokens) Token() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil {
+		return "", t.err
+	}
+	t.issued++
+	return fmt.Sprintf("bearer token-%d", t.issued), nil
+}
+
+var _ = Describe("httpClient", func() {
+	It("sets the Authorization header to the current token", func() {
+		headers := make(chan string, 10)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers <- r.Header.Get("Authorization")
+		}))
+		defer server.Close()
+
+		c := &httpClient{tokens: &countingTokens{}}
+
+		for _, want := range []string{"bearer token-1", "bearer token-2"} {
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = c.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(headers).To(Receive(Equal(want)))
+		}
+	})
+
+	It("does not send the request without a token", func() {
+		c := &httpClient{tokens: &countingTokens{err: errors.New("no token")}}
+
+		req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:1", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = c.Do(req)
+		Expect(err).To(MatchError("no token"))
+	})
+})
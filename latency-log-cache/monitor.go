@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator/v10"
+	"code.cloudfoundry.org/loggregator-tools/latency-common/slo"
+)
+
+// monitor runs a small latency test every interval. It exports the
+// latencies as a Prometheus histogram, along with the SLO burn.
+type monitor struct {
+	slo.Config
+	start   func(samples int) *run
+	alerter alerter
+
+	mu     sync.Mutex
+	window *slo.Window
+	// The PromQL probe counts every query since the monitor started and
+	// keeps the latency of the last probe, by query API.
+	promQL map[string]*promQLStats
+}
+
+type promQLStats struct {
+	latencySeconds float64
+	queries        uint64
+	errors         uint64
+}
+
+// alerter is told when the SLO is breached.
+type alerter interface {
+	alert(burn float64)
+}
+
+// monitorInput builds a monitor if MONITOR_INTERVAL is set. SLO breaches
+// are emitted through the ingress client, if any.
+func monitorInput(start func(samples int) *run, ingress *loggregator.IngressClient) (*monitor, error) {
+	c, ok, err := slo.Input(defaultSampleSize)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	m := &monitor{
+		Config:  c,
+		start:   start,
+		alerter: logAlerter{},
+		window:  slo.NewWindow(),
+		promQL:  make(map[string]*promQLStats),
+	}
+	if ingress != nil {
+		m.alerter = &ingressAlerter{client: ingress}
+	}
+
+	return m, nil
+}
+
+// run samples the latency every interval. It never returns.
+func (m *monitor) run() {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.sample()
+		<-ticker.C
+	}
+}
+
+func (m *monitor) sample() {
+	run := m.start(m.Samples)
+	<-run.done
+
+	received, lost := run.latencies()
+	now := time.Now()
+
+	m.mu.Lock()
+	m.window.Record(now, received, lost, m.Threshold)
+	if res := run.promQLResults(); res != nil {
+		m.recordPromQL("instant", res.Instant)
+		m.recordPromQL("range", res.Range)
+	}
+	burn, ok := m.window.Burn(now.Add(-m.Window))
+	m.mu.Unlock()
+
+	if ok && m.Breached(burn) {
+		m.alerter.alert(burn)
+	}
+}
+
+// recordPromQL records the PromQL probe results of a query API. It must be
+// called with the mu held.
+func (m *monitor) recordPromQL(api string, r promQLAPIResults) {
+	s, ok := m.promQL[api]
+	if !ok {
+		s = &promQLStats{}
+		m.promQL[api] = s
+	}
+
+	s.latencySeconds = r.LatencySeconds
+	s.queries += uint64(r.Queries)
+	s.errors += uint64(r.Errors)
+}
+
+// ServeHTTP exports the monitored latencies in the Prometheus text
+// exposition format.
+func (m *monitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	burn, _ := m.window.Burn(time.Now().Add(-m.Window))
+
+	var b strings.Builder
+	b.WriteString("# TYPE loggregator_latency_monitor_seconds histogram\n")
+	m.window.WriteHistogram(&b, "loggregator_latency_monitor_seconds", "")
+
+	fmt.Fprintf(&b, `# TYPE loggregator_latency_monitor_lost_total counter
+loggregator_latency_monitor_lost_total %d
+# TYPE loggregator_latency_slo_burn gauge
+loggregator_latency_slo_burn %g
+# TYPE loggregator_latency_slo_threshold_seconds gauge
+loggregator_latency_slo_threshold_seconds %g
+# TYPE loggregator_latency_slo_target gauge
+loggregator_latency_slo_target %g
+`,
+		m.window.Lost, burn, m.Threshold.Seconds(), m.Target,
+	)
+
+	if len(m.promQL) > 0 {
+		apis := slices.Sorted(maps.Keys(m.promQL))
+
+		b.WriteString("# TYPE loggregator_latency_promql_seconds gauge\n")
+		for _, api := range apis {
+			latency := m.promQL[api].latencySeconds
+			if latency < 0 {
+				latency = math.NaN()
+			}
+			fmt.Fprintf(&b, "loggregator_latency_promql_seconds{api=%q} %g\n", api, latency)
+		}
+
+		b.WriteString("# TYPE loggregator_latency_promql_queries_total counter\n")
+		for _, api := range apis {
+			fmt.Fprintf(&b, "loggregator_latency_promql_queries_total{api=%q} %d\n", api, m.promQL[api].queries)
+		}
+
+		b.WriteString("# TYPE loggregator_latency_promql_errors_total counter\n")
+		for _, api := range apis {
+			fmt.Fprintf(&b, "loggregator_latency_promql_errors_total{api=%q} %d\n", api, m.promQL[api].errors)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// logAlerter only logs SLO breaches.
+type logAlerter struct{}
+
+func (logAlerter) alert(burn float64) {
+	log.Printf("latency SLO breached: %.2f%% of the logs were slow or lost", 100*burn)
+}
+
+// ingressAlerter emits a latency_slo_breach counter envelope to the
+// Loggregator agent for each SLO breach. The envelope has the app as its
+// source.
+type ingressAlerter struct {
+	client *loggregator.IngressClient
+}
+
+func (a *ingressAlerter) alert(burn float64) {
+	logAlerter{}.alert(burn)
+
+	appID, _ := appID()
+	a.client.EmitCounter("latency_slo_breach",
+		loggregator.WithDelta(1),
+		loggregator.WithCounterSourceInfo(appID, os.Getenv("CF_INSTANCE_INDEX")),
+	)
+}
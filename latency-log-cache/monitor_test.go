@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-tools/latency-common/slo"
+)
+
+// fakeAlerter records the SLO breaches it is told about.
+type fakeAlerter struct {
+	mu    sync.Mutex
+	burns []float64
+}
+
+func (a *fakeAlerter) alert(burn float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.burns = append(a.burns, burn)
+}
+
+// finishedRun builds a finished run whose first messages took the given
+// latencies. Its other messages were lost.
+func finishedRun(samples int, latencies ...time.Duration) *run {
+	r := newRun(samples)
+	for i, d := range latencies {
+		r.send(i)
+		msg := r.prefix + strconv.Itoa(i)
+		r.receive(msg, r.sendTimes[msg].Add(d))
+	}
+	r.finish()
+
+	return r
+}
+
+var _ = Describe("monitor", func() {
+	var (
+		runs    chan *run
+		alerter *fakeAlerter
+		m       *monitor
+	)
+
+	BeforeEach(func() {
+		runs = make(chan *run, 10)
+		alerter = &fakeAlerter{}
+		m = &monitor{
+			Config: slo.Config{
+				Window:    time.Hour,
+				Samples:   4,
+				Threshold: time.Second,
+				Target:    0.75,
+			},
+			start: func(samples int) *run {
+				Expect(samples).To(Equal(4))
+				return <-runs
+			},
+			alerter: alerter,
+			window:  slo.NewWindow(),
+			promQL:  make(map[string]*promQLStats),
+		}
+	})
+
+	It("records the received and lost messages of each test", func() {
+		runs <- finishedRun(4, time.Millisecond, 2*time.Second, time.Millisecond)
+		m.sample()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		Expect(m.window.Count).To(Equal(uint64(3)))
+		Expect(m.window.Lost).To(Equal(uint64(1)))
+		burn, ok := m.window.Burn(time.Now().Add(-m.Window))
+		Expect(ok).To(BeTrue())
+		Expect(burn).To(Equal(0.5))
+	})
+
+	It("alerts while the burn exceeds the error budget", func() {
+		runs <- finishedRun(4, time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond)
+		m.sample()
+		runs <- finishedRun(4, time.Millisecond, time.Millisecond)
+		m.sample()
+		Expect(alerter.burns).To(BeEmpty())
+
+		runs <- finishedRun(4, time.Millisecond, 2*time.Second)
+		m.sample()
+		Expect(alerter.burns).To(Equal([]float64{5.0 / 12}))
+	})
+
+	It("exports the latencies, the burn and the PromQL probe on /metrics", func() {
+		r := newRun(4)
+		r.setPromQL(promQLResults{
+			Instant: promQLAPIResults{LatencySeconds: 1.5, Queries: 3, Errors: 1},
+			Range:   promQLAPIResults{LatencySeconds: -1, Queries: 4},
+		})
+		r.send(0)
+		r.receive(r.prefix+"0", r.sendTimes[r.prefix+"0"].Add(5*time.Millisecond))
+		r.finish()
+		runs <- r
+		m.sample()
+
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		Expect(rec.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4"))
+		Expect(strings.Split(rec.Body.String(), "\n")).To(ContainElements(
+			"# TYPE loggregator_latency_monitor_seconds histogram",
+			`loggregator_latency_monitor_seconds_bucket{le="0.005"} 1`,
+			`loggregator_latency_monitor_seconds_bucket{le="+Inf"} 1`,
+			"loggregator_latency_monitor_seconds_sum 0.005",
+			"loggregator_latency_monitor_seconds_count 1",
+			"loggregator_latency_monitor_lost_total 3",
+			"loggregator_latency_slo_burn 0.75",
+			"loggregator_latency_slo_threshold_seconds 1",
+			"loggregator_latency_slo_target 0.75",
+			`loggregator_latency_promql_seconds{api="instant"} 1.5`,
+			`loggregator_latency_promql_seconds{api="range"} NaN`,
+			`loggregator_latency_promql_queries_total{api="instant"} 3`,
+			`loggregator_latency_promql_queries_total{api="range"} 4`,
+			`loggregator_latency_promql_errors_total{api="instant"} 1`,
+			`loggregator_latency_promql_errors_total{api="range"} 0`,
+		))
+	})
+})
+
+var _ = Describe("monitorInput", func() {
+	AfterEach(func() {
+		Expect(os.Unsetenv("MONITOR_INTERVAL")).To(Succeed())
+	})
+
+	It("is disabled without an interval", func() {
+		m, err := monitorInput(nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m).To(BeNil())
+	})
+
+	It("samples at the interval with the default sample size", func() {
+		Expect(os.Setenv("MONITOR_INTERVAL", "30s")).To(Succeed())
+
+		m, err := monitorInput(nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.Interval).To(Equal(30 * time.Second))
+		Expect(m.Samples).To(Equal(defaultSampleSize))
+		Expect(m.alerter).To(Equal(logAlerter{}))
+	})
+})
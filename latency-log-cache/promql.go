@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	client "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	loggregator "code.cloudfoundry.org/go-loggregator/v10"
+	"code.cloudfoundry.org/loggregator-tools/latency-common/uaa"
+)
+
+// probeMetric is the name of the gauge emitted by the PromQL probe.
+const probeMetric = "loggregator_latency_probe"
+
+const (
+	promQLPollInterval = 250 * time.Millisecond
+	promQLTimeout      = 30 * time.Second
+)
+
+// promQLProbe measures how long a gauge emitted by the app takes to be
+// returned by Log Cache's PromQL API. Each probe emits the gauge with a
+// unique value and polls both the instant and the range query API until
+// they return it. The gauge is tagged with the ID of the test so that
+// probes of concurrent tests do not overwrite each other's series.
+type promQLProbe struct {
+	client   *client.Client
+	emitter  gaugeEmitter
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// probeInput builds a promQLProbe if PROMQL_PROBE is set. The gauge is
+// emitted through the ingress client if there is one, and printed in the
+// metric registrar's format otherwise.
+func probeInput(location *url.URL, tokens uaa.TokenSource, ingress *loggregator.IngressClient) (*promQLProbe, error) {
+	probe := os.Getenv("PROMQL_PROBE")
+	if probe == "" {
+		return nil, nil
+	}
+
+	enabled, err := strconv.ParseBool(probe)
+	if err != nil {
+		return nil, fmt.Errorf("invalid promql probe: %q", probe)
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	p := &promQLProbe{
+		client: client.NewClient(location.String(),
+			client.WithHTTPClient(&httpClient{
+				tokens: tokens,
+			})),
+		emitter:  stdoutEmitter{},
+		interval: promQLPollInterval,
+		timeout:  promQLTimeout,
+	}
+	if ingress != nil {
+		p.emitter = ingressEmitter{client: ingress}
+	}
+
+	return p, nil
+}
+
+// gaugeEmitter emits a gauge with the app as its source.
+type gaugeEmitter interface {
+	emitGauge(name string, value float64, tags map[string]string)
+}
+
+// promQLResults are the results of a PromQL probe for each query API.
+type promQLResults struct {
+	Instant promQLAPIResults `json:"instant"`
+	Range   promQLAPIResults `json:"range"`
+}
+
+// promQLAPIResults are the results of a PromQL probe for a query API. The
+// latency is -1 if the gauge was not returned before the probe timed out.
+type promQLAPIResults struct {
+	LatencySeconds float64 `json:"latency_seconds"`
+	Queries        int     `json:"queries"`
+	Errors         int     `json:"errors"`
+	ErrorRate      float64 `json:"error_rate"`
+}
+
+// run emits the gauge for the given test and polls Log Cache until both
+// query APIs return it or the probe times out.
+func (p *promQLProbe) run(runID string) promQLResults {
+	appID, _ := appID()
+	query := fmt.Sprintf("%s{source_id=%q,run_id=%q}", probeMetric, appID, runID)
+	// Values up to 2^53 survive the round trip through Log Cache exactly.
+	value := float64(rand.Int64N(1 << 53))
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	results := promQLResults{
+		Instant: promQLAPIResults{LatencySeconds: -1},
+		Range:   promQLAPIResults{LatencySeconds: -1},
+	}
+
+	start := time.Now()
+	p.emitter.emitGauge(probeMetric, value, map[string]string{"run_id": runID})
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for results.Instant.LatencySeconds < 0 || results.Range.LatencySeconds < 0 {
+		if results.Instant.LatencySeconds < 0 {
+			res, err := p.client.PromQL(ctx, query)
+			results.Instant.record(ctx, start, err, instantContains(res, value))
+		}
+
+		if results.Range.LatencySeconds < 0 {
+			res, err := p.client.PromQLRange(ctx, query,
+				client.WithPromQLStart(start.Add(-time.Minute)),
+				client.WithPromQLEnd(time.Now()),
+				client.WithPromQLStep("1s"),
+			)
+			results.Range.record(ctx, start, err, rangeContains(res, value))
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("promql probe timed out, value %s not found", strconv.FormatFloat(value, 'f', -1, 64))
+			return results.finish()
+		case <-ticker.C:
+		}
+	}
+
+	return results.finish()
+}
+
+// record counts a query. Queries cut short by the probe timing out are not
+// counted as errors.
+func (r *promQLAPIResults) record(ctx context.Context, start time.Time, err error, found bool) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	r.Queries++
+	if err != nil {
+		r.Errors++
+		log.Printf("promql query failed: %s", err)
+		return
+	}
+
+	if found {
+		r.LatencySeconds = time.Since(start).Seconds()
+	}
+}
+
+func (r promQLResults) finish() promQLResults {
+	for _, api := range []*promQLAPIResults{&r.Instant, &r.Range} {
+		if api.Queries > 0 {
+			api.ErrorRate = float64(api.Errors) / float64(api.Queries)
+		}
+	}
+
+	return r
+}
+
+func instantContains(res *logcache_v1.PromQL_InstantQueryResult, value float64) bool {
+	for _, s := range res.GetVector().GetSamples() {
+		if s.GetPoint().GetValue() == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func rangeContains(res *logcache_v1.PromQL_RangeQueryResult, value float64) bool {
+	for _, s := range res.GetMatrix().GetSeries() {
+		for _, p := range s.GetPoints() {
+			if p.GetValue() == value {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// stdoutEmitter prints the gauge in the JSON structured log format of the
+// metric registrar. The app must be registered with
+// `cf register-log-format <app> json`.
+type stdoutEmitter struct{}
+
+func (stdoutEmitter) emitGauge(name string, value float64, tags map[string]string) {
+	t, _ := json.Marshal(tags)
+	fmt.Printf("{\"type\":\"gauge\",\"name\":%q,\"value\":%s,\"tags\":%s}\n",
+		name, strconv.FormatFloat(value, 'f', -1, 64), t)
+}
+
+// ingressEmitter emits the gauge to the Loggregator agent.
+type ingressEmitter struct {
+	client *loggregator.IngressClient
+}
+
+func (e ingressEmitter) emitGauge(name string, value float64, tags map[string]string) {
+	appID, _ := appID()
+	e.client.EmitGauge(
+		loggregator.WithGaugeValue(name, value, "probe"),
+		loggregator.WithGaugeSourceInfo(appID, os.Getenv("CF_INSTANCE_INDEX")),
+		loggregator.WithEnvelopeTags(tags),
+	)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	client "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/loggregator-tools/latency-common/uaa"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeEmitter records the emitted gauges.
+type fakeEmitter struct {
+	mu     sync.Mutex
+	values map[string]float64
+	tags   map[string]map[string]string
+}
+
+func (e *fakeEmitter) emitGauge(name string, value float64, tags map[string]string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.values[name] = value
+	e.tags[name] = tags
+}
+
+func (e *fakeEmitter) value(name string) (float64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	v, ok := e.values[name]
+	return v, ok
+}
+
+var _ = Describe("promQLProbe", func() {
+	var (
+		emitter *fakeEmitter
+		server  *httptest.Server
+
+		mu sync.Mutex
+		// Each query API fails with its first failures queries and only
+		// returns the gauge from its visibleAfter-th query.
+		queries      map[string]int
+		failures     int
+		visibleAfter int
+		// requests are the query parameters of every request by path.
+		requests map[string][]url.Values
+	)
+
+	requestsTo := func(path string) []url.Values {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return requests[path]
+	}
+
+	BeforeEach(func() {
+		emitter = &fakeEmitter{
+			values: make(map[string]float64),
+			tags:   make(map[string]map[string]string),
+		}
+		queries = make(map[string]int)
+		requests = make(map[string][]url.Values)
+		failures = 0
+		visibleAfter = 3
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[r.URL.Path] = append(requests[r.URL.Path], r.URL.Query())
+			queries[r.URL.Path]++
+			n := queries[r.URL.Path]
+			mu.Unlock()
+
+			if n <= failures {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			value, _ := emitter.value(probeMetric)
+			if n < visibleAfter {
+				value = 0
+			}
+			v := strconv.FormatFloat(value, 'f', -1, 64)
+
+			switch r.URL.Path {
+			case "/api/v1/query":
+				_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":[`+
+					`{"metric":{"source_id":"app"},"value":[1700000000.000,%q]}]}}`, v)
+			case "/api/v1/query_range":
+				_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[`+
+					`{"metric":{"source_id":"app"},"values":[[1700000000.000,"1"],[1700000001.000,%q]]}]}}`, v)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	newProbe := func(timeout time.Duration) *promQLProbe {
+		return &promQLProbe{
+			client:   client.NewClient(server.URL, client.WithHTTPClient(&httpClient{tokens: uaa.StaticToken("bearer token")})),
+			emitter:  emitter,
+			interval: 10 * time.Millisecond,
+			timeout:  timeout,
+		}
+	}
+
+	It("queries the gauge of its test", func() {
+		newProbe(5 * time.Second).run("run-1")
+
+		Expect(emitter.tags[probeMetric]).To(Equal(map[string]string{"run_id": "run-1"}))
+		Expect(requestsTo("/api/v1/query")).To(HaveLen(3))
+		for _, q := range requestsTo("/api/v1/query") {
+			Expect(q.Get("query")).To(Equal(`loggregator_latency_probe{source_id="",run_id="run-1"}`))
+		}
+		Expect(requestsTo("/api/v1/query_range")).To(HaveLen(3))
+		for _, q := range requestsTo("/api/v1/query_range") {
+			Expect(q.Get("query")).To(Equal(`loggregator_latency_probe{source_id="",run_id="run-1"}`))
+			Expect(q.Get("step")).To(Equal("1s"))
+		}
+	})
+
+	It("records how long both query APIs take to return the gauge", func() {
+		results := newProbe(5 * time.Second).run("run-1")
+
+		for _, api := range []promQLAPIResults{results.Instant, results.Range} {
+			Expect(api.LatencySeconds).To(BeNumerically(">=", (20 * time.Millisecond).Seconds()))
+			Expect(api.LatencySeconds).To(BeNumerically("<", 5))
+			Expect(api.Queries).To(Equal(3))
+			Expect(api.Errors).To(BeZero())
+			Expect(api.ErrorRate).To(BeZero())
+		}
+	})
+
+	It("emits a different value for each probe", func() {
+		newProbe(5 * time.Second).run("run-1")
+		first, _ := emitter.value(probeMetric)
+
+		mu.Lock()
+		queries = make(map[string]int)
+		mu.Unlock()
+		newProbe(5 * time.Second).run("run-2")
+		second, _ := emitter.value(probeMetric)
+
+		Expect(first).ToNot(Equal(second))
+	})
+
+	It("records the failed queries", func() {
+		failures = 2
+		visibleAfter = 4
+
+		results := newProbe(5 * time.Second).run("run-1")
+
+		for _, api := range []promQLAPIResults{results.Instant, results.Range} {
+			Expect(api.LatencySeconds).To(BeNumerically(">", 0))
+			Expect(api.Queries).To(Equal(4))
+			Expect(api.Errors).To(Equal(2))
+			Expect(api.ErrorRate).To(Equal(0.5))
+		}
+	})
+
+	It("gives up once it times out", func() {
+		visibleAfter = 1 << 30
+
+		results := newProbe(100 * time.Millisecond).run("run-1")
+
+		for _, api := range []promQLAPIResults{results.Instant, results.Range} {
+			Expect(api.LatencySeconds).To(Equal(-1.0))
+			Expect(api.Queries).To(BeNumerically(">", 1))
+			Expect(api.Errors).To(BeZero())
+		}
+	})
+})
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// maxRuns is how many runs are kept for GET /latency/{id}. The oldest
+// finished runs are removed first.
+const maxRuns = 100
+
+// run is a single latency test. The messages of a run start with a prefix
+// unique to the run, so concurrent runs do not see each other's messages.
+type run struct {
+	id        string
+	prefix    string
+	samples   int
+	startTime time.Time
+	done      chan struct{}
+
+	mu              sync.Mutex
+	sendTimes       map[string]time.Time
+	doneSendingTime time.Time
+	results         map[string]time.Duration
+	promQL          *promQLResults
+	report          testResults
+}
+
+// runStatus is the JSON representation of a run. The results are only set
+// once the run is finished.
+type runStatus struct {
+	ID        string       `json:"id"`
+	State     string       `json:"state"`
+	Samples   int          `json:"samples"`
+	Sent      int          `json:"sent"`
+	Received  int          `json:"received"`
+	StartTime time.Time    `json:"start_time"`
+	Results   *testResults `json:"results,omitempty"`
+}
+
+func newRun(samples int) *run {
+	id, _ := uuid.NewV4()
+
+	return &run{
+		id:        id.String(),
+		prefix:    fmt.Sprint(messagePrefix, id.String(), "-"),
+		samples:   samples,
+		startTime: time.Now(),
+		done:      make(chan struct{}),
+		sendTimes: make(map[string]time.Time),
+		results:   make(map[string]time.Duration),
+	}
+}
+
+// send prints the i-th message of the run and records when it was sent.
+func (r *run) send(i int) {
+	msg := r.prefix + strconv.Itoa(i)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sendTimes[msg] = time.Now()
+	fmt.Println(msg)
+}
+
+func (r *run) doneSending() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.doneSendingTime = time.Now()
+}
+
+// pastDoneSendingTime returns whether the envelope timestamp is well past
+// the time the last message of the run was sent.
+func (r *run) pastDoneSendingTime(lastEnvelopeTimestamp int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return !r.doneSendingTime.IsZero() &&
+		time.Unix(0, lastEnvelopeTimestamp).After(r.doneSendingTime.Add(5*time.Second))
+}
+
+// receive records the latency of the message if it was sent by the run. It
+// returns whether all messages of the run have been received.
+func (r *run) receive(msg string, end time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	start, ok := r.sendTimes[msg]
+	if _, alreadyReceived := r.results[msg]; ok && !alreadyReceived {
+		r.results[msg] = end.Sub(start)
+	}
+
+	return len(r.results) == r.samples
+}
+
+// latencies returns the latencies of the received messages and how many
+// messages were lost.
+func (r *run) latencies() ([]time.Duration, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Collect(maps.Values(r.results)), r.samples - len(r.results)
+}
+
+func (r *run) received() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.results)
+}
+
+// setPromQL records the results of the PromQL probe of the run.
+func (r *run) setPromQL(results promQLResults) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.promQL = &results
+}
+
+// promQLResults returns the results of the PromQL probe of the run, or nil
+// if it was not probed.
+func (r *run) promQLResults() *promQLResults {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.promQL
+}
+
+// finish computes the results of the run and marks it as done.
+func (r *run) finish() {
+	r.mu.Lock()
+	r.report = computeTestResults(r.results, r.samples)
+	r.report.PromQL = r.promQL
+	r.mu.Unlock()
+
+	close(r.done)
+}
+
+func (r *run) finished() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *run) status() runStatus {
+	finished := r.finished()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := runStatus{
+		ID:        r.id,
+		State:     "running",
+		Samples:   r.samples,
+		Sent:      len(r.sendTimes),
+		Received:  len(r.results),
+		StartTime: r.startTime,
+	}
+	if finished {
+		report := r.report
+		s.State = "finished"
+		s.Results = &report
+	}
+
+	return s
+}
+
+// runStore keeps the most recent runs by ID.
+type runStore struct {
+	mu    sync.Mutex
+	runs  map[string]*run
+	order []string
+}
+
+func newRunStore() *runStore {
+	return &runStore{
+		runs: make(map[string]*run),
+	}
+}
+
+func (s *runStore) add(r *run) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runs[r.id] = r
+	s.order = append(s.order, r.id)
+
+	for i := 0; len(s.order) > maxRuns && i < len(s.order); {
+		id := s.order[i]
+		if !s.runs[id].finished() {
+			i++
+			continue
+		}
+
+		delete(s.runs, id)
+		s.order = slices.Delete(s.order, i, i+1)
+	}
+}
+
+func (s *runStore) get(id string) (*run, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.runs[id]
+	return r, ok
+}
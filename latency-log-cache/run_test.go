@@ -0,0 +1,89 @@
+package main
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("run", func() {
+	It("only records the messages it sent", func() {
+		r := newRun(2)
+		other := newRun(2)
+		r.send(0)
+		other.send(0)
+
+		Expect(r.receive(other.prefix+"0", time.Now())).To(BeFalse())
+		Expect(r.receive(r.prefix+"1", time.Now())).To(BeFalse())
+		Expect(r.received()).To(BeZero())
+
+		Expect(r.receive(r.prefix+"0", time.Now())).To(BeFalse())
+		Expect(r.received()).To(Equal(1))
+		Expect(other.received()).To(BeZero())
+	})
+
+	It("keeps the latency of the first copy of a message", func() {
+		r := newRun(1)
+		r.send(0)
+		sent := r.sendTimes[r.prefix+"0"]
+
+		Expect(r.receive(r.prefix+"0", sent.Add(time.Second))).To(BeTrue())
+		Expect(r.receive(r.prefix+"0", sent.Add(time.Minute))).To(BeTrue())
+
+		latencies, lost := r.latencies()
+		Expect(latencies).To(Equal([]time.Duration{time.Second}))
+		Expect(lost).To(BeZero())
+	})
+
+	It("reports its results once it is finished", func() {
+		r := newRun(2)
+		r.send(0)
+		r.receive(r.prefix+"0", time.Now())
+		Expect(r.status().State).To(Equal("running"))
+		Expect(r.status().Results).To(BeNil())
+
+		r.finish()
+
+		s := r.status()
+		Expect(s.State).To(Equal("finished"))
+		Expect(s.Sent).To(Equal(1))
+		Expect(s.Received).To(Equal(1))
+		Expect(s.Results.LogsReceived).To(Equal(1))
+		Expect(s.Results.LogsExpected).To(Equal(2))
+	})
+})
+
+var _ = Describe("runStore", func() {
+	finished := func() *run {
+		r := newRun(1)
+		r.finish()
+		return r
+	}
+
+	It("removes the oldest finished runs beyond maxRuns", func() {
+		s := newRunStore()
+		running := newRun(1)
+		s.add(running)
+		oldest := finished()
+		s.add(oldest)
+		for i := 0; i < maxRuns-1; i++ {
+			s.add(finished())
+		}
+
+		Expect(s.order).To(HaveLen(maxRuns))
+		_, ok := s.get(oldest.id)
+		Expect(ok).To(BeFalse())
+		_, ok = s.get(running.id)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("keeps runs that are not finished", func() {
+		s := newRunStore()
+		for i := 0; i < maxRuns+1; i++ {
+			s.add(newRun(1))
+		}
+
+		Expect(s.order).To(HaveLen(maxRuns + 1))
+	})
+})
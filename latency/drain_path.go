@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+// drainPath receives the app's logs from an HTTPS syslog drain. It only
+// receives logs if the app is bound to a drain with the URL of its own
+// /drain endpoint.
+type drainPath struct {
+	mu        sync.Mutex
+	nextID    int
+	receivers map[int]func(string, time.Time)
+}
+
+func newDrainPath() *drainPath {
+	return &drainPath{
+		receivers: make(map[int]func(string, time.Time)),
+	}
+}
+
+func (p *drainPath) stream(ctx context.Context, receive func(string, time.Time)) {
+	p.mu.Lock()
+	id := p.nextID
+	p.nextID++
+	p.receivers[id] = receive
+	p.mu.Unlock()
+
+	<-ctx.Done()
+
+	p.mu.Lock()
+	delete(p.receivers, id)
+	p.mu.Unlock()
+}
+
+// ServeHTTP handles the RFC-5424 messages the syslog agent posts to the
+// drain.
+func (p *drainPath) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	end := time.Now()
+	defer r.Body.Close() //nolint:errcheck
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("failed to read drain body: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	msg := rfc5424.Message{}
+	err = msg.UnmarshalBinary(body)
+	if err != nil {
+		log.Printf("failed to unmarshal (via RFC-5424) drain message: %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, receive := range p.receivers {
+		receive(string(msg.Message), end)
+	}
+}
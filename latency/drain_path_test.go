@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"code.cloudfoundry.org/rfc5424"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("drainPath", func() {
+	var p *drainPath
+
+	BeforeEach(func() {
+		p = newDrainPath()
+	})
+
+	post := func(body []byte) int {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/drain", bytes.NewReader(body)))
+		return rec.Code
+	}
+
+	syslog := func(msg string) []byte {
+		m := rfc5424.Message{
+			Priority:  rfc5424.Daemon | rfc5424.Info,
+			Timestamp: time.Now(),
+			Hostname:  "org.space.app",
+			AppName:   "app-guid",
+			ProcessID: "[APP/PROC/WEB/0]",
+			Message:   []byte(msg + "\n"),
+		}
+		b, err := m.MarshalBinary()
+		Expect(err).ToNot(HaveOccurred())
+		return b
+	}
+
+	// stream registers a receiver that records the messages it receives.
+	stream := func(ctx context.Context) (<-chan string, <-chan struct{}) {
+		msgs := make(chan string, 10)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			p.stream(ctx, func(msg string, _ time.Time) {
+				msgs <- msg
+			})
+		}()
+		return msgs, done
+	}
+
+	receivers := func() int {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return len(p.receivers)
+	}
+
+	It("passes the message of each syslog message to every receiver", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		first, _ := stream(ctx)
+		second, _ := stream(ctx)
+		Eventually(receivers).Should(Equal(2))
+
+		Expect(post(syslog("some-message"))).To(Equal(http.StatusOK))
+
+		Expect(first).To(Receive(Equal("some-message\n")))
+		Expect(second).To(Receive(Equal("some-message\n")))
+	})
+
+	It("unregisters the receiver once its context is done", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		msgs, done := stream(ctx)
+		Eventually(receivers).Should(Equal(1))
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+		Expect(receivers()).To(BeZero())
+
+		Expect(post(syslog("some-message"))).To(Equal(http.StatusOK))
+		Expect(msgs).ToNot(Receive())
+	})
+
+	It("rejects messages that are not RFC-5424", func() {
+		msgs, _ := stream(context.Background())
+		Eventually(receivers).Should(Equal(1))
+
+		Expect(post([]byte("not syslog"))).To(Equal(http.StatusBadRequest))
+		Expect(msgs).ToNot(Receive())
+	})
+})
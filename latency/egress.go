@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cloudfoundry/noaa/v2/consumer"
+	"github.com/cloudfoundry/sonde-go/events"
+
+	"code.cloudfoundry.org/loggregator-tools/latency-common/uaa"
+)
+
+// egressPath receives the app's logs from one of Loggregator's egress
+// paths.
+type egressPath interface {
+	// stream calls receive with each log message of the app and the time it
+	// arrived, until the context is done.
+	stream(ctx context.Context, receive func(msg string, end time.Time))
+}
+
+// streamPath receives the app's logs from the v1 app stream of the
+// Traffic Controller.
+type streamPath struct {
+	location *url.URL
+	tokens   uaa.TokenSource
+}
+
+func (p *streamPath) stream(ctx context.Context, receive func(string, time.Time)) {
+	appID, _ := appID()
+	consumer := consumer.New(p.location.String(), &tls.Config{InsecureSkipVerify: true}, nil)
+	consumer.SetDebugPrinter(ConsoleDebugPrinter{})
+	consumer.RefreshTokenFrom(tokenRefresher{tokens: p.tokens})
+	msgChan, errorChan := consumer.Stream(appID, "")
+	defer consumer.Close() //nolint:errcheck
+
+	go func() {
+		for err := range errorChan {
+			if err == nil {
+				return
+			}
+			log.Println(err)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case envelope := <-msgChan:
+			end := time.Now()
+
+			if envelope.GetEventType() == events.Envelope_LogMessage {
+				receive(string(envelope.GetLogMessage().GetMessage()), end)
+			}
+		}
+	}
+}
+
+type ConsoleDebugPrinter struct{}
+
+func (c ConsoleDebugPrinter) Print(title, dump string) {
+	println(title)
+	println(dump)
+}
+
+// httpClient sets a token from the TokenSource on every request to Log
+// Cache and the RLP gateway.
+type httpClient struct {
+	tokens uaa.TokenSource
+}
+
+func (c *httpClient) Do(req *http.Request) (*http.Response, error) {
+	token, err := c.tokens.Token()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", token)
+
+	return http.DefaultClient.Do(req)
+}
+
+// tokenRefresher lets the noaa consumer get a token from a TokenSource
+// each time it connects to the Traffic Controller.
+type tokenRefresher struct {
+	tokens uaa.TokenSource
+}
+
+func (r tokenRefresher) RefreshAuthToken() (string, error) {
+	return r.tokens.Token()
+}
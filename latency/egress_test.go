@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-tools/latency-common/uaa"
+)
+
+// countingTokens issues a new numbered token each time it is asked for
+// one, or fails with err if it is set.
+type countingTokens struct {
+	mu     sync.Mutex
+	issued int
+	err    error
+}
+
+func (t *countingTokens) Token() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil {
+		return "", t.err
+	}
+	t.issued++
+	return fmt.Sprintf("bearer token-%d", t.issued), nil
+}
+
+var _ = Describe("httpClient", func() {
+	It("sets the Authorization header to the current token", func() {
+		headers := make(chan string, 10)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers <- r.Header.Get("Authorization")
+		}))
+		defer server.Close()
+
+		c := &httpClient{tokens: &countingTokens{}}
+
+		for _, want := range []string{"bearer token-1", "bearer token-2"} {
+			req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = c.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(headers).To(Receive(Equal(want)))
+		}
+	})
+
+	It("does not send the request without a token", func() {
+		c := &httpClient{tokens: &countingTokens{err: errors.New("no token")}}
+
+		req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:1", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = c.Do(req)
+		Expect(err).To(MatchError("no token"))
+	})
+})
+
+var _ = Describe("tokenRefresher", func() {
+	It("gives the noaa consumer the current token", func() {
+		r := tokenRefresher{tokens: &countingTokens{}}
+
+		token, err := r.RefreshAuthToken()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("bearer token-1"))
+	})
+
+	It("gives the noaa consumer the static token", func() {
+		token, err := tokenRefresher{tokens: uaa.StaticToken("bearer some-token")}.RefreshAuthToken()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("bearer some-token"))
+	})
+})
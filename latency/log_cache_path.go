@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	client "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-tools/latency-common/uaa"
+)
+
+// logCachePath receives the app's logs by walking Log Cache. The latency
+// includes the interval Log Cache is polled at.
+type logCachePath struct {
+	addr   string
+	tokens uaa.TokenSource
+}
+
+func (p *logCachePath) stream(ctx context.Context, receive func(string, time.Time)) {
+	appID, _ := appID()
+	lcClient := client.NewClient(p.addr,
+		client.WithHTTPClient(&httpClient{
+			tokens: p.tokens,
+		}))
+
+	client.Walk(ctx, appID,
+		func(envelopes []*loggregator_v2.Envelope) bool {
+			end := time.Now()
+			for _, envelope := range envelopes {
+				receive(string(envelope.GetLog().GetPayload()), end)
+			}
+
+			return ctx.Err() == nil
+		},
+		lcClient.Read,
+		client.WithWalkEnvelopeTypes(logcache_v1.EnvelopeType_LOG),
+		client.WithWalkLimit(1000),
+		client.WithWalkLogger(log.New(os.Stdout, "walk: ", 0)),
+		client.WithWalkBackoff(client.NewAlwaysRetryBackoff(100*time.Millisecond)),
+		client.WithWalkStartTime(time.Now().Add(-time.Second)),
+		client.WithWalkDelay(time.Nanosecond),
+	)
+}
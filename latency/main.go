@@ -1,93 +1,140 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/cloudfoundry/noaa/v2/consumer"
-	"github.com/cloudfoundry/sonde-go/events"
-	uuid "github.com/nu7hatch/gouuid"
+	"code.cloudfoundry.org/loggregator-tools/latency-common/uaa"
 )
 
 const (
 	defaultSampleSize   = 10
 	readAttempts        = 5
 	readAttemptDuration = time.Second
+	connectTimeout      = 30 * time.Second
 	messagePrefix       = "loggregator-latency-test-"
 )
 
 func main() {
 	log.SetOutput(os.Stdout)
 
-	addr, token, location, origin, err := input()
+	addr, paths, err := input()
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	lh := newLatencyHandler(paths)
+
 	mux := &http.ServeMux{}
 	mux.Handle("/", &healthHandler{})
-	mux.Handle("/latency", &latencyHandler{
-		location: location,
-		origin:   origin,
-		token:    token,
-	})
+	mux.Handle("GET /latency", lh)
+	mux.HandleFunc("POST /latency", lh.startRun)
+	mux.HandleFunc("GET /latency/{id}", lh.getRun)
+	if d, ok := paths["drain"].(*drainPath); ok {
+		mux.Handle("POST /drain", d)
+	}
+
+	m, err := monitorInput(lh.start)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if m != nil {
+		mux.Handle("GET /metrics", m)
+		go m.run()
+	}
 
 	server := &http.Server{
 		Addr:           addr,
 		Handler:        mux,
 		ReadTimeout:    5 * time.Second,
-		WriteTimeout:   10 * time.Second,
+		WriteTimeout:   2 * time.Minute,
 		MaxHeaderBytes: 1 << 20,
 	}
 	log.Print("listening on " + addr)
 	log.Fatal(server.ListenAndServe())
 }
 
-func input() (addr, token string, location, origin *url.URL, err error) {
-	targetURL := os.Getenv("TARGET_URL")
-	if targetURL == "" {
-		return "", "", nil, nil, errors.New("empty target url")
+// input builds the egress paths listed in EGRESS_PATHS. It defaults to the
+// v1 app stream.
+func input() (addr string, paths map[string]egressPath, err error) {
+	port := os.Getenv("PORT")
+	if port == "" {
+		return "", nil, errors.New("empty port")
 	}
+	addr = ":" + port
 
-	token = os.Getenv("TOKEN")
-	if token == "" {
-		return "", "", nil, nil, errors.New("empty token")
+	names := os.Getenv("EGRESS_PATHS")
+	if names == "" {
+		names = "stream"
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		return "", "", nil, nil, errors.New("empty port")
+	var tokens uaa.TokenSource
+	paths = make(map[string]egressPath)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name != "drain" && tokens == nil {
+			tokens, err = uaa.Input()
+			if err != nil {
+				return "", nil, err
+			}
+		}
+
+		switch name {
+		case "stream":
+			location, err := streamLocation()
+			if err != nil {
+				return "", nil, err
+			}
+			paths[name] = &streamPath{location: location, tokens: tokens}
+		case "log-cache":
+			logCacheURL := os.Getenv("LOG_CACHE_URL")
+			if logCacheURL == "" {
+				return "", nil, errors.New("empty log cache url")
+			}
+			paths[name] = &logCachePath{addr: logCacheURL, tokens: tokens}
+		case "rlp-gateway":
+			gatewayURL := os.Getenv("RLP_GATEWAY_URL")
+			if gatewayURL == "" {
+				return "", nil, errors.New("empty rlp gateway url")
+			}
+			paths[name] = &rlpGatewayPath{addr: gatewayURL, tokens: tokens}
+		case "drain":
+			paths[name] = newDrainPath()
+		default:
+			return "", nil, fmt.Errorf("unknown egress path %q", name)
+		}
 	}
-	addr = ":" + port
 
-	location, err = url.Parse(targetURL)
+	return addr, paths, nil
+}
+
+func streamLocation() (*url.URL, error) {
+	targetURL := os.Getenv("TARGET_URL")
+	if targetURL == "" {
+		return nil, errors.New("empty target url")
+	}
+
+	location, err := url.Parse(targetURL)
 	if err != nil {
-		return "", "", nil, nil, fmt.Errorf("invalid target url: %s", err)
+		return nil, fmt.Errorf("invalid target url: %s", err)
 	}
-	// This shallow copies location, which is enough to create an origin URL.
-	originLocal := *location
 
-	switch location.Scheme {
-	case "ws":
-		originLocal.Scheme = "http"
-	case "wss":
-		originLocal.Scheme = "https"
-	default:
-		return "", "", nil, nil, errors.New("target url requires a scheme of ws or wss")
+	if location.Scheme != "ws" && location.Scheme != "wss" {
+		return nil, errors.New("target url requires a scheme of ws or wss")
 	}
-	origin = &originLocal
 
-	return addr, token, location, origin, nil
+	return location, nil
 }
 
 func appID() (string, error) {
@@ -111,22 +158,96 @@ func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 type latencyHandler struct {
-	location *url.URL
-	origin   *url.URL
-	token    string
+	paths map[string]egressPath
+	runs  *runStore
+	// connectTimeout is how long a test waits for every egress path to be
+	// connected before it sends its messages anyway.
+	connectTimeout time.Duration
+	// idleTimeout is how long a test waits for the next message before the
+	// missing messages are considered lost.
+	idleTimeout time.Duration
+}
+
+func newLatencyHandler(paths map[string]egressPath) *latencyHandler {
+	return &latencyHandler{
+		paths:          paths,
+		runs:           newRunStore(),
+		connectTimeout: connectTimeout,
+		idleTimeout:    readAttempts * readAttemptDuration,
+	}
 }
 
+// ServeHTTP runs a test and responds with its report for each egress path
+// once it is finished.
 func (h *latencyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	sampleSize := sampleSize(r)
+	run := h.start(sampleSize(r))
+	<-run.done
+
+	writeReports(w, r, run.reports())
+}
 
-	avg, err := h.executeLatencyTest(sampleSize)
+// startRun starts a test in the background and responds with its ID. The
+// progress and the reports of the test are available via getRun.
+func (h *latencyHandler) startRun(w http.ResponseWriter, r *http.Request) {
+	run := h.start(sampleSize(r))
+
+	w.Header().Set("Location", "/latency/"+run.id)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	err := json.NewEncoder(w).Encode(run.status())
 	if err != nil {
-		log.Printf("sample failed: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Println("error writing response:", err)
+	}
+}
+
+// getRun responds with the progress of a test, and its reports once it is
+// finished. With format=prometheus, it only responds with the reports.
+func (h *latencyHandler) getRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := h.runs.get(r.PathValue("id"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "prometheus" {
+		if !run.finished() {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		writeReports(w, r, run.reports())
 		return
 	}
 
-	_, err = fmt.Fprintf(w, "%f\n", avg.Seconds())
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(run.status())
+	if err != nil {
+		log.Println("error writing response:", err)
+	}
+}
+
+func (h *latencyHandler) start(sampleQuantity int) *run {
+	run := newRun(sampleQuantity, slices.Collect(maps.Keys(h.paths)))
+	h.runs.add(run)
+
+	go func() {
+		h.executeLatencyTest(run)
+		run.finish()
+	}()
+
+	return run
+}
+
+func writeReports(w http.ResponseWriter, r *http.Request, reports map[string]latencyReport) {
+	var err error
+	switch r.URL.Query().Get("format") {
+	case "prometheus":
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		err = writePrometheus(w, reports)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(reports)
+	}
 	if err != nil {
 		log.Println("error writing response:", err)
 	}
@@ -144,111 +265,48 @@ func sampleSize(r *http.Request) int {
 	return sampleSize
 }
 
-func (h *latencyHandler) executeLatencyTest(sampleQuantity int) (time.Duration, error) {
-	sendTimes := make(map[string]time.Time)
-	results := make(map[string]time.Duration)
-
-	appID, _ := appID()
-	consumer := consumer.New(h.location.String(), &tls.Config{InsecureSkipVerify: true}, nil)
-	consumer.SetDebugPrinter(ConsoleDebugPrinter{})
-	msgChan, errorChan := consumer.Stream(appID, h.token)
-	defer consumer.Close() //nolint:errcheck
-
-	go func() {
-		for err := range errorChan {
-			if err == nil {
-				return
-			}
-			log.Println(err)
-		}
-	}()
+// executeLatencyTest streams the app's logs from every egress path, then
+// prints the messages of the run once the paths are connected. It returns
+// once every path received every message, or no message was received for
+// a while.
+func (h *latencyHandler) executeLatencyTest(run *run) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for name, p := range h.paths {
+		go p.stream(ctx, func(msg string, end time.Time) {
+			run.receive(name, msg, end)
+		})
+	}
 
+	timeout := time.After(h.connectTimeout)
 Loop:
-	for {
+	for !run.connected() {
 		select {
-		case envelope := <-msgChan:
-			if envelope.GetEventType() == events.Envelope_LogMessage {
-				message := string(envelope.GetLogMessage().GetMessage())
-
-				if message == "ENSURE CONNECTION" {
-					break Loop
-				}
-			}
+		case <-timeout:
+			log.Printf("Test %s could not connect to every egress path.", run.id)
+			break Loop
 		default:
-			fmt.Println("ENSURE CONNECTION")
+			fmt.Println(run.connectMessage())
 			time.Sleep(250 * time.Millisecond)
 		}
 	}
 
-	var mutex sync.RWMutex
-	go func() {
-		for i := 0; i < sampleQuantity; i++ {
-			sampleMessage := generateRandomMessage()
-			mutex.Lock()
-			sendTimes[sampleMessage] = time.Now()
-			fmt.Println(sampleMessage)
-			mutex.Unlock()
-			time.Sleep(1 * time.Millisecond)
-		}
-	}()
-
-	timer := time.NewTimer(readAttemptDuration)
-	for {
-		select {
-		case envelope := <-msgChan:
-			end := time.Now()
-
-			if envelope.GetEventType() == events.Envelope_LogMessage {
-				message := string(envelope.GetLogMessage().GetMessage())
-
-				if strings.Contains(message, messagePrefix) {
-					mutex.RLock()
-					start, ok := sendTimes[message]
-					mutex.RUnlock()
-
-					if ok {
-						results[message] = end.Sub(start)
-					}
-				}
-			}
-
-			if len(results) == sampleQuantity {
-				return computeAverages(results)
-			}
-
-			if !timer.Stop() {
-				<-timer.C
-			}
-			timer.Reset(readAttemptDuration)
-		case <-timer.C:
-			lost := sampleQuantity - len(results)
-			log.Printf("Test timeout expired with %d messages lost.", lost)
-			return computeAverages(results)
-		}
+	for i := 0; i < run.samples; i++ {
+		run.send(i)
+		time.Sleep(1 * time.Millisecond)
 	}
-}
 
-func computeAverages(results map[string]time.Duration) (time.Duration, error) {
-	if len(results) == 0 {
-		return 0, errors.New("no results")
-	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		if run.complete() {
+			return
+		}
 
-	var totalDuration time.Duration
-	for _, d := range results {
-		totalDuration += d
+		if time.Since(run.idleSince()) > h.idleTimeout {
+			log.Printf("Test %s timeout expired with messages lost: %v", run.id, run.lost())
+			return
+		}
 	}
-
-	return totalDuration / time.Duration(len(results)), nil
-}
-
-func generateRandomMessage() string {
-	id, _ := uuid.NewV4()
-	return fmt.Sprint(messagePrefix, id.String())
-}
-
-type ConsoleDebugPrinter struct{}
-
-func (c ConsoleDebugPrinter) Print(title, dump string) {
-	println(title)
-	println(dump)
 }
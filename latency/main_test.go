@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakePath is an egressPath that receives the messages the test delivers.
+type fakePath struct {
+	name string
+	msgs chan string
+}
+
+func newFakePath(name string) *fakePath {
+	return &fakePath{name: name, msgs: make(chan string, 100)}
+}
+
+func (p *fakePath) stream(ctx context.Context, receive func(string, time.Time)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-p.msgs:
+			receive(msg, time.Now())
+		}
+	}
+}
+
+// connect delivers the connect message of the run until the path is
+// connected.
+func (p *fakePath) connect(r *run) {
+	Eventually(func() bool {
+		p.msgs <- r.connectMessage()
+		return r.status().Paths[p.name].Connected
+	}, 5*time.Second, 50*time.Millisecond).Should(BeTrue())
+}
+
+// echo delivers the messages of the run once it sent all of them.
+func (p *fakePath) echo(r *run) {
+	Eventually(func() int { return r.status().Sent }, 5*time.Second).Should(Equal(r.samples))
+	for i := 0; i < r.samples; i++ {
+		p.msgs <- r.prefix + strconv.Itoa(i)
+	}
+}
+
+var _ = Describe("latencyHandler", func() {
+	var (
+		path *fakePath
+		h    *latencyHandler
+	)
+
+	BeforeEach(func() {
+		path = newFakePath("fake")
+		h = newLatencyHandler(map[string]egressPath{"fake": path})
+	})
+
+	getRun := func(id, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/latency/"+id+query, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		h.getRun(rec, req)
+		return rec
+	}
+
+	It("starts a test with POST and returns its reports with GET", func() {
+		rec := httptest.NewRecorder()
+		h.startRun(rec, httptest.NewRequest(http.MethodPost, "/latency?samples=3", nil))
+
+		Expect(rec.Code).To(Equal(http.StatusAccepted))
+		var started runStatus
+		Expect(json.Unmarshal(rec.Body.Bytes(), &started)).To(Succeed())
+		Expect(rec.Header().Get("Location")).To(Equal("/latency/" + started.ID))
+		Expect(started.State).To(Equal("running"))
+		Expect(started.Samples).To(Equal(3))
+
+		Expect(getRun(started.ID, "?format=prometheus").Code).To(Equal(http.StatusConflict))
+
+		r, ok := h.runs.get(started.ID)
+		Expect(ok).To(BeTrue())
+		path.connect(r)
+		path.echo(r)
+
+		var status runStatus
+		Eventually(func() string {
+			rec := getRun(started.ID, "")
+			Expect(rec.Code).To(Equal(http.StatusOK))
+			Expect(json.Unmarshal(rec.Body.Bytes(), &status)).To(Succeed())
+			return status.State
+		}, 5*time.Second).Should(Equal("finished"))
+
+		Expect(status.Sent).To(Equal(3))
+		Expect(status.Paths["fake"].Connected).To(BeTrue())
+		Expect(status.Paths["fake"].Received).To(Equal(3))
+		Expect(status.Paths["fake"].Report.Lost).To(BeZero())
+
+		rec = getRun(started.ID, "?format=prometheus")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring(`loggregator_latency_seconds_count{path="fake"} 3`))
+	})
+
+	It("returns 404 for unknown tests", func() {
+		Expect(getRun("unknown", "").Code).To(Equal(http.StatusNotFound))
+		Expect(getRun("unknown", "?format=prometheus").Code).To(Equal(http.StatusNotFound))
+	})
+})
+
+var _ = Describe("executeLatencyTest", func() {
+	var (
+		stream, drain *fakePath
+		h             *latencyHandler
+	)
+
+	BeforeEach(func() {
+		stream = newFakePath("stream")
+		drain = newFakePath("drain")
+		h = newLatencyHandler(map[string]egressPath{"stream": stream, "drain": drain})
+	})
+
+	execute := func(r *run) <-chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			h.executeLatencyTest(r)
+		}()
+		return done
+	}
+
+	It("sends the messages once every path is connected", func() {
+		r := newRun(2, []string{"stream", "drain"})
+		done := execute(r)
+
+		stream.connect(r)
+		Consistently(func() int { return r.status().Sent }, 500*time.Millisecond).Should(BeZero())
+
+		drain.connect(r)
+		stream.echo(r)
+		drain.echo(r)
+		Eventually(done, 5*time.Second).Should(BeClosed())
+
+		for _, l := range r.latencies() {
+			Expect(l.received).To(HaveLen(2))
+			Expect(l.lost).To(BeZero())
+		}
+	})
+
+	It("sends the messages when a path does not connect in time", func() {
+		h.connectTimeout = 100 * time.Millisecond
+		h.idleTimeout = 100 * time.Millisecond
+		r := newRun(2, []string{"stream", "drain"})
+		done := execute(r)
+
+		stream.connect(r)
+		Eventually(done, 5*time.Second).Should(BeClosed())
+
+		Expect(r.status().Sent).To(Equal(2))
+		Expect(r.status().Paths["drain"].Connected).To(BeFalse())
+	})
+
+	It("gives up once no message arrived for the idle timeout", func() {
+		h.idleTimeout = 300 * time.Millisecond
+		r := newRun(3, []string{"stream"})
+		h.paths = map[string]egressPath{"stream": stream}
+		done := execute(r)
+
+		stream.connect(r)
+		Eventually(func() int { return r.status().Sent }, 5*time.Second).Should(Equal(3))
+		stream.msgs <- r.prefix + "0"
+		Consistently(done, 200*time.Millisecond).ShouldNot(BeClosed())
+		Eventually(done, 5*time.Second).Should(BeClosed())
+
+		Expect(r.lost()).To(Equal(map[string]int{"stream": 2}))
+	})
+})
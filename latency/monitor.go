@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator/v10"
+	"code.cloudfoundry.org/loggregator-tools/latency-common/slo"
+)
+
+// monitor runs a small latency test every interval. It exports the
+// latencies of each egress path as Prometheus histograms, along with the
+// SLO burn of each path.
+type monitor struct {
+	slo.Config
+	start   func(samples int) *run
+	alerter alerter
+
+	mu    sync.Mutex
+	paths map[string]*slo.Window
+}
+
+// alerter is told about each egress path that breaches the SLO.
+type alerter interface {
+	alert(path string, burn float64)
+}
+
+// monitorInput builds a monitor if MONITOR_INTERVAL is set.
+func monitorInput(start func(samples int) *run) (*monitor, error) {
+	c, ok, err := slo.Input(defaultSampleSize)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	m := &monitor{
+		Config:  c,
+		start:   start,
+		alerter: logAlerter{},
+		paths:   make(map[string]*slo.Window),
+	}
+
+	ingress, err := slo.IngressInput()
+	if err != nil {
+		return nil, err
+	}
+	if ingress != nil {
+		m.alerter = &ingressAlerter{client: ingress}
+	}
+
+	return m, nil
+}
+
+// run samples the latency every interval. It never returns.
+func (m *monitor) run() {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		m.sample()
+		<-ticker.C
+	}
+}
+
+func (m *monitor) sample() {
+	run := m.start(m.Samples)
+	<-run.done
+
+	now := time.Now()
+	m.mu.Lock()
+	for path, l := range run.latencies() {
+		w, ok := m.paths[path]
+		if !ok {
+			w = slo.NewWindow()
+			m.paths[path] = w
+		}
+		w.Record(now, l.received, l.lost, m.Threshold)
+	}
+	burns := m.burns(now)
+	m.mu.Unlock()
+
+	for _, path := range slices.Sorted(maps.Keys(burns)) {
+		if m.Breached(burns[path]) {
+			m.alerter.alert(path, burns[path])
+		}
+	}
+}
+
+// burns returns the SLO burn of each egress path. It must be called with
+// the mu held.
+func (m *monitor) burns(now time.Time) map[string]float64 {
+	burns := make(map[string]float64, len(m.paths))
+	for path, w := range m.paths {
+		if burn, ok := w.Burn(now.Add(-m.Window)); ok {
+			burns[path] = burn
+		}
+	}
+
+	return burns
+}
+
+// ServeHTTP exports the monitored latencies in the Prometheus text
+// exposition format.
+func (m *monitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	burns := m.burns(time.Now())
+	paths := slices.Sorted(maps.Keys(m.paths))
+
+	var b strings.Builder
+	b.WriteString("# TYPE loggregator_latency_monitor_seconds histogram\n")
+	for _, p := range paths {
+		m.paths[p].WriteHistogram(&b, "loggregator_latency_monitor_seconds", fmt.Sprintf("path=%q", p))
+	}
+
+	b.WriteString("# TYPE loggregator_latency_monitor_lost_total counter\n")
+	for _, p := range paths {
+		fmt.Fprintf(&b, "loggregator_latency_monitor_lost_total{path=%q} %d\n", p, m.paths[p].Lost)
+	}
+
+	b.WriteString("# TYPE loggregator_latency_slo_burn gauge\n")
+	for _, p := range paths {
+		fmt.Fprintf(&b, "loggregator_latency_slo_burn{path=%q} %g\n", p, burns[p])
+	}
+
+	fmt.Fprintf(&b, `# TYPE loggregator_latency_slo_threshold_seconds gauge
+loggregator_latency_slo_threshold_seconds %g
+# TYPE loggregator_latency_slo_target gauge
+loggregator_latency_slo_target %g
+`,
+		m.Threshold.Seconds(), m.Target,
+	)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, err := w.Write([]byte(b.String()))
+	if err != nil {
+		log.Println("error writing response:", err)
+	}
+}
+
+// logAlerter only logs SLO breaches.
+type logAlerter struct{}
+
+func (logAlerter) alert(path string, burn float64) {
+	log.Printf("latency SLO breached on %s: %.2f%% of the logs were slow or lost", path, 100*burn)
+}
+
+// ingressAlerter emits a latency_slo_breach counter envelope to the
+// Loggregator agent for each SLO breach. The envelope has the app as its
+// source and the egress path as a tag.
+type ingressAlerter struct {
+	client *loggregator.IngressClient
+}
+
+func (a *ingressAlerter) alert(path string, burn float64) {
+	logAlerter{}.alert(path, burn)
+
+	appID, _ := appID()
+	a.client.EmitCounter("latency_slo_breach",
+		loggregator.WithDelta(1),
+		loggregator.WithCounterSourceInfo(appID, os.Getenv("CF_INSTANCE_INDEX")),
+		loggregator.WithEnvelopeTag("path", path),
+	)
+}
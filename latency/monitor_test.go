@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-tools/latency-common/slo"
+)
+
+// fakeAlerter records the SLO breaches it is told about.
+type fakeAlerter struct {
+	mu     sync.Mutex
+	alerts map[string]float64
+}
+
+func (a *fakeAlerter) alert(path string, burn float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.alerts[path] = burn
+}
+
+// finishedRun builds a finished run whose first messages took the given
+// latencies on the stream path. Its other messages were lost.
+func finishedRun(samples int, latencies ...time.Duration) *run {
+	r := newRun(samples, []string{"stream"})
+	for i, d := range latencies {
+		r.send(i)
+		msg := r.prefix + strconv.Itoa(i)
+		r.receive("stream", msg, r.sendTimes[msg].Add(d))
+	}
+	r.finish()
+
+	return r
+}
+
+var _ = Describe("monitor", func() {
+	var (
+		runs    chan *run
+		alerter *fakeAlerter
+		m       *monitor
+	)
+
+	BeforeEach(func() {
+		runs = make(chan *run, 10)
+		alerter = &fakeAlerter{alerts: make(map[string]float64)}
+		m = &monitor{
+			Config: slo.Config{
+				Window:    time.Hour,
+				Samples:   4,
+				Threshold: time.Second,
+				Target:    0.75,
+			},
+			start: func(samples int) *run {
+				Expect(samples).To(Equal(4))
+				return <-runs
+			},
+			alerter: alerter,
+			paths:   make(map[string]*slo.Window),
+		}
+	})
+
+	It("computes the burn from the slow and lost messages in the window", func() {
+		runs <- finishedRun(4, time.Millisecond, 2*time.Second, time.Millisecond)
+		m.sample()
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		Expect(m.burns(time.Now())).To(Equal(map[string]float64{"stream": 0.5}))
+		Expect(m.burns(time.Now().Add(2 * time.Hour))).To(BeEmpty())
+	})
+
+	It("alerts while the burn exceeds the error budget", func() {
+		runs <- finishedRun(4, time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond)
+		m.sample()
+		Expect(alerter.alerts).To(BeEmpty())
+
+		runs <- finishedRun(4, time.Millisecond, 2*time.Second)
+		m.sample()
+		Expect(alerter.alerts).To(HaveKeyWithValue("stream", 0.375))
+	})
+
+	It("does not alert at exactly the error budget", func() {
+		runs <- finishedRun(4, time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond)
+		m.sample()
+		runs <- finishedRun(4, time.Millisecond, time.Millisecond)
+		m.sample()
+
+		Expect(alerter.alerts).To(BeEmpty())
+	})
+
+	It("exports the latencies and the burn on /metrics", func() {
+		runs <- finishedRun(4, 5*time.Millisecond, 2*time.Second, time.Millisecond)
+		m.sample()
+
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		Expect(rec.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4"))
+		Expect(strings.Split(rec.Body.String(), "\n")).To(ContainElements(
+			"# TYPE loggregator_latency_monitor_seconds histogram",
+			`loggregator_latency_monitor_seconds_bucket{path="stream",le="0.005"} 2`,
+			`loggregator_latency_monitor_seconds_bucket{path="stream",le="2.5"} 3`,
+			`loggregator_latency_monitor_seconds_bucket{path="stream",le="+Inf"} 3`,
+			`loggregator_latency_monitor_seconds_sum{path="stream"} 2.006`,
+			`loggregator_latency_monitor_seconds_count{path="stream"} 3`,
+			`loggregator_latency_monitor_lost_total{path="stream"} 1`,
+			`loggregator_latency_slo_burn{path="stream"} 0.5`,
+			"loggregator_latency_slo_threshold_seconds 1",
+			"loggregator_latency_slo_target 0.75",
+		))
+	})
+})
+
+var _ = Describe("monitorInput", func() {
+	AfterEach(func() {
+		Expect(os.Unsetenv("MONITOR_INTERVAL")).To(Succeed())
+	})
+
+	It("is disabled without an interval", func() {
+		m, err := monitorInput(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m).To(BeNil())
+	})
+
+	It("samples at the interval with the default sample size", func() {
+		Expect(os.Setenv("MONITOR_INTERVAL", "30s")).To(Succeed())
+
+		m, err := monitorInput(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.Interval).To(Equal(30 * time.Second))
+		Expect(m.Samples).To(Equal(defaultSampleSize))
+		Expect(m.alerter).To(Equal(logAlerter{}))
+	})
+})
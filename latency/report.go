@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-tools/latency-common/slo"
+)
+
+// latencyReport summarizes the latencies of a test. The latencies are -1
+// when no messages were received.
+type latencyReport struct {
+	Samples    int               `json:"samples"`
+	Received   int               `json:"received"`
+	Lost       int               `json:"lost"`
+	AvgSeconds float64           `json:"avg_seconds"`
+	P50Seconds float64           `json:"p50_seconds"`
+	P90Seconds float64           `json:"p90_seconds"`
+	P99Seconds float64           `json:"p99_seconds"`
+	MaxSeconds float64           `json:"max_seconds"`
+	Histogram  []histogramBucket `json:"histogram"`
+
+	sum time.Duration
+}
+
+// histogramBucket counts the received messages with a latency of at most
+// LESeconds. Like Prometheus histograms, the counts are cumulative. The
+// messages above the last bound only count towards Received.
+type histogramBucket struct {
+	LESeconds float64 `json:"le_seconds"`
+	Count     int     `json:"count"`
+}
+
+func computeReport(results map[string]time.Duration, sampleQuantity int) latencyReport {
+	r := latencyReport{
+		Samples:    sampleQuantity,
+		Received:   len(results),
+		Lost:       sampleQuantity - len(results),
+		AvgSeconds: -1,
+		P50Seconds: -1,
+		P90Seconds: -1,
+		P99Seconds: -1,
+		MaxSeconds: -1,
+		Histogram:  make([]histogramBucket, len(slo.HistogramBounds)),
+	}
+
+	latencies := make([]time.Duration, 0, len(results))
+	for _, d := range results {
+		latencies = append(latencies, d)
+		r.sum += d
+	}
+	slices.Sort(latencies)
+
+	for i, bound := range slo.HistogramBounds {
+		n, _ := slices.BinarySearch(latencies, bound+1)
+		r.Histogram[i] = histogramBucket{
+			LESeconds: bound.Seconds(),
+			Count:     n,
+		}
+	}
+
+	if len(latencies) == 0 {
+		return r
+	}
+
+	r.AvgSeconds = (r.sum / time.Duration(len(latencies))).Seconds()
+	r.P50Seconds = percentile(latencies, 50).Seconds()
+	r.P90Seconds = percentile(latencies, 90).Seconds()
+	r.P99Seconds = percentile(latencies, 99).Seconds()
+	r.MaxSeconds = latencies[len(latencies)-1].Seconds()
+
+	return r
+}
+
+// percentile returns the nearest-rank percentile of the sorted latencies.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// writePrometheus writes the reports of the egress paths in the Prometheus
+// text exposition format. The path is set as a label.
+func writePrometheus(w io.Writer, reports map[string]latencyReport) error {
+	paths := slices.Sorted(maps.Keys(reports))
+
+	var b strings.Builder
+	b.WriteString("# TYPE loggregator_latency_samples gauge\n")
+	for _, p := range paths {
+		fmt.Fprintf(&b, "loggregator_latency_samples{path=%q} %d\n", p, reports[p].Samples)
+	}
+
+	b.WriteString("# TYPE loggregator_latency_lost_count gauge\n")
+	for _, p := range paths {
+		fmt.Fprintf(&b, "loggregator_latency_lost_count{path=%q} %d\n", p, reports[p].Lost)
+	}
+
+	b.WriteString("# TYPE loggregator_latency_quantile_seconds gauge\n")
+	for _, p := range paths {
+		r := reports[p]
+		quantiles := []struct {
+			q string
+			v float64
+		}{
+			{"0.5", r.P50Seconds},
+			{"0.9", r.P90Seconds},
+			{"0.99", r.P99Seconds},
+			{"1", r.MaxSeconds},
+		}
+		for _, q := range quantiles {
+			v := q.v
+			if r.Received == 0 {
+				v = math.NaN()
+			}
+			fmt.Fprintf(&b, "loggregator_latency_quantile_seconds{path=%q,quantile=%q} %g\n", p, q.q, v)
+		}
+	}
+
+	b.WriteString("# TYPE loggregator_latency_seconds histogram\n")
+	for _, p := range paths {
+		r := reports[p]
+		for _, bucket := range r.Histogram {
+			fmt.Fprintf(&b, "loggregator_latency_seconds_bucket{path=%q,le=%q} %d\n",
+				p, strconv.FormatFloat(bucket.LESeconds, 'g', -1, 64), bucket.Count)
+		}
+		fmt.Fprintf(&b, "loggregator_latency_seconds_bucket{path=%q,le=\"+Inf\"} %d\n", p, r.Received)
+		fmt.Fprintf(&b, "loggregator_latency_seconds_sum{path=%q} %g\n", p, r.sum.Seconds())
+		fmt.Fprintf(&b, "loggregator_latency_seconds_count{path=%q} %d\n", p, r.Received)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
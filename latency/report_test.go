@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-tools/latency-common/slo"
+)
+
+var _ = Describe("computeReport", func() {
+	// latencies builds results with latencies of 1ms up to n ms.
+	latencies := func(n int) map[string]time.Duration {
+		results := make(map[string]time.Duration, n)
+		for i := 1; i <= n; i++ {
+			results[fmt.Sprint(i)] = time.Duration(i) * time.Millisecond
+		}
+		return results
+	}
+
+	It("reports the nearest-rank percentiles", func() {
+		r := computeReport(latencies(200), 200)
+
+		Expect(r.Samples).To(Equal(200))
+		Expect(r.Received).To(Equal(200))
+		Expect(r.Lost).To(BeZero())
+		Expect(r.P50Seconds).To(Equal(0.1))
+		Expect(r.P90Seconds).To(Equal(0.18))
+		Expect(r.P99Seconds).To(Equal(0.198))
+		Expect(r.MaxSeconds).To(Equal(0.2))
+		Expect(r.AvgSeconds).To(BeNumerically("~", 0.1005, 1e-9))
+	})
+
+	It("rounds the rank up for small samples", func() {
+		r := computeReport(latencies(3), 3)
+
+		Expect(r.P50Seconds).To(Equal(0.002))
+		Expect(r.P90Seconds).To(Equal(0.003))
+		Expect(r.P99Seconds).To(Equal(0.003))
+	})
+
+	It("counts the latencies in cumulative buckets", func() {
+		r := computeReport(map[string]time.Duration{
+			"a": 5 * time.Millisecond,
+			"b": 6 * time.Millisecond,
+			"c": 300 * time.Millisecond,
+			"d": time.Minute,
+		}, 4)
+
+		Expect(r.Histogram).To(HaveLen(len(slo.HistogramBounds)))
+		Expect(r.Histogram[0]).To(Equal(histogramBucket{LESeconds: 0.005, Count: 1}))
+		Expect(r.Histogram[1]).To(Equal(histogramBucket{LESeconds: 0.01, Count: 2}))
+		Expect(r.Histogram[5]).To(Equal(histogramBucket{LESeconds: 0.25, Count: 2}))
+		Expect(r.Histogram[6]).To(Equal(histogramBucket{LESeconds: 0.5, Count: 3}))
+		Expect(r.Histogram[len(r.Histogram)-1].Count).To(Equal(3))
+	})
+
+	It("counts the messages that were not received as lost", func() {
+		r := computeReport(latencies(7), 10)
+
+		Expect(r.Received).To(Equal(7))
+		Expect(r.Lost).To(Equal(3))
+	})
+
+	It("reports -1 latencies when no messages were received", func() {
+		r := computeReport(nil, 10)
+
+		Expect(r.Lost).To(Equal(10))
+		Expect(r.AvgSeconds).To(Equal(-1.0))
+		Expect(r.P50Seconds).To(Equal(-1.0))
+		Expect(r.P90Seconds).To(Equal(-1.0))
+		Expect(r.P99Seconds).To(Equal(-1.0))
+		Expect(r.MaxSeconds).To(Equal(-1.0))
+		for _, bucket := range r.Histogram {
+			Expect(bucket.Count).To(BeZero())
+		}
+	})
+})
+
+var _ = Describe("writePrometheus", func() {
+	It("writes the reports of each path with the path as a label", func() {
+		var b strings.Builder
+		err := writePrometheus(&b, map[string]latencyReport{
+			"stream": computeReport(map[string]time.Duration{
+				"a": 5 * time.Millisecond,
+				"b": 300 * time.Millisecond,
+			}, 3),
+			"drain": computeReport(nil, 3),
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+		Expect(lines).To(ContainElements(
+			"# TYPE loggregator_latency_samples gauge",
+			`loggregator_latency_samples{path="drain"} 3`,
+			`loggregator_latency_samples{path="stream"} 3`,
+			"# TYPE loggregator_latency_lost_count gauge",
+			`loggregator_latency_lost_count{path="drain"} 3`,
+			`loggregator_latency_lost_count{path="stream"} 1`,
+			"# TYPE loggregator_latency_quantile_seconds gauge",
+			`loggregator_latency_quantile_seconds{path="stream",quantile="0.5"} 0.005`,
+			`loggregator_latency_quantile_seconds{path="stream",quantile="1"} 0.3`,
+			`loggregator_latency_quantile_seconds{path="drain",quantile="0.5"} NaN`,
+			"# TYPE loggregator_latency_seconds histogram",
+			`loggregator_latency_seconds_bucket{path="stream",le="0.005"} 1`,
+			`loggregator_latency_seconds_bucket{path="stream",le="0.25"} 1`,
+			`loggregator_latency_seconds_bucket{path="stream",le="0.5"} 2`,
+			`loggregator_latency_seconds_bucket{path="stream",le="+Inf"} 2`,
+			`loggregator_latency_seconds_sum{path="stream"} 0.305`,
+			`loggregator_latency_seconds_count{path="stream"} 2`,
+			`loggregator_latency_seconds_bucket{path="drain",le="+Inf"} 0`,
+			`loggregator_latency_seconds_count{path="drain"} 0`,
+		))
+		Expect(strings.Index(b.String(), `path="drain"`)).
+			To(BeNumerically("<", strings.Index(b.String(), `path="stream"`)))
+	})
+})
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	loggregator "code.cloudfoundry.org/go-loggregator/v10"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"code.cloudfoundry.org/loggregator-tools/latency-common/uaa"
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// rlpGatewayPath receives the app's logs from the v2 RLP gateway.
+type rlpGatewayPath struct {
+	addr   string
+	tokens uaa.TokenSource
+}
+
+func (p *rlpGatewayPath) stream(ctx context.Context, receive func(string, time.Time)) {
+	appID, _ := appID()
+	rlpClient := loggregator.NewRLPGatewayClient(p.addr,
+		loggregator.WithRLPGatewayHTTPClient(&httpClient{
+			tokens: p.tokens,
+		}),
+		loggregator.WithRLPGatewayClientLogger(log.New(os.Stdout, "rlp gateway: ", 0)),
+	)
+
+	stream := rlpClient.Stream(ctx, egressRequest(appID))
+
+	for {
+		batch := stream()
+		if batch == nil {
+			return
+		}
+
+		end := time.Now()
+		for _, envelope := range batch {
+			receive(string(envelope.GetLog().GetPayload()), end)
+		}
+	}
+}
+
+// egressRequest selects the logs of the app. Each request uses a shard of
+// its own: streams of the same shard split the envelopes between them, so
+// concurrent runs would otherwise each miss some of their messages.
+func egressRequest(appID string) *loggregator_v2.EgressBatchRequest {
+	id, _ := uuid.NewV4()
+
+	return &loggregator_v2.EgressBatchRequest{
+		ShardId: messagePrefix + id.String(),
+		Selectors: []*loggregator_v2.Selector{
+			{
+				SourceId: appID,
+				Message:  &loggregator_v2.Selector_Log{Log: &loggregator_v2.LogSelector{}},
+			},
+		},
+	}
+}
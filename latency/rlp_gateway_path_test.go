@@ -0,0 +1,24 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("egressRequest", func() {
+	It("selects the logs of the app", func() {
+		req := egressRequest("some-app")
+
+		Expect(req.GetSelectors()).To(HaveLen(1))
+		Expect(req.GetSelectors()[0].GetSourceId()).To(Equal("some-app"))
+		Expect(req.GetSelectors()[0].GetLog()).ToNot(BeNil())
+	})
+
+	It("uses a shard of its own for each stream", func() {
+		a := egressRequest("some-app")
+		b := egressRequest("some-app")
+
+		Expect(a.GetShardId()).To(HavePrefix(messagePrefix))
+		Expect(a.GetShardId()).ToNot(Equal(b.GetShardId()))
+	})
+})
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+// maxRuns is how many runs are kept for GET /latency/{id}. The oldest
+// finished runs are removed first.
+const maxRuns = 100
+
+// run is a single latency test. The same messages are timed on each egress
+// path. The messages of a run start with a prefix unique to the run, so
+// concurrent runs do not see each other's messages.
+type run struct {
+	id        string
+	prefix    string
+	samples   int
+	startTime time.Time
+	done      chan struct{}
+
+	mu           sync.Mutex
+	sendTimes    map[string]time.Time
+	lastActivity time.Time
+	paths        map[string]*pathResults
+}
+
+type pathResults struct {
+	connected bool
+	results   map[string]time.Duration
+	report    latencyReport
+}
+
+// runStatus is the JSON representation of a run.
+type runStatus struct {
+	ID        string                `json:"id"`
+	State     string                `json:"state"`
+	Samples   int                   `json:"samples"`
+	Sent      int                   `json:"sent"`
+	StartTime time.Time             `json:"start_time"`
+	Paths     map[string]pathStatus `json:"paths"`
+}
+
+// pathStatus is the progress of a run on one egress path. The report is
+// only set once the run is finished.
+type pathStatus struct {
+	Connected bool           `json:"connected"`
+	Received  int            `json:"received"`
+	Report    *latencyReport `json:"report,omitempty"`
+}
+
+func newRun(samples int, paths []string) *run {
+	id, _ := uuid.NewV4()
+
+	r := &run{
+		id:        id.String(),
+		prefix:    fmt.Sprint(messagePrefix, id.String(), "-"),
+		samples:   samples,
+		startTime: time.Now(),
+		done:      make(chan struct{}),
+		sendTimes: make(map[string]time.Time),
+		paths:     make(map[string]*pathResults),
+	}
+	for _, p := range paths {
+		r.paths[p] = &pathResults{
+			results: make(map[string]time.Duration),
+		}
+	}
+
+	return r
+}
+
+// connectMessage is printed until every egress path has received it, so
+// no samples are sent before the paths are connected.
+func (r *run) connectMessage() string {
+	return r.prefix + "connect"
+}
+
+// send prints the i-th message of the run and records when it was sent.
+func (r *run) send(i int) {
+	msg := r.prefix + strconv.Itoa(i)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sendTimes[msg] = time.Now()
+	r.lastActivity = r.sendTimes[msg]
+	fmt.Println(msg)
+}
+
+// receive records the latency of the message on the given egress path if
+// it was sent by the run.
+func (r *run) receive(path, msg string, end time.Time) {
+	msg = strings.TrimSpace(msg)
+	if !strings.HasPrefix(msg, r.prefix) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.paths[path]
+	if msg == r.connectMessage() {
+		p.connected = true
+		return
+	}
+
+	start, ok := r.sendTimes[msg]
+	if _, alreadyReceived := p.results[msg]; ok && !alreadyReceived {
+		p.results[msg] = end.Sub(start)
+		r.lastActivity = end
+	}
+}
+
+// connected returns whether every egress path has received the connect
+// message.
+func (r *run) connected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.paths {
+		if !p.connected {
+			return false
+		}
+	}
+
+	return true
+}
+
+// complete returns whether every egress path has received every message.
+func (r *run) complete() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.paths {
+		if len(p.results) != r.samples {
+			return false
+		}
+	}
+
+	return true
+}
+
+// idleSince returns when the run last sent a message or received one on
+// any egress path.
+func (r *run) idleSince() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.lastActivity
+}
+
+// pathLatencies are the latencies of the messages received on an egress
+// path, and how many messages were lost on it.
+type pathLatencies struct {
+	received []time.Duration
+	lost     int
+}
+
+// latencies returns the latencies of each egress path.
+func (r *run) latencies() map[string]pathLatencies {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	latencies := make(map[string]pathLatencies, len(r.paths))
+	for name, p := range r.paths {
+		latencies[name] = pathLatencies{
+			received: slices.Collect(maps.Values(p.results)),
+			lost:     r.samples - len(p.results),
+		}
+	}
+
+	return latencies
+}
+
+func (r *run) lost() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lost := make(map[string]int, len(r.paths))
+	for name, p := range r.paths {
+		lost[name] = r.samples - len(p.results)
+	}
+
+	return lost
+}
+
+// finish computes the reports of the run and marks it as done.
+func (r *run) finish() {
+	r.mu.Lock()
+	for _, p := range r.paths {
+		p.report = computeReport(p.results, r.samples)
+	}
+	r.mu.Unlock()
+
+	close(r.done)
+}
+
+func (r *run) finished() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// reports returns the report of each egress path. It must only be called
+// once the run is finished.
+func (r *run) reports() map[string]latencyReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reports := make(map[string]latencyReport, len(r.paths))
+	for name, p := range r.paths {
+		reports[name] = p.report
+	}
+
+	return reports
+}
+
+func (r *run) status() runStatus {
+	finished := r.finished()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := runStatus{
+		ID:        r.id,
+		State:     "running",
+		Samples:   r.samples,
+		Sent:      len(r.sendTimes),
+		StartTime: r.startTime,
+		Paths:     make(map[string]pathStatus, len(r.paths)),
+	}
+	if finished {
+		s.State = "finished"
+	}
+
+	for name, p := range r.paths {
+		ps := pathStatus{
+			Connected: p.connected,
+			Received:  len(p.results),
+		}
+		if finished {
+			report := p.report
+			ps.Report = &report
+		}
+		s.Paths[name] = ps
+	}
+
+	return s
+}
+
+// runStore keeps the most recent runs by ID.
+type runStore struct {
+	mu    sync.Mutex
+	runs  map[string]*run
+	order []string
+}
+
+func newRunStore() *runStore {
+	return &runStore{
+		runs: make(map[string]*run),
+	}
+}
+
+func (s *runStore) add(r *run) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runs[r.id] = r
+	s.order = append(s.order, r.id)
+
+	for i := 0; len(s.order) > maxRuns && i < len(s.order); {
+		id := s.order[i]
+		if !s.runs[id].finished() {
+			i++
+			continue
+		}
+
+		delete(s.runs, id)
+		s.order = slices.Delete(s.order, i, i+1)
+	}
+}
+
+func (s *runStore) get(id string) (*run, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.runs[id]
+	return r, ok
+}
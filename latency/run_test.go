@@ -0,0 +1,111 @@
+package main
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("run", func() {
+	It("records the latency of its messages on each path", func() {
+		r := newRun(2, []string{"stream", "drain"})
+		r.send(0)
+		sent := r.sendTimes[r.prefix+"0"]
+
+		r.receive("stream", r.prefix+"0\n", sent.Add(time.Second))
+		r.receive("stream", r.prefix+"0", sent.Add(time.Minute))
+
+		latencies := r.latencies()
+		Expect(latencies["stream"].received).To(Equal([]time.Duration{time.Second}))
+		Expect(latencies["stream"].lost).To(Equal(1))
+		Expect(latencies["drain"].received).To(BeEmpty())
+		Expect(latencies["drain"].lost).To(Equal(2))
+	})
+
+	It("ignores the messages of other runs", func() {
+		r := newRun(1, []string{"stream"})
+		other := newRun(1, []string{"stream"})
+		r.send(0)
+		other.send(0)
+
+		r.receive("stream", other.prefix+"0", time.Now())
+		r.receive("stream", other.connectMessage(), time.Now())
+		r.receive("stream", "loggregator-latency-test-0", time.Now())
+
+		Expect(r.latencies()["stream"].received).To(BeEmpty())
+		Expect(r.connected()).To(BeFalse())
+	})
+
+	It("is connected once every path received the connect message", func() {
+		r := newRun(1, []string{"stream", "drain"})
+
+		r.receive("stream", r.connectMessage(), time.Now())
+		Expect(r.connected()).To(BeFalse())
+
+		r.receive("drain", r.connectMessage(), time.Now())
+		Expect(r.connected()).To(BeTrue())
+	})
+
+	It("is complete once every path received every message", func() {
+		r := newRun(1, []string{"stream", "drain"})
+		r.send(0)
+
+		r.receive("stream", r.prefix+"0", time.Now())
+		Expect(r.complete()).To(BeFalse())
+
+		r.receive("drain", r.prefix+"0", time.Now())
+		Expect(r.complete()).To(BeTrue())
+	})
+
+	It("reports each path once it is finished", func() {
+		r := newRun(2, []string{"stream"})
+		r.send(0)
+		r.receive("stream", r.prefix+"0", time.Now())
+		Expect(r.status().State).To(Equal("running"))
+		Expect(r.status().Paths["stream"].Report).To(BeNil())
+
+		r.finish()
+
+		s := r.status()
+		Expect(s.State).To(Equal("finished"))
+		Expect(s.Sent).To(Equal(1))
+		Expect(s.Paths["stream"].Received).To(Equal(1))
+		Expect(s.Paths["stream"].Report.Lost).To(Equal(1))
+		Expect(r.reports()["stream"].Received).To(Equal(1))
+	})
+})
+
+var _ = Describe("runStore", func() {
+	finished := func() *run {
+		r := newRun(1, []string{"stream"})
+		r.finish()
+		return r
+	}
+
+	It("removes the oldest finished runs beyond maxRuns", func() {
+		s := newRunStore()
+		running := newRun(1, []string{"stream"})
+		s.add(running)
+		oldest := finished()
+		s.add(oldest)
+		for i := 0; i < maxRuns-1; i++ {
+			s.add(finished())
+		}
+
+		Expect(s.order).To(HaveLen(maxRuns))
+		_, ok := s.get(oldest.id)
+		Expect(ok).To(BeFalse())
+		_, ok = s.get(running.id)
+		Expect(ok).To(BeTrue())
+	})
+
+	It("keeps runs that are not finished", func() {
+		s := newRunStore()
+		for i := 0; i < maxRuns+1; i++ {
+			s.add(newRun(1, []string{"stream"}))
+		}
+
+		Expect(s.order).To(HaveLen(maxRuns + 1))
+	})
+})
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WorkerTokenMaxAge is how far the time a worker token was signed at may be
+// from the time it is verified at.
+const WorkerTokenMaxAge = 5 * time.Minute
+
+// SignWorkerToken builds a token that proves the worker with the given ID
+// knows the secret shared with the control server, without sending the
+// secret. The token holds the worker ID and the time it was signed at.
+func SignWorkerToken(secret, workerID string, now time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(workerID)) +
+		"." + strconv.FormatInt(now.Unix(), 10)
+
+	return payload + "." + sign(secret, payload)
+}
+
+// VerifyWorkerToken checks that the token was signed with the secret within
+// WorkerTokenMaxAge of now. It returns the ID of the worker that signed it.
+func VerifyWorkerToken(secret, token string, now time.Time) (string, error) {
+	i := strings.LastIndex(token, ".")
+	if i < 0 {
+		return "", errors.New("malformed token")
+	}
+	payload, sig := token[:i], token[i+1:]
+
+	if !hmac.Equal([]byte(sig), []byte(sign(secret, payload))) {
+		return "", errors.New("invalid signature")
+	}
+
+	encodedID, ts, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", errors.New("malformed token")
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", errors.New("malformed token")
+	}
+
+	age := now.Sub(time.Unix(unix, 0))
+	if age > WorkerTokenMaxAge || age < -WorkerTokenMaxAge {
+		return "", errors.New("token expired")
+	}
+
+	id, err := base64.RawURLEncoding.DecodeString(encodedID)
+	if err != nil {
+		return "", errors.New("malformed token")
+	}
+
+	return string(id), nil
+}
+
+func sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload)) //nolint:errcheck
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
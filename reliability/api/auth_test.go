@@ -0,0 +1,51 @@
+package api_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-tools/reliability/api"
+)
+
+var _ = Describe("WorkerToken", func() {
+	now := time.Unix(1700000000, 0)
+
+	It("returns the worker ID of a valid token", func() {
+		token := api.SignWorkerToken("secret", "host.example.com/3", now)
+
+		id, err := api.VerifyWorkerToken("secret", token, now.Add(time.Minute))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(id).To(Equal("host.example.com/3"))
+	})
+
+	It("rejects a token signed with another secret", func() {
+		token := api.SignWorkerToken("other", "worker", now)
+
+		_, err := api.VerifyWorkerToken("secret", token, now)
+		Expect(err).To(MatchError("invalid signature"))
+	})
+
+	It("rejects an expired token", func() {
+		token := api.SignWorkerToken("secret", "worker", now)
+
+		_, err := api.VerifyWorkerToken("secret", token, now.Add(api.WorkerTokenMaxAge+time.Second))
+		Expect(err).To(MatchError("token expired"))
+	})
+
+	It("rejects a token with a changed worker ID", func() {
+		token := api.SignWorkerToken("secret", "worker", now)
+		forged := api.SignWorkerToken("secret", "other", now)
+
+		// Keep the signature of the original token.
+		sig := token[len(token)-43:]
+		_, err := api.VerifyWorkerToken("secret", forged[:len(forged)-43]+sig, now)
+		Expect(err).To(MatchError("invalid signature"))
+	})
+
+	It("rejects a malformed token", func() {
+		_, err := api.VerifyWorkerToken("secret", "garbage", now)
+		Expect(err).To(HaveOccurred())
+	})
+})
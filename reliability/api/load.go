@@ -0,0 +1,124 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// ConstantLoad writes logs at a constant Rate.
+	ConstantLoad = "constant"
+	// RampLoad changes the rate linearly from Rate to EndRate over
+	// RampDuration and then keeps writing at EndRate.
+	RampLoad = "ramp"
+	// BurstLoad writes BurstSize logs at once every BurstInterval, starting
+	// with a burst. Between the bursts logs are written at Rate.
+	BurstLoad = "burst"
+)
+
+// LoadProfile describes how fast a worker writes its logs. The rates are in
+// logs per second for each worker.
+type LoadProfile struct {
+	Type          string        `json:"type"`
+	Rate          float64       `json:"rate"`
+	EndRate       float64       `json:"end_rate,omitempty"`
+	RampDuration  Duration      `json:"ramp_duration,omitempty"`
+	BurstSize     uint64        `json:"burst_size,omitempty"`
+	BurstInterval Duration      `json:"burst_interval,omitempty"`
+	Sizes         []MessageSize `json:"sizes,omitempty"`
+}
+
+// MessageSize is the size in bytes of a share of the logs. Each log picks
+// a size with a probability proportional to its Weight. Logs are never
+// smaller than the test log line itself.
+type MessageSize struct {
+	Bytes  int `json:"bytes"`
+	Weight int `json:"weight"`
+}
+
+// Validate returns an error if the profile can not be run.
+func (l *LoadProfile) Validate() error {
+	switch l.Type {
+	case ConstantLoad:
+		if l.Rate <= 0 {
+			return errors.New("constant load requires a rate")
+		}
+	case RampLoad:
+		if l.Rate < 0 || l.EndRate <= 0 {
+			return errors.New("ramp load requires a positive end rate")
+		}
+		if l.RampDuration <= 0 {
+			return errors.New("ramp load requires a ramp duration")
+		}
+	case BurstLoad:
+		if l.Rate < 0 {
+			return errors.New("burst load requires a non-negative rate")
+		}
+		if l.BurstSize == 0 || l.BurstInterval <= 0 {
+			return errors.New("burst load requires a burst size and interval")
+		}
+	default:
+		return fmt.Errorf("unknown load type %q", l.Type)
+	}
+
+	for _, s := range l.Sizes {
+		if s.Bytes <= 0 || s.Weight <= 0 {
+			return errors.New("message sizes require positive bytes and weights")
+		}
+	}
+
+	return nil
+}
+
+// Allowed returns how many logs the profile allows to be written within
+// the given time since the start of the test. The first log, or the first
+// burst, is allowed right away.
+func (l *LoadProfile) Allowed(elapsed time.Duration) float64 {
+	t := elapsed.Seconds()
+	if t < 0 {
+		return 0
+	}
+
+	switch l.Type {
+	case RampLoad:
+		d := time.Duration(l.RampDuration).Seconds()
+		if t <= d {
+			return 1 + l.Rate*t + (l.EndRate-l.Rate)*t*t/(2*d)
+		}
+		return 1 + (l.Rate+l.EndRate)*d/2 + l.EndRate*(t-d)
+	case BurstLoad:
+		bursts := math.Floor(t/time.Duration(l.BurstInterval).Seconds()) + 1
+		return l.Rate*t + float64(l.BurstSize)*bursts
+	default:
+		return 1 + l.Rate*t
+	}
+}
+
+// Due returns the time since the start of the test at which the profile
+// allows the log with the given index to be written.
+func (l *LoadProfile) Due(n uint64) time.Duration {
+	want := float64(n) + 1
+	if l.Allowed(0) >= want {
+		return 0
+	}
+
+	// Allowed grows monotonically, so find the first time it allows the
+	// log with a binary search.
+	hi := time.Microsecond
+	for l.Allowed(hi) < want {
+		hi *= 2
+	}
+	lo := hi / 2
+	for hi-lo > time.Microsecond {
+		mid := lo + (hi-lo)/2
+		if l.Allowed(mid) >= want {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	return hi
+}
@@ -0,0 +1,76 @@
+package api_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-tools/reliability/api"
+)
+
+var _ = Describe("LoadProfile", func() {
+	It("spaces the logs of a constant load evenly", func() {
+		l := &api.LoadProfile{Type: api.ConstantLoad, Rate: 1000}
+
+		Expect(l.Due(0)).To(BeZero())
+		Expect(l.Due(1)).To(BeNumerically("~", time.Millisecond, time.Microsecond))
+		Expect(l.Due(1000)).To(BeNumerically("~", time.Second, time.Microsecond))
+	})
+
+	It("ramps the rate of a ramp load", func() {
+		l := &api.LoadProfile{
+			Type:         api.RampLoad,
+			Rate:         0,
+			EndRate:      100,
+			RampDuration: api.Duration(time.Second),
+		}
+
+		// 50 logs are written while ramping up, then 100 each second.
+		Expect(l.Allowed(time.Second)).To(BeNumerically("~", 51))
+		Expect(l.Allowed(2 * time.Second)).To(BeNumerically("~", 151))
+		Expect(l.Due(50)).To(BeNumerically("~", time.Second, time.Microsecond))
+		Expect(l.Due(150)).To(BeNumerically("~", 2*time.Second, time.Microsecond))
+	})
+
+	It("writes the bursts of a burst load at once", func() {
+		l := &api.LoadProfile{
+			Type:          api.BurstLoad,
+			BurstSize:     10,
+			BurstInterval: api.Duration(time.Second),
+		}
+
+		Expect(l.Due(0)).To(BeZero())
+		Expect(l.Due(9)).To(BeZero())
+		Expect(l.Due(10)).To(BeNumerically("~", time.Second, time.Microsecond))
+		Expect(l.Due(19)).To(BeNumerically("~", time.Second, time.Microsecond))
+		Expect(l.Due(20)).To(BeNumerically("~", 2*time.Second, time.Microsecond))
+	})
+
+	DescribeTable("validation", func(l api.LoadProfile, valid bool) {
+		if valid {
+			Expect(l.Validate()).To(Succeed())
+		} else {
+			Expect(l.Validate()).ToNot(Succeed())
+		}
+	},
+		Entry("constant", api.LoadProfile{Type: api.ConstantLoad, Rate: 1}, true),
+		Entry("constant without a rate", api.LoadProfile{Type: api.ConstantLoad}, false),
+		Entry("ramp", api.LoadProfile{Type: api.RampLoad, EndRate: 1, RampDuration: 1}, true),
+		Entry("ramp without a duration", api.LoadProfile{Type: api.RampLoad, EndRate: 1}, false),
+		Entry("burst", api.LoadProfile{Type: api.BurstLoad, BurstSize: 1, BurstInterval: 1}, true),
+		Entry("burst without an interval", api.LoadProfile{Type: api.BurstLoad, BurstSize: 1}, false),
+		Entry("unknown type", api.LoadProfile{Type: "sine", Rate: 1}, false),
+		Entry("with sizes", api.LoadProfile{
+			Type:  api.ConstantLoad,
+			Rate:  1,
+			Sizes: []api.MessageSize{{Bytes: 100, Weight: 1}},
+		}, true),
+		Entry("with an empty size", api.LoadProfile{
+			Type:  api.ConstantLoad,
+			Rate:  1,
+			Sizes: []api.MessageSize{{Bytes: 0, Weight: 1}},
+		}, false),
+	)
+})
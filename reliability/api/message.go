@@ -0,0 +1,50 @@
+package api
+
+// MessageType identifies what a Message carries.
+type MessageType string
+
+const (
+	// StartTestMessage is sent from the control server to start Test.
+	StartTestMessage MessageType = "start_test"
+	// TestAcceptedMessage is sent from a worker once it has started the
+	// test with TestID.
+	TestAcceptedMessage MessageType = "test_accepted"
+	// TestPrimedMessage is sent from a worker once its firehose connection
+	// for the test with TestID is receiving logs.
+	TestPrimedMessage MessageType = "test_primed"
+	// TestFinishedMessage is sent from a worker with the Result of the
+	// test with TestID.
+	TestFinishedMessage MessageType = "test_finished"
+	// TestFailedMessage is sent from a worker with the Error the test with
+	// TestID failed with.
+	TestFailedMessage MessageType = "test_failed"
+	// HeartbeatMessage is sent from both sides to keep the connection alive.
+	// A side that does not receive any message for a few heartbeat
+	// intervals considers the connection dead.
+	HeartbeatMessage MessageType = "heartbeat"
+)
+
+// Message is sent between the control server and a worker over the
+// websocket.
+type Message struct {
+	Type MessageType `json:"type"`
+	// Set on every message sent from a worker.
+	WorkerID string      `json:"worker_id,omitempty"`
+	TestID   int64       `json:"test_id,omitempty"`
+	Test     *Test       `json:"test,omitempty"`
+	Result   *TestResult `json:"result,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// TestResult is the outcome of a test on a single worker.
+type TestResult struct {
+	TestID   int64  `json:"test_id"`
+	WorkerID string `json:"worker_id"`
+	// How many logs the worker wrote.
+	WriteCycles uint64 `json:"write_cycles"`
+	// How many test logs the worker read from the firehose.
+	ReceivedLogCount uint64 `json:"received_log_count"`
+	// Latencies between a log being written and received by the worker.
+	LatencyP50 Duration `json:"latency_p50"`
+	LatencyP99 Duration `json:"latency_p99"`
+}
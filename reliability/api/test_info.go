@@ -15,8 +15,23 @@ type Test struct {
 	Delay       Duration  `json:"delay"`
 	Timeout     Duration  `json:"timeout"`
 	StartTime   time.Time `json:"start_time"`
+	// Mode selects the egress path the workers consume the logs from.
+	// Defaults to FirehoseMode.
+	Mode string `json:"mode,omitempty"`
+	// Load shapes the rate the workers write logs at. Without a Load the
+	// workers wait Delay between writes.
+	Load *LoadProfile `json:"load,omitempty"`
 }
 
+const (
+	// FirehoseMode consumes the v1 firehose.
+	FirehoseMode = "firehose"
+	// RLPGatewayMode consumes the v2 RLP gateway.
+	RLPGatewayMode = "rlp_gateway"
+	// LogCacheMode walks Log Cache.
+	LogCacheMode = "log_cache"
+)
+
 // Duration is a time.Duration that implements json.Unmarshal and
 // json.Marshal.
 type Duration time.Duration
@@ -0,0 +1,56 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/loggregator-tools/reliability/server/internal/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RequireBearerToken", func() {
+	var (
+		called bool
+		h      http.Handler
+	)
+
+	BeforeEach(func() {
+		called = false
+		h = api.RequireBearerToken("token", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = true
+		}))
+	})
+
+	It("passes requests with the token to the handler", func() {
+		req := httptest.NewRequest(http.MethodPost, "/tests", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		recorder := httptest.NewRecorder()
+
+		h.ServeHTTP(recorder, req)
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(called).To(BeTrue())
+	})
+
+	DescribeTable("rejects requests without the token", func(header, msg string) {
+		req := httptest.NewRequest(http.MethodPost, "/tests", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		recorder := httptest.NewRecorder()
+
+		h.ServeHTTP(recorder, req)
+
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		Expect(recorder.Header().Get("WWW-Authenticate")).To(Equal("Bearer"))
+		Expect(recorder.Body.String()).To(ContainSubstring(msg))
+		Expect(called).To(BeFalse())
+	},
+		Entry("without a header", "", "missing bearer token"),
+		Entry("with basic auth", "Basic dXNlcjpwYXNz", "missing bearer token"),
+		Entry("with a wrong token", "Bearer wrong", "invalid bearer token"),
+	)
+})
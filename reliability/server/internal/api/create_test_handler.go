@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,7 +12,12 @@ import (
 	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
 )
 
-// Runner tells the children to run tests.
+// runRetryInterval is how long to wait before trying to run a test again
+// while no workers are connected.
+const runRetryInterval = 100 * time.Millisecond
+
+// Runner tells the children to run tests. It returns how many children
+// started the test.
 type Runner interface {
 	Run(t *sharedapi.Test) (int, error)
 }
@@ -50,7 +56,7 @@ func (h *CreateTestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.attemptRun(t)
+	started, err := h.attemptRun(t)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_, err = fmt.Fprint(w, err)
@@ -60,7 +66,10 @@ func (h *CreateTestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := json.Marshal(t)
+	resp, err := json.Marshal(createTestResponse{
+		Test:           t,
+		WorkersStarted: started,
+	})
 	if err != nil {
 		log.Printf("failed to encode response: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -74,19 +83,28 @@ func (h *CreateTestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *CreateTestHandler) attemptRun(t *sharedapi.Test) error {
+// createTestResponse is the created test with the number of workers that
+// started it.
+type createTestResponse struct {
+	*sharedapi.Test
+	WorkersStarted int `json:"workers_started"`
+}
+
+// attemptRun runs the test, waiting up to the runner timeout for workers to
+// connect. Once the test was sent to workers it is never sent again, even
+// if none of them accepted it, as that would start it twice.
+func (h *CreateTestHandler) attemptRun(t *sharedapi.Test) (int, error) {
 	timeout := time.After(h.runnerTimeout)
-	var err error
 	for {
-		_, err = h.runner.Run(t)
-		if err == nil {
-			return nil
+		started, err := h.runner.Run(t)
+		if !errors.Is(err, ErrNoWorkers) {
+			return started, err
 		}
 
 		select {
 		case <-timeout:
-			return err
-		default:
+			return 0, err
+		case <-time.After(runRetryInterval):
 		}
 	}
 }
@@ -99,10 +117,15 @@ func buildTest(src io.ReadCloser) (*sharedapi.Test, error) {
 	}
 	_ = src.Close()
 
+	start(t)
+	return t, nil
+}
+
+// start gives the test its ID and start time.
+func start(t *sharedapi.Test) {
 	t.ID = time.Now().UnixNano()
 	// ensure the test is sent to workers with a start time
 	t.StartTime = time.Now()
-	return t, nil
 }
 
 func valid(t *sharedapi.Test) bool {
@@ -112,5 +135,17 @@ func valid(t *sharedapi.Test) bool {
 	if t.Timeout == 0 {
 		return false
 	}
-	return true
+	if t.Load != nil && t.Load.Validate() != nil {
+		return false
+	}
+	return validMode(t.Mode)
+}
+
+func validMode(mode string) bool {
+	switch mode {
+	case "", sharedapi.FirehoseMode, sharedapi.RLPGatewayMode, sharedapi.LogCacheMode:
+		return true
+	default:
+		return false
+	}
 }
@@ -84,6 +84,8 @@ var _ = Describe("CreateTestHandler", func() {
 		Entry("without timeout", `{"cycles": 1, "delay": "1s"}`),
 		Entry("with invalid timeout", `{"cycles": 1, "timeout": "one second"}`),
 		Entry("with malformed json", `!#$^?!#$^`),
+		Entry("with an unknown mode", `{"cycles": 1, "timeout": "1s", "mode": "syslog"}`),
+		Entry("with an invalid load", `{"cycles": 1, "timeout": "1s", "load": {"type": "constant"}}`),
 	)
 
 	It("returns MethodNotAllowed on anything but a POST", func() {
@@ -99,11 +101,11 @@ var _ = Describe("CreateTestHandler", func() {
 	})
 
 	Context("with an error returned from the runner", func() {
-		It("retries the runner after an error", func() {
+		It("retries the runner while no workers are connected", func() {
 			runner := &spyRunner{
-				err: errors.New("some-error"),
+				err: api.ErrNoWorkers,
 			}
-			h := api.NewCreateTestHandler(runner, time.Millisecond)
+			h := api.NewCreateTestHandler(runner, 250*time.Millisecond)
 			recorder := httptest.NewRecorder()
 
 			h.ServeHTTP(recorder, &http.Request{
@@ -113,7 +115,27 @@ var _ = Describe("CreateTestHandler", func() {
 				},
 			})
 
-			Eventually(runner.called).Should(BeNumerically(">", int64(1)))
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(runner.called()).To(BeNumerically(">", int64(1)))
+			Expect(runner.called()).To(BeNumerically("<=", int64(4)))
+		})
+
+		It("does not run a test again once it was sent to workers", func() {
+			runner := &spyRunner{
+				err: errors.New("no worker accepted the test"),
+			}
+			h := api.NewCreateTestHandler(runner, time.Second)
+			recorder := httptest.NewRecorder()
+
+			h.ServeHTTP(recorder, &http.Request{
+				Method: "POST",
+				Body: &requestBody{
+					Reader: strings.NewReader(`{"cycles": 1000, "delay":"1s", "timeout":"60s"}`),
+				},
+			})
+
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			Expect(runner.called()).To(Equal(int64(1)))
 		})
 
 		It("responds with a 500", func() {
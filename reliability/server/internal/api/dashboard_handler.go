@@ -0,0 +1,35 @@
+package api
+
+import (
+	_ "embed"
+	"log"
+	"net/http"
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// DashboardHandler handles HTTP requests (GET only) for the dashboard. The
+// dashboard is a single HTML page without external assets. It lists the
+// connected workers, starts tests and charts the test history, all through
+// the JSON API of the other handlers.
+type DashboardHandler struct{}
+
+// NewDashboardHandler builds a new DashboardHandler.
+func NewDashboardHandler() *DashboardHandler {
+	return &DashboardHandler{}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *DashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err := w.Write(dashboardHTML)
+	if err != nil {
+		log.Printf("failed to write response: %s", err)
+	}
+}
@@ -0,0 +1,42 @@
+package api_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/loggregator-tools/reliability/server/internal/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DashboardHandler", func() {
+	It("serves the dashboard", func() {
+		recorder := httptest.NewRecorder()
+		api.NewDashboardHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("text/html; charset=utf-8"))
+
+		body, err := io.ReadAll(recorder.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring("<title>Loggregator Reliability</title>"))
+	})
+
+	It("does not load external assets", func() {
+		recorder := httptest.NewRecorder()
+		api.NewDashboardHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		body := recorder.Body.String()
+		Expect(body).ToNot(MatchRegexp(`(src|href)=["']?(https?:)?//`))
+		Expect(body).ToNot(ContainSubstring("@import"))
+	})
+
+	It("returns MethodNotAllowed on anything but a GET", func() {
+		recorder := httptest.NewRecorder()
+		api.NewDashboardHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", nil))
+
+		Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
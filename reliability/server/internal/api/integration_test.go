@@ -1,11 +1,13 @@
 package api_test
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"time"
 
+	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
 	"code.cloudfoundry.org/loggregator-tools/reliability/server/internal/api"
 
 	"github.com/posener/wstest"
@@ -32,6 +34,14 @@ var _ = Describe("Server<->Worker communciation", func() {
 
 		recorder := initiateTest(createTestHandler)
 		Expect(recorder.Code).To(Equal(http.StatusCreated))
+
+		var resp struct {
+			ID             int64 `json:"id"`
+			WorkersStarted int   `json:"workers_started"`
+		}
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &resp)).To(Succeed())
+		Expect(resp.ID).ToNot(BeZero())
+		Expect(resp.WorkersStarted).To(Equal(1))
 	})
 })
 
@@ -51,10 +61,21 @@ func attachWorker(workerHandler http.Handler) func() {
 
 	go func() {
 		for {
-			_, _, err := c.ReadMessage()
+			var msg sharedapi.Message
+			err := c.ReadJSON(&msg)
 			if err != nil {
 				break
 			}
+
+			if msg.Type == sharedapi.StartTestMessage {
+				err = c.WriteJSON(&sharedapi.Message{
+					Type:   sharedapi.TestAcceptedMessage,
+					TestID: msg.Test.ID,
+				})
+				if err != nil {
+					break
+				}
+			}
 		}
 	}()
 
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+)
+
+// ScheduleHandler handles HTTP requests to list the schedules of a
+// Scheduler (GET) and to pause or resume one of them (POST with "name"
+// and "action" path values).
+type ScheduleHandler struct {
+	scheduler *Scheduler
+}
+
+// NewScheduleHandler builds a new ScheduleHandler.
+func NewScheduleHandler(s *Scheduler) *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduler: s,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *ScheduleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, h.scheduler.List())
+	case http.MethodPost:
+		var err error
+		name := r.PathValue("name")
+		switch r.PathValue("action") {
+		case "pause":
+			err = h.scheduler.Pause(name)
+		case "resume":
+			err = h.scheduler.Resume(name)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,84 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
+	"code.cloudfoundry.org/loggregator-tools/reliability/server/internal/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ScheduleHandler", func() {
+	var (
+		scheduler *api.Scheduler
+		server    *httptest.Server
+	)
+
+	BeforeEach(func() {
+		var err error
+		scheduler, err = api.NewScheduler(
+			&scheduleRunner{},
+			&fakeWorkerPool{},
+			[]api.Schedule{{
+				Name:     "hourly",
+				Interval: sharedapi.Duration(time.Hour),
+				Cycles:   1000,
+				Timeout:  sharedapi.Duration(time.Minute),
+			}},
+			api.WithClock(newFakeClock()),
+		)
+		Expect(err).ToNot(HaveOccurred())
+
+		h := api.NewScheduleHandler(scheduler)
+		mux := http.NewServeMux()
+		mux.Handle("GET /schedules", h)
+		mux.Handle("POST /schedules/{name}/{action}", h)
+		server = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("lists the schedules", func() {
+		resp, err := http.Get(server.URL + "/schedules")
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:errcheck
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var statuses []api.ScheduleStatus
+		Expect(json.NewDecoder(resp.Body).Decode(&statuses)).To(Succeed())
+		Expect(statuses).To(HaveLen(1))
+		Expect(statuses[0].Name).To(Equal("hourly"))
+		Expect(statuses[0].Interval).To(Equal(sharedapi.Duration(time.Hour)))
+	})
+
+	It("pauses and resumes a schedule", func() {
+		resp, err := http.Post(server.URL+"/schedules/hourly/pause", "", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(scheduler.List()[0].Paused).To(BeTrue())
+
+		resp, err = http.Post(server.URL+"/schedules/hourly/resume", "", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		Expect(scheduler.List()[0].Paused).To(BeFalse())
+	})
+
+	It("returns 404 for an unknown schedule", func() {
+		resp, err := http.Post(server.URL+"/schedules/daily/pause", "", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("returns 404 for an unknown action", func() {
+		resp, err := http.Post(server.URL+"/schedules/hourly/delete", "", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+})
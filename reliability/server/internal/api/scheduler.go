@@ -0,0 +1,275 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
+)
+
+// ErrUnknownSchedule is returned when pausing or resuming a schedule that
+// does not exist.
+var ErrUnknownSchedule = errors.New("unknown schedule")
+
+// Schedule is a test profile that is run on an interval.
+type Schedule struct {
+	Name     string                 `json:"name"`
+	Interval sharedapi.Duration     `json:"interval"`
+	Cycles   uint64                 `json:"cycles"`
+	Delay    sharedapi.Duration     `json:"delay"`
+	Timeout  sharedapi.Duration     `json:"timeout"`
+	Mode     string                 `json:"mode,omitempty"`
+	Load     *sharedapi.LoadProfile `json:"load,omitempty"`
+}
+
+// ScheduleStatus is a Schedule and the state of its runs.
+type ScheduleStatus struct {
+	Schedule
+	Paused bool `json:"paused"`
+	// Running is true while the last test of the schedule is running on
+	// the workers.
+	Running    bool      `json:"running"`
+	LastRun    time.Time `json:"last_run"`
+	LastTestID int64     `json:"last_test_id"`
+	Runs       uint64    `json:"runs"`
+	// Skipped counts the intervals in which no test was started, e.g.
+	// because another test was still running or no workers were connected.
+	Skipped uint64 `json:"skipped"`
+}
+
+// WorkerPool tells the Scheduler about the connected workers.
+type WorkerPool interface {
+	// ConnCount returns the number of connected workers.
+	ConnCount() int
+	// ActiveTest returns the ID of the test the workers are running, if
+	// any. It covers tests of every schedule and tests that were started
+	// through the API.
+	ActiveTest() (int64, bool)
+}
+
+// Clock tells the time and waits for it to pass.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Scheduler runs test profiles on an interval. A schedule is skipped while
+// any test is running on the workers, or no workers are connected.
+type Scheduler struct {
+	runner  Runner
+	workers WorkerPool
+	clock   Clock
+
+	mu sync.Mutex
+	// starting is set while a schedule is sending its test to the workers,
+	// before the workers report it as active.
+	starting  bool
+	schedules map[string]*scheduleState
+}
+
+type scheduleState struct {
+	status ScheduleStatus
+}
+
+// SchedulerOption configures a Scheduler.
+type SchedulerOption func(*Scheduler)
+
+// WithClock sets the Clock the Scheduler waits on. Defaults to the system
+// clock.
+func WithClock(c Clock) SchedulerOption {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// NewScheduler builds a new Scheduler for the given schedules. It returns
+// an error if a schedule is invalid or its name is not unique.
+func NewScheduler(
+	r Runner,
+	w WorkerPool,
+	schedules []Schedule,
+	opts ...SchedulerOption,
+) (*Scheduler, error) {
+	s := &Scheduler{
+		runner:    r,
+		workers:   w,
+		clock:     realClock{},
+		schedules: make(map[string]*scheduleState),
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	for _, sch := range schedules {
+		switch {
+		case sch.Name == "":
+			return nil, errors.New("schedule without a name")
+		case sch.Interval <= 0:
+			return nil, fmt.Errorf("schedule %s requires an interval", sch.Name)
+		case sch.Cycles == 0:
+			return nil, fmt.Errorf("schedule %s requires cycles", sch.Name)
+		case sch.Timeout <= 0:
+			return nil, fmt.Errorf("schedule %s requires a timeout", sch.Name)
+		case !validMode(sch.Mode):
+			return nil, fmt.Errorf("schedule %s has unknown mode %q", sch.Name, sch.Mode)
+		}
+
+		if sch.Load != nil {
+			err := sch.Load.Validate()
+			if err != nil {
+				return nil, fmt.Errorf("schedule %s has an invalid load: %s", sch.Name, err)
+			}
+		}
+
+		if _, ok := s.schedules[sch.Name]; ok {
+			return nil, fmt.Errorf("duplicate schedule %s", sch.Name)
+		}
+
+		s.schedules[sch.Name] = &scheduleState{
+			status: ScheduleStatus{Schedule: sch},
+		}
+	}
+
+	return s, nil
+}
+
+// Run starts every schedule. It blocks until the given context is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for name, state := range s.schedules {
+		wg.Add(1)
+		go func(name string, interval time.Duration) {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-s.clock.After(interval):
+				}
+
+				s.tick(name)
+			}
+		}(name, time.Duration(state.status.Interval))
+	}
+
+	wg.Wait()
+}
+
+// List returns the status of every schedule, ordered by name.
+func (s *Scheduler) List() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	active, running := s.workers.ActiveTest()
+	statuses := make([]ScheduleStatus, 0, len(s.schedules))
+	for _, state := range s.schedules {
+		status := state.status
+		status.Running = running && active == status.LastTestID
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+// Pause stops the schedule with the given name from starting tests. A test
+// that is already running is not affected.
+func (s *Scheduler) Pause(name string) error {
+	return s.setPaused(name, true)
+}
+
+// Resume lets a paused schedule start tests again.
+func (s *Scheduler) Resume(name string) error {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.schedules[name]
+	if !ok {
+		return ErrUnknownSchedule
+	}
+	state.status.Paused = paused
+
+	return nil
+}
+
+func (s *Scheduler) tick(name string) {
+	now := s.clock.Now()
+	t, ok := s.prepare(name)
+	if !ok {
+		return
+	}
+
+	// Run blocks until the workers accepted the test, the lock is not held
+	// so the schedules can be listed, paused and resumed meanwhile.
+	_, err := s.runner.Run(t)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.starting = false
+	state := s.schedules[name]
+	if err != nil {
+		log.Printf("schedule %s failed to start a test: %s", name, err)
+		state.status.Skipped++
+		return
+	}
+
+	state.status.LastRun = now
+	state.status.LastTestID = t.ID
+	state.status.Runs++
+}
+
+// prepare builds the next test of the schedule with the given name. It
+// returns false if the schedule is paused or has to skip the interval.
+func (s *Scheduler) prepare(name string) (*sharedapi.Test, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.schedules[name]
+	if state.status.Paused {
+		return nil, false
+	}
+
+	if _, ok := s.workers.ActiveTest(); ok || s.starting {
+		log.Printf("skipping schedule %s: another test is still running", name)
+		state.status.Skipped++
+		return nil, false
+	}
+
+	if s.workers.ConnCount() == 0 {
+		log.Printf("skipping schedule %s: no workers are connected", name)
+		state.status.Skipped++
+		return nil, false
+	}
+
+	t := &sharedapi.Test{
+		Cycles:  state.status.Cycles,
+		Delay:   state.status.Delay,
+		Timeout: state.status.Timeout,
+		Mode:    state.status.Mode,
+		Load:    state.status.Load,
+	}
+	start(t)
+	s.starting = true
+
+	return t, true
+}
@@ -0,0 +1,344 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
+	"code.cloudfoundry.org/loggregator-tools/reliability/server/internal/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scheduler", func() {
+	var (
+		clock   *fakeClock
+		runner  *scheduleRunner
+		workers *fakeWorkerPool
+		cancel  context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		clock = newFakeClock()
+		runner = &scheduleRunner{tests: make(chan sharedapi.Test, 100)}
+		workers = &fakeWorkerPool{}
+		workers.set(1)
+	})
+
+	AfterEach(func() {
+		if cancel != nil {
+			cancel()
+		}
+	})
+
+	start := func(schedules ...api.Schedule) *api.Scheduler {
+		s, err := api.NewScheduler(runner, workers, schedules, api.WithClock(clock))
+		Expect(err).ToNot(HaveOccurred())
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		go s.Run(ctx)
+
+		return s
+	}
+
+	// advance waits for every schedule to wait on the clock, so the ticks
+	// of the previous advance are done, before moving the clock.
+	advance := func(waiters int, d time.Duration) {
+		Eventually(clock.waiters).Should(Equal(waiters))
+		clock.advance(d)
+		Eventually(clock.waiters).Should(Equal(waiters))
+	}
+
+	hourly := api.Schedule{
+		Name:     "hourly",
+		Interval: sharedapi.Duration(time.Hour),
+		Cycles:   1000,
+		Delay:    sharedapi.Duration(time.Millisecond),
+		Timeout:  sharedapi.Duration(time.Minute),
+		Mode:     sharedapi.LogCacheMode,
+	}
+
+	It("runs the profile on every interval", func() {
+		start(hourly)
+
+		advance(1, time.Hour)
+		var t sharedapi.Test
+		Expect(runner.tests).To(Receive(&t))
+		Expect(t.ID).ToNot(BeZero())
+		Expect(t.Cycles).To(Equal(uint64(1000)))
+		Expect(t.Delay).To(Equal(sharedapi.Duration(time.Millisecond)))
+		Expect(t.Timeout).To(Equal(sharedapi.Duration(time.Minute)))
+		Expect(t.Mode).To(Equal(sharedapi.LogCacheMode))
+
+		advance(1, 59*time.Minute)
+		Expect(runner.tests).ToNot(Receive())
+
+		advance(1, time.Minute)
+		Expect(runner.tests).To(Receive())
+	})
+
+	It("does not start a test while the previous one is running", func() {
+		s := start(hourly)
+
+		advance(1, time.Hour)
+		var t sharedapi.Test
+		Expect(runner.tests).To(Receive(&t))
+		workers.setActive(t.ID)
+		Expect(s.List()[0].Running).To(BeTrue())
+
+		advance(1, time.Hour)
+		Expect(runner.tests).ToNot(Receive())
+
+		workers.setActive(0)
+		Expect(s.List()[0].Running).To(BeFalse())
+		advance(1, time.Hour)
+		Expect(runner.tests).To(Receive())
+
+		status := s.List()[0]
+		Expect(status.Runs).To(Equal(uint64(2)))
+		Expect(status.Skipped).To(Equal(uint64(1)))
+	})
+
+	It("does not start a test while another test is running", func() {
+		workers.setActive(42)
+		s := start(hourly)
+
+		advance(1, time.Hour)
+		Expect(runner.tests).ToNot(Receive())
+		Expect(s.List()[0].Running).To(BeFalse())
+		Expect(s.List()[0].Skipped).To(Equal(uint64(1)))
+	})
+
+	It("starts a single test when schedules are due at once", func() {
+		runner.block = make(chan struct{})
+		other := hourly
+		other.Name = "other"
+		s := start(hourly, other)
+
+		Eventually(clock.waiters).Should(Equal(2))
+		clock.advance(time.Hour)
+		Eventually(runner.tests).Should(Receive())
+		Eventually(clock.waiters).Should(Equal(1))
+		close(runner.block)
+		Eventually(clock.waiters).Should(Equal(2))
+
+		Expect(runner.tests).ToNot(Receive())
+		statuses := s.List()
+		Expect(statuses[0].Runs + statuses[1].Runs).To(Equal(uint64(1)))
+		Expect(statuses[0].Skipped + statuses[1].Skipped).To(Equal(uint64(1)))
+	})
+
+	It("can be listed and paused while a test is starting", func() {
+		runner.block = make(chan struct{})
+		defer close(runner.block)
+		s := start(hourly)
+
+		Eventually(clock.waiters).Should(Equal(1))
+		clock.advance(time.Hour)
+		Eventually(runner.tests).Should(Receive())
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.List()
+			_ = s.Pause("hourly")
+		}()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("skips the interval when no workers are connected", func() {
+		workers.set(0)
+		s := start(hourly)
+
+		advance(1, time.Hour)
+		Expect(runner.tests).ToNot(Receive())
+		Expect(s.List()[0].Skipped).To(Equal(uint64(1)))
+
+		workers.set(2)
+		advance(1, time.Hour)
+		Expect(runner.tests).To(Receive())
+	})
+
+	It("skips the interval when the runner fails", func() {
+		runner.fail(true)
+		s := start(hourly)
+
+		advance(1, time.Hour)
+		Expect(s.List()[0].Runs).To(BeZero())
+		Expect(s.List()[0].Skipped).To(Equal(uint64(1)))
+		Expect(s.List()[0].Running).To(BeFalse())
+	})
+
+	It("does not run paused schedules until they are resumed", func() {
+		s := start(hourly)
+		Expect(s.Pause("hourly")).To(Succeed())
+		Expect(s.List()[0].Paused).To(BeTrue())
+
+		advance(1, time.Hour)
+		Expect(runner.tests).ToNot(Receive())
+
+		Expect(s.Resume("hourly")).To(Succeed())
+		advance(1, time.Hour)
+		Expect(runner.tests).To(Receive())
+	})
+
+	It("runs each schedule on its own interval", func() {
+		daily := hourly
+		daily.Name = "daily"
+		daily.Interval = sharedapi.Duration(24 * time.Hour)
+		s := start(hourly, daily)
+
+		for i := 0; i < 24; i++ {
+			advance(2, time.Hour)
+		}
+
+		statuses := s.List()
+		Expect(statuses[0].Name).To(Equal("daily"))
+		Expect(statuses[0].Runs).To(Equal(uint64(1)))
+		Expect(statuses[1].Name).To(Equal("hourly"))
+		Expect(statuses[1].Runs).To(Equal(uint64(24)))
+	})
+
+	It("returns an error for unknown schedules", func() {
+		s := start(hourly)
+
+		Expect(s.Pause("unknown")).To(MatchError(api.ErrUnknownSchedule))
+		Expect(s.Resume("unknown")).To(MatchError(api.ErrUnknownSchedule))
+	})
+
+	DescribeTable("with an invalid schedule", func(modify func(*api.Schedule)) {
+		sch := hourly
+		modify(&sch)
+
+		_, err := api.NewScheduler(runner, workers, []api.Schedule{sch})
+		Expect(err).To(HaveOccurred())
+	},
+		Entry("without a name", func(s *api.Schedule) { s.Name = "" }),
+		Entry("without an interval", func(s *api.Schedule) { s.Interval = 0 }),
+		Entry("without cycles", func(s *api.Schedule) { s.Cycles = 0 }),
+		Entry("without a timeout", func(s *api.Schedule) { s.Timeout = 0 }),
+		Entry("with an unknown mode", func(s *api.Schedule) { s.Mode = "syslog" }),
+		Entry("with an invalid load", func(s *api.Schedule) {
+			s.Load = &sharedapi.LoadProfile{Type: sharedapi.BurstLoad}
+		}),
+	)
+
+	It("returns an error for duplicate names", func() {
+		_, err := api.NewScheduler(runner, workers, []api.Schedule{hourly, hourly})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	pending []fakeTimer
+}
+
+type fakeTimer struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	c.pending = append(c.pending, fakeTimer{deadline: c.now.Add(d), c: ch})
+
+	return ch
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	var pending []fakeTimer
+	for _, t := range c.pending {
+		if t.deadline.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.pending = pending
+}
+
+func (c *fakeClock) waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.pending)
+}
+
+type fakeWorkerPool struct {
+	n      int64
+	active int64
+}
+
+func (f *fakeWorkerPool) set(n int64) {
+	atomic.StoreInt64(&f.n, n)
+}
+
+// setActive sets the ID of the active test, 0 for none.
+func (f *fakeWorkerPool) setActive(id int64) {
+	atomic.StoreInt64(&f.active, id)
+}
+
+func (f *fakeWorkerPool) ConnCount() int {
+	return int(atomic.LoadInt64(&f.n))
+}
+
+func (f *fakeWorkerPool) ActiveTest() (int64, bool) {
+	id := atomic.LoadInt64(&f.active)
+	return id, id != 0
+}
+
+type scheduleRunner struct {
+	tests  chan sharedapi.Test
+	failed int32
+	// block, if set, holds Run until it is closed.
+	block chan struct{}
+}
+
+func (r *scheduleRunner) fail(b bool) {
+	var v int32
+	if b {
+		v = 1
+	}
+	atomic.StoreInt32(&r.failed, v)
+}
+
+func (r *scheduleRunner) Run(t *sharedapi.Test) (int, error) {
+	if atomic.LoadInt32(&r.failed) == 1 {
+		return 0, errors.New("failed to write test")
+	}
+
+	r.tests <- *t
+	if r.block != nil {
+		<-r.block
+	}
+	return 1, nil
+}
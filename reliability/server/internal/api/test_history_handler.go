@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// TestHistoryHandler handles HTTP requests (GET only) for the tests that
+// have been run and their results. A request with an "id" path value gets
+// that test, any other request gets every test. This lets a CI assert on a
+// test without going through Datadog.
+type TestHistoryHandler struct {
+	store *TestStore
+}
+
+// NewTestHistoryHandler builds a new TestHistoryHandler.
+func NewTestHistoryHandler(s *TestStore) *TestHistoryHandler {
+	return &TestHistoryHandler{
+		store: s,
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *TestHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	idParam := r.PathValue("id")
+	if idParam == "" {
+		writeJSON(w, h.store.List())
+		return
+	}
+
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	run, ok := h.store.Get(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, &run)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("failed to encode response: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(resp)
+	if err != nil {
+		log.Printf("failed to write response: %s", err)
+	}
+}
@@ -0,0 +1,75 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
+	"code.cloudfoundry.org/loggregator-tools/reliability/server/internal/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TestHistoryHandler", func() {
+	var (
+		store  *api.TestStore
+		server *httptest.Server
+	)
+
+	BeforeEach(func() {
+		store = api.NewTestStore()
+		Expect(store.AddTest(sharedapi.Test{ID: 1, Cycles: 100}, 1)).To(Succeed())
+		Expect(store.AddTest(sharedapi.Test{ID: 2, Cycles: 200}, 1)).To(Succeed())
+		Expect(store.AddResult(sharedapi.TestResult{TestID: 2, WorkerID: "worker-0", ReceivedLogCount: 150})).To(Succeed())
+
+		h := api.NewTestHistoryHandler(store)
+		mux := http.NewServeMux()
+		mux.Handle("GET /tests", h)
+		mux.Handle("GET /tests/{id}", h)
+		server = httptest.NewServer(mux)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("lists every test", func() {
+		resp, err := http.Get(server.URL + "/tests")
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:errcheck
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var runs []api.TestRun
+		Expect(json.NewDecoder(resp.Body).Decode(&runs)).To(Succeed())
+		Expect(runs).To(HaveLen(2))
+		Expect(runs[0].Test.ID).To(Equal(int64(1)))
+		Expect(runs[1].Test.ID).To(Equal(int64(2)))
+	})
+
+	It("gets a test by its ID", func() {
+		resp, err := http.Get(server.URL + "/tests/2")
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:errcheck
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		var run api.TestRun
+		Expect(json.NewDecoder(resp.Body).Decode(&run)).To(Succeed())
+		Expect(run.Test.Cycles).To(Equal(uint64(200)))
+		Expect(run.ReceivedLogCount).To(Equal(uint64(150)))
+		Expect(run.LossPercent).To(BeNumerically("~", 25))
+	})
+
+	It("returns 404 for an unknown test", func() {
+		resp, err := http.Get(server.URL + "/tests/3")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+	It("returns 400 for an invalid ID", func() {
+		resp, err := http.Get(server.URL + "/tests/abc")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,361 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
+)
+
+// TestRun is a test and the results the workers reported for it.
+type TestRun struct {
+	Test sharedapi.Test `json:"test"`
+	// How many workers started the test.
+	Workers int `json:"workers"`
+	// The sum of the logs received by every worker that reported.
+	ReceivedLogCount uint64 `json:"received_log_count"`
+	// The percentage of the test's Cycles that were not received. In
+	// RLPGatewayMode and LogCacheMode every worker reads the logs of every
+	// other worker, so each reporting worker is expected to receive all of
+	// the Cycles.
+	LossPercent float64 `json:"loss_percent"`
+	// The highest LatencyP99 of the workers that reported.
+	LatencyP99 sharedapi.Duration `json:"latency_p99"`
+	Results    []WorkerResult     `json:"results"`
+	Failures   []WorkerFailure    `json:"failures"`
+}
+
+// WorkerResult is the result a single worker reported for a test.
+type WorkerResult struct {
+	WorkerID         string `json:"worker_id"`
+	WriteCycles      uint64 `json:"write_cycles"`
+	ReceivedLogCount uint64 `json:"received_log_count"`
+	// The percentage of the worker's WriteCycles it did not receive. As the
+	// workers share a firehose subscription this is only an approximation,
+	// the LossPercent of the TestRun covers the whole test. In
+	// RLPGatewayMode and LogCacheMode it is the percentage of the test's
+	// Cycles the worker did not receive.
+	LossPercent float64            `json:"loss_percent"`
+	LatencyP50  sharedapi.Duration `json:"latency_p50"`
+	LatencyP99  sharedapi.Duration `json:"latency_p99"`
+}
+
+// WorkerFailure is the error a single worker reported for a test.
+type WorkerFailure struct {
+	WorkerID string `json:"worker_id"`
+	Error    string `json:"error"`
+}
+
+// defaultMaxTests is how many tests a TestStore keeps by default.
+const defaultMaxTests = 1000
+
+// TestStore keeps the history of tests and aggregates their results. When
+// built with a path, every change is written to that file and the history
+// survives a restart of the server. Only the most recent tests are kept.
+type TestStore struct {
+	mu       sync.RWMutex
+	path     string
+	maxTests int
+	runs     map[int64]*TestRun
+}
+
+// TestStoreOption configures a TestStore.
+type TestStoreOption func(*TestStore)
+
+// WithMaxTests sets how many tests are kept. Once there are more, the
+// oldest tests are removed. Defaults to 1000.
+func WithMaxTests(n int) TestStoreOption {
+	return func(s *TestStore) {
+		if n > 0 {
+			s.maxTests = n
+		}
+	}
+}
+
+// NewTestStore builds a new TestStore that keeps its history in memory.
+func NewTestStore(opts ...TestStoreOption) *TestStore {
+	s := &TestStore{
+		maxTests: defaultMaxTests,
+		runs:     make(map[int64]*TestRun),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+
+	return s
+}
+
+// NewFileTestStore builds a new TestStore that persists its history to the
+// given path. If the file exists the history is loaded from it.
+func NewFileTestStore(path string, opts ...TestStoreOption) (*TestStore, error) {
+	s := NewTestStore(opts...)
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []*TestRun
+	err = json.Unmarshal(data, &runs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %s", path, err)
+	}
+
+	for _, run := range runs {
+		s.runs[run.Test.ID] = run
+	}
+	s.prune()
+
+	return s, nil
+}
+
+// AddTest records a test that was sent to the given number of workers.
+func (s *TestStore) AddTest(t sharedapi.Test, workers int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run := &TestRun{
+		Test:     t,
+		Workers:  workers,
+		Results:  []WorkerResult{},
+		Failures: []WorkerFailure{},
+	}
+	run.aggregate()
+	s.runs[t.ID] = run
+	s.prune()
+
+	return s.persist()
+}
+
+// SetWorkers updates how many workers the test with the given ID was
+// started on.
+func (s *TestStore) SetWorkers(id int64, workers int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[id]
+	if !ok {
+		return fmt.Errorf("unknown test %d", id)
+	}
+	run.Workers = workers
+
+	return s.persist()
+}
+
+// AddFailure records that a worker failed to run its test.
+func (s *TestStore) AddFailure(id int64, workerID, errMsg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[id]
+	if !ok {
+		return fmt.Errorf("unknown test %d", id)
+	}
+	run.Failures = append(run.Failures, WorkerFailure{
+		WorkerID: workerID,
+		Error:    errMsg,
+	})
+
+	return s.persist()
+}
+
+// AddResult adds a worker's result to its test. A worker that reports
+// twice for the same test replaces its earlier result.
+func (s *TestStore) AddResult(r sharedapi.TestResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[r.TestID]
+	if !ok {
+		return fmt.Errorf("unknown test %d", r.TestID)
+	}
+
+	expected := r.WriteCycles
+	if readsAllLogs(run.Test.Mode) {
+		expected = run.Test.Cycles
+	}
+
+	result := WorkerResult{
+		WorkerID:         r.WorkerID,
+		WriteCycles:      r.WriteCycles,
+		ReceivedLogCount: r.ReceivedLogCount,
+		LossPercent:      lossPercent(expected, r.ReceivedLogCount),
+		LatencyP50:       r.LatencyP50,
+		LatencyP99:       r.LatencyP99,
+	}
+
+	replaced := false
+	for i, existing := range run.Results {
+		if existing.WorkerID == r.WorkerID {
+			run.Results[i] = result
+			replaced = true
+		}
+	}
+	if !replaced {
+		run.Results = append(run.Results, result)
+	}
+	run.aggregate()
+
+	return s.persist()
+}
+
+// Get returns the test with the given ID.
+func (s *TestStore) Get(id int64) (TestRun, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	run, ok := s.runs[id]
+	if !ok {
+		return TestRun{}, false
+	}
+
+	return run.copy(), true
+}
+
+// Active returns the ID of the newest test that is still running at the
+// given time: not every worker that started it has reported, and its
+// Timeout has not passed yet.
+func (s *TestStore) Active(now time.Time) (int64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var (
+		active int64
+		found  bool
+	)
+	for id, run := range s.runs {
+		if len(run.Results)+len(run.Failures) >= run.Workers {
+			continue
+		}
+
+		deadline := run.Test.StartTime.Add(time.Duration(run.Test.Timeout))
+		if !now.Before(deadline) {
+			continue
+		}
+
+		if !found || id > active {
+			active, found = id, true
+		}
+	}
+
+	return active, found
+}
+
+// List returns every test, oldest first.
+func (s *TestStore) List() []TestRun {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.list()
+}
+
+func (s *TestStore) list() []TestRun {
+	runs := make([]TestRun, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run.copy())
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Test.ID < runs[j].Test.ID
+	})
+
+	return runs
+}
+
+// prune removes the oldest tests until at most maxTests are left. Test IDs
+// increase over time, so the oldest tests have the lowest IDs.
+func (s *TestStore) prune() {
+	if len(s.runs) <= s.maxTests {
+		return
+	}
+
+	ids := make([]int64, 0, len(s.runs))
+	for id := range s.runs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids[:len(ids)-s.maxTests] {
+		delete(s.runs, id)
+	}
+}
+
+// persist writes the history to a temporary file and renames it, so a crash
+// never leaves a partially written file behind.
+func (s *TestStore) persist() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.list())
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func (r *TestRun) aggregate() {
+	r.ReceivedLogCount = 0
+	r.LatencyP99 = 0
+	for _, result := range r.Results {
+		r.ReceivedLogCount += result.ReceivedLogCount
+		if result.LatencyP99 > r.LatencyP99 {
+			r.LatencyP99 = result.LatencyP99
+		}
+	}
+
+	expected := r.Test.Cycles
+	if readsAllLogs(r.Test.Mode) {
+		expected *= uint64(len(r.Results))
+	}
+	r.LossPercent = lossPercent(expected, r.ReceivedLogCount)
+}
+
+// readsAllLogs reports whether every worker reads the logs of every other
+// worker in the given mode, instead of sharing a firehose subscription.
+func readsAllLogs(mode string) bool {
+	return mode == sharedapi.RLPGatewayMode || mode == sharedapi.LogCacheMode
+}
+
+func (r *TestRun) copy() TestRun {
+	c := *r
+	c.Results = append([]WorkerResult{}, r.Results...)
+	c.Failures = append([]WorkerFailure{}, r.Failures...)
+	return c
+}
+
+func lossPercent(expected, received uint64) float64 {
+	if expected == 0 || received >= expected {
+		return 0
+	}
+
+	return float64(expected-received) / float64(expected) * 100
+}
@@ -0,0 +1,216 @@
+package api_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
+	"code.cloudfoundry.org/loggregator-tools/reliability/server/internal/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TestStore", func() {
+	It("aggregates the results of each worker", func() {
+		store := api.NewTestStore()
+		Expect(store.AddTest(sharedapi.Test{ID: 1, Cycles: 1000}, 2)).To(Succeed())
+
+		Expect(store.AddResult(sharedapi.TestResult{
+			TestID:           1,
+			WorkerID:         "worker-0",
+			WriteCycles:      500,
+			ReceivedLogCount: 500,
+			LatencyP50:       sharedapi.Duration(10 * time.Millisecond),
+			LatencyP99:       sharedapi.Duration(50 * time.Millisecond),
+		})).To(Succeed())
+		Expect(store.AddResult(sharedapi.TestResult{
+			TestID:           1,
+			WorkerID:         "worker-1",
+			WriteCycles:      500,
+			ReceivedLogCount: 400,
+			LatencyP50:       sharedapi.Duration(20 * time.Millisecond),
+			LatencyP99:       sharedapi.Duration(80 * time.Millisecond),
+		})).To(Succeed())
+
+		run, ok := store.Get(1)
+		Expect(ok).To(BeTrue())
+		Expect(run.Workers).To(Equal(2))
+		Expect(run.ReceivedLogCount).To(Equal(uint64(900)))
+		Expect(run.LossPercent).To(BeNumerically("~", 10))
+		Expect(run.LatencyP99).To(Equal(sharedapi.Duration(80 * time.Millisecond)))
+		Expect(run.Results).To(ConsistOf(
+			api.WorkerResult{
+				WorkerID:         "worker-0",
+				WriteCycles:      500,
+				ReceivedLogCount: 500,
+				LossPercent:      0,
+				LatencyP50:       sharedapi.Duration(10 * time.Millisecond),
+				LatencyP99:       sharedapi.Duration(50 * time.Millisecond),
+			},
+			api.WorkerResult{
+				WorkerID:         "worker-1",
+				WriteCycles:      500,
+				ReceivedLogCount: 400,
+				LossPercent:      20,
+				LatencyP50:       sharedapi.Duration(20 * time.Millisecond),
+				LatencyP99:       sharedapi.Duration(80 * time.Millisecond),
+			},
+		))
+	})
+
+	It("expects every worker to receive all logs in rlp gateway and log cache mode", func() {
+		for _, mode := range []string{sharedapi.RLPGatewayMode, sharedapi.LogCacheMode} {
+			store := api.NewTestStore()
+			Expect(store.AddTest(sharedapi.Test{ID: 1, Cycles: 1000, Mode: mode}, 2)).To(Succeed())
+
+			Expect(store.AddResult(sharedapi.TestResult{
+				TestID:           1,
+				WorkerID:         "worker-0",
+				WriteCycles:      500,
+				ReceivedLogCount: 1000,
+			})).To(Succeed())
+			Expect(store.AddResult(sharedapi.TestResult{
+				TestID:           1,
+				WorkerID:         "worker-1",
+				WriteCycles:      500,
+				ReceivedLogCount: 800,
+			})).To(Succeed())
+
+			run, _ := store.Get(1)
+			Expect(run.ReceivedLogCount).To(Equal(uint64(1800)))
+			Expect(run.LossPercent).To(BeNumerically("~", 10))
+			Expect(run.Results[0].LossPercent).To(BeZero())
+			Expect(run.Results[1].LossPercent).To(BeNumerically("~", 20))
+		}
+	})
+
+	It("replaces the result of a worker that reports twice", func() {
+		store := api.NewTestStore()
+		Expect(store.AddTest(sharedapi.Test{ID: 1, Cycles: 100}, 1)).To(Succeed())
+
+		result := sharedapi.TestResult{TestID: 1, WorkerID: "worker-0", ReceivedLogCount: 50}
+		Expect(store.AddResult(result)).To(Succeed())
+		result.ReceivedLogCount = 100
+		Expect(store.AddResult(result)).To(Succeed())
+
+		run, _ := store.Get(1)
+		Expect(run.Results).To(HaveLen(1))
+		Expect(run.ReceivedLogCount).To(Equal(uint64(100)))
+		Expect(run.LossPercent).To(BeZero())
+	})
+
+	It("rejects results for unknown tests", func() {
+		store := api.NewTestStore()
+
+		err := store.AddResult(sharedapi.TestResult{TestID: 1})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("lists the tests oldest first", func() {
+		store := api.NewTestStore()
+		Expect(store.AddTest(sharedapi.Test{ID: 2}, 1)).To(Succeed())
+		Expect(store.AddTest(sharedapi.Test{ID: 1}, 1)).To(Succeed())
+
+		runs := store.List()
+		Expect(runs).To(HaveLen(2))
+		Expect(runs[0].Test.ID).To(Equal(int64(1)))
+		Expect(runs[1].Test.ID).To(Equal(int64(2)))
+	})
+
+	It("returns the test that is running until every worker reported", func() {
+		store := api.NewTestStore()
+		now := time.Now()
+		Expect(store.AddTest(sharedapi.Test{
+			ID:        1,
+			Timeout:   sharedapi.Duration(time.Minute),
+			StartTime: now,
+		}, 2)).To(Succeed())
+
+		id, ok := store.Active(now)
+		Expect(ok).To(BeTrue())
+		Expect(id).To(Equal(int64(1)))
+
+		Expect(store.AddResult(sharedapi.TestResult{TestID: 1, WorkerID: "worker-0"})).To(Succeed())
+		_, ok = store.Active(now)
+		Expect(ok).To(BeTrue())
+
+		Expect(store.AddFailure(1, "worker-1", "failed")).To(Succeed())
+		_, ok = store.Active(now)
+		Expect(ok).To(BeFalse())
+	})
+
+	It("does not return a test once its timeout passed", func() {
+		store := api.NewTestStore()
+		now := time.Now()
+		Expect(store.AddTest(sharedapi.Test{
+			ID:        1,
+			Timeout:   sharedapi.Duration(time.Minute),
+			StartTime: now,
+		}, 1)).To(Succeed())
+
+		_, ok := store.Active(now.Add(time.Minute))
+		Expect(ok).To(BeFalse())
+	})
+
+	It("keeps only the most recent tests", func() {
+		store := api.NewTestStore(api.WithMaxTests(2))
+		for id := int64(1); id <= 3; id++ {
+			Expect(store.AddTest(sharedapi.Test{ID: id}, 1)).To(Succeed())
+		}
+
+		var ids []int64
+		for _, run := range store.List() {
+			ids = append(ids, run.Test.ID)
+		}
+		Expect(ids).To(Equal([]int64{2, 3}))
+		_, ok := store.Get(1)
+		Expect(ok).To(BeFalse())
+	})
+
+	Context("with a file", func() {
+		var path string
+
+		BeforeEach(func() {
+			dir, err := os.MkdirTemp("", "test-store")
+			Expect(err).ToNot(HaveOccurred())
+			path = filepath.Join(dir, "results.json")
+		})
+
+		AfterEach(func() {
+			_ = os.RemoveAll(filepath.Dir(path))
+		})
+
+		It("loads the history written by a previous store", func() {
+			store, err := api.NewFileTestStore(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(store.AddTest(sharedapi.Test{ID: 1, Cycles: 10, Delay: sharedapi.Duration(1000)}, 1)).To(Succeed())
+			Expect(store.AddResult(sharedapi.TestResult{TestID: 1, WorkerID: "worker-0", ReceivedLogCount: 5})).To(Succeed())
+
+			reloaded, err := api.NewFileTestStore(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reloaded.List()).To(Equal(store.List()))
+		})
+
+		It("keeps only the most recent tests of the file", func() {
+			store, err := api.NewFileTestStore(path)
+			Expect(err).ToNot(HaveOccurred())
+			for id := int64(1); id <= 3; id++ {
+				Expect(store.AddTest(sharedapi.Test{ID: id}, 1)).To(Succeed())
+			}
+
+			reloaded, err := api.NewFileTestStore(path, api.WithMaxTests(1))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(reloaded.List()).To(HaveLen(1))
+			Expect(reloaded.List()[0].Test.ID).To(Equal(int64(3)))
+		})
+
+		It("returns an error for a corrupt file", func() {
+			Expect(os.WriteFile(path, []byte("{"), 0600)).To(Succeed())
+
+			_, err := api.NewFileTestStore(path)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -1,33 +1,150 @@
 package api
 
 import (
+	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
+	"sort"
 	"sync"
+	"time"
 
 	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
 
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+// The default CheckOrigin rejects browsers on other origins. Workers do not
+// send an Origin header.
+var upgrader = websocket.Upgrader{}
+
+// ErrNoWorkers is returned by Run when no workers are connected. The test
+// was not sent to any worker, so it is safe to run it again.
+var ErrNoWorkers = errors.New("you don't have any connections")
+
+// WorkerState is the state of the last test a worker was sent.
+type WorkerState string
+
+const (
+	WorkerIdle     WorkerState = "idle"
+	WorkerStarting WorkerState = "starting"
+	WorkerAccepted WorkerState = "accepted"
+	WorkerPrimed   WorkerState = "primed"
+	WorkerFinished WorkerState = "finished"
+	WorkerFailed   WorkerState = "failed"
+)
+
+// WorkerStatus describes a connected worker.
+type WorkerStatus struct {
+	ID       string      `json:"id"`
+	State    WorkerState `json:"state"`
+	TestID   int64       `json:"test_id,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	LastSeen time.Time   `json:"last_seen"`
 }
 
 // WorkerHandler is a websocket handler that waits for Worker connections.
 // It keeps track of each connection, so that when a test is started (via
 // Run()), it can tell each connection about the test.
+//
+// Workers report the progress and results of their tests back over the same
+// connection. The results are recorded in the WorkerHandler's TestStore.
+// Both sides send heartbeats, and a worker that has not sent anything for
+// three heartbeat intervals is dropped.
 type WorkerHandler struct {
+	heartbeatInterval time.Duration
+	ackTimeout        time.Duration
+	store             *TestStore
+	secret            string
+	apiToken          string
+
 	mu    sync.RWMutex
-	conns map[*websocket.Conn]struct{}
+	conns map[*websocket.Conn]*workerConn
+	acks  map[int64]chan struct{}
+}
+
+type workerConn struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	// authenticated is set when the worker's ID comes from its token.
+	authenticated bool
+	// status is guarded by the WorkerHandler's mutex.
+	status WorkerStatus
+}
+
+func (c *workerConn) write(msg sharedapi.Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.conn.WriteJSON(&msg)
+}
+
+// WorkerHandlerOption configures a WorkerHandler.
+type WorkerHandlerOption func(*WorkerHandler)
+
+// WithTestStore sets the TestStore the tests and their results are recorded
+// in. Defaults to an in-memory TestStore.
+func WithTestStore(s *TestStore) WorkerHandlerOption {
+	return func(h *WorkerHandler) {
+		h.store = s
+	}
+}
+
+// WithHeartbeatInterval sets how often heartbeats are sent to the workers.
+// Defaults to 10 seconds.
+func WithHeartbeatInterval(d time.Duration) WorkerHandlerOption {
+	return func(h *WorkerHandler) {
+		h.heartbeatInterval = d
+	}
+}
+
+// WithAckTimeout sets how long Run waits for the workers to accept a test.
+// Defaults to 2 seconds.
+func WithAckTimeout(d time.Duration) WorkerHandlerOption {
+	return func(h *WorkerHandler) {
+		h.ackTimeout = d
+	}
+}
+
+// WithWorkerSecret requires the workers to connect with a token signed
+// with the given secret (see sharedapi.SignWorkerToken) as a bearer token.
+// The ID in the token is the ID of the worker. Defaults to accepting every
+// worker.
+func WithWorkerSecret(secret string) WorkerHandlerOption {
+	return func(h *WorkerHandler) {
+		h.secret = secret
+	}
+}
+
+// WithAPIToken requires the requests for the status of the workers to carry
+// the given bearer token. Defaults to serving the status to everyone.
+func WithAPIToken(token string) WorkerHandlerOption {
+	return func(h *WorkerHandler) {
+		h.apiToken = token
+	}
 }
 
 // NewWorkerHandler builds a new WorkerHandler.
-func NewWorkerHandler() *WorkerHandler {
-	return &WorkerHandler{
-		conns: make(map[*websocket.Conn]struct{}),
+func NewWorkerHandler(opts ...WorkerHandlerOption) *WorkerHandler {
+	h := &WorkerHandler{
+		heartbeatInterval: 10 * time.Second,
+		ackTimeout:        2 * time.Second,
+		store:             NewTestStore(),
+		conns:             make(map[*websocket.Conn]*workerConn),
+		acks:              make(map[int64]chan struct{}),
 	}
+
+	for _, o := range opts {
+		o(h)
+	}
+
+	return h
+}
+
+// TestStore returns the TestStore the tests and their results are recorded
+// in.
+func (s *WorkerHandler) TestStore() *TestStore {
+	return s.store
 }
 
 func (s *WorkerHandler) ConnCount() int {
@@ -37,18 +154,49 @@ func (s *WorkerHandler) ConnCount() int {
 	return len(s.conns)
 }
 
-// Run writes the test information to each websocket connection.
-func (s *WorkerHandler) Run(t *sharedapi.Test) (int, error) {
-	var conns []*websocket.Conn
+// ActiveTest returns the ID of the test the workers are running, if any.
+func (s *WorkerHandler) ActiveTest() (int64, bool) {
+	return s.store.Active(time.Now())
+}
+
+// Workers returns the status of every connected worker, ordered by ID.
+func (s *WorkerHandler) Workers() []WorkerStatus {
 	s.mu.RLock()
-	for conn := range s.conns {
-		conns = append(conns, conn)
+	defer s.mu.RUnlock()
+
+	statuses := make([]WorkerStatus, 0, len(s.conns))
+	for _, wc := range s.conns {
+		statuses = append(statuses, wc.status)
 	}
-	s.mu.RUnlock()
 
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ID < statuses[j].ID
+	})
+
+	return statuses
+}
+
+// Run writes the test information to each websocket connection. It returns
+// the number of workers that accepted the test within the ack timeout.
+func (s *WorkerHandler) Run(t *sharedapi.Test) (int, error) {
+	var conns []*workerConn
+	s.mu.Lock()
+	for _, wc := range s.conns {
+		conns = append(conns, wc)
+	}
 	if len(conns) == 0 {
-		return 0, errors.New("you don't have any connections")
+		s.mu.Unlock()
+		return 0, ErrNoWorkers
 	}
+	acks := make(chan struct{}, len(conns))
+	s.acks[t.ID] = acks
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.acks, t.ID)
+		s.mu.Unlock()
+	}()
 
 	// Ensure each worker only writes the number of logs to stdout that will
 	// equate to the desired count.
@@ -56,23 +204,110 @@ func (s *WorkerHandler) Run(t *sharedapi.Test) (int, error) {
 	remainder := t.Cycles % uint64(len(conns))
 
 	var writeCount int
-	for i, c := range conns {
+	for i, wc := range conns {
 		if i == len(conns)-1 {
 			t.WriteCycles += remainder
 		}
-		err := c.WriteJSON(&t)
+
+		// The state is set before writing, as the worker might accept the
+		// test before the write returns.
+		s.mu.Lock()
+		wc.setState(t.ID, WorkerStarting, "")
+		s.mu.Unlock()
+
+		err := wc.write(sharedapi.Message{
+			Type: sharedapi.StartTestMessage,
+			Test: t,
+		})
 		if err != nil {
 			log.Printf("Failed emit test: %s", err)
+
+			s.mu.Lock()
+			wc.setState(t.ID, WorkerFailed, err.Error())
+			s.mu.Unlock()
 			continue
 		}
 
 		writeCount++
 	}
-	return writeCount, nil
+
+	if writeCount == 0 {
+		return 0, errors.New("failed to send the test to any worker")
+	}
+
+	// WriteCycles differs per worker, the results hold each one.
+	recorded := *t
+	recorded.WriteCycles = 0
+
+	err := s.store.AddTest(recorded, writeCount)
+	if err != nil {
+		log.Printf("failed to record test: %s", err)
+	}
+
+	started := s.awaitAcks(acks, writeCount)
+
+	err = s.store.SetWorkers(t.ID, started)
+	if err != nil {
+		log.Printf("failed to record test: %s", err)
+	}
+
+	if started == 0 {
+		return 0, errors.New("no worker accepted the test")
+	}
+
+	return started, nil
 }
 
-// ServeHTTP implements http.Handler. It only accepts websocket connections.
+func (s *WorkerHandler) awaitAcks(acks <-chan struct{}, expected int) int {
+	timeout := time.NewTimer(s.ackTimeout)
+	defer timeout.Stop()
+
+	var started int
+	for started < expected {
+		select {
+		case <-acks:
+			started++
+		case <-timeout.C:
+			log.Printf("%d of %d workers accepted the test", started, expected)
+			return started
+		}
+	}
+
+	return started
+}
+
+// ServeHTTP implements http.Handler. It accepts websocket connections from
+// workers. Any other GET request gets the status of the connected workers.
 func (s *WorkerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && !websocket.IsWebSocketUpgrade(r) {
+		var status http.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			writeJSON(w, s.Workers())
+		})
+		if s.apiToken != "" {
+			status = RequireBearerToken(s.apiToken, status)
+		}
+		status.ServeHTTP(w, r)
+		return
+	}
+
+	var workerID string
+	if s.secret != "" {
+		token, ok := bearerToken(r)
+		if !ok {
+			log.Println("rejected worker without a token")
+			unauthorized(w, "missing worker token")
+			return
+		}
+
+		var err error
+		workerID, err = sharedapi.VerifyWorkerToken(s.secret, token, time.Now())
+		if err != nil {
+			log.Printf("rejected worker: %s", err)
+			unauthorized(w, "invalid worker token: "+err.Error())
+			return
+		}
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("failed to upgrade request to WS: %s", err)
@@ -81,11 +316,24 @@ func (s *WorkerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer conn.Close() //nolint:errcheck
 
+	wc := &workerConn{
+		conn:          conn,
+		authenticated: workerID != "",
+		status: WorkerStatus{
+			ID:       workerID,
+			State:    WorkerIdle,
+			LastSeen: time.Now(),
+		},
+	}
+
 	s.mu.Lock()
-	s.conns[conn] = struct{}{}
+	s.conns[conn] = wc
 	s.mu.Unlock()
 
+	done := make(chan struct{})
 	defer func() {
+		close(done)
+
 		s.mu.Lock()
 		defer s.mu.Unlock()
 
@@ -96,11 +344,106 @@ func (s *WorkerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	log.Println("worker has connected")
 
+	go s.sendHeartbeats(wc, done)
+
 	for {
-		_, _, err := conn.ReadMessage()
+		err := conn.SetReadDeadline(time.Now().Add(3 * s.heartbeatInterval))
+		if err != nil {
+			log.Printf("failed to set read deadline: %s", err)
+			break
+		}
+
+		_, data, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("read failed: %s", err)
 			break
 		}
+
+		s.handleMessage(wc, data)
 	}
 }
+
+func (s *WorkerHandler) sendHeartbeats(wc *workerConn, done <-chan struct{}) {
+	ticker := time.NewTicker(s.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			err := wc.write(sharedapi.Message{Type: sharedapi.HeartbeatMessage})
+			if err != nil {
+				log.Printf("failed to send heartbeat: %s", err)
+				return
+			}
+		}
+	}
+}
+
+func (s *WorkerHandler) handleMessage(wc *workerConn, data []byte) {
+	var msg sharedapi.Message
+	err := json.Unmarshal(data, &msg)
+	if err != nil {
+		log.Printf("failed to decode message from worker: %s", err)
+		return
+	}
+
+	s.mu.Lock()
+	wc.status.LastSeen = time.Now()
+	if wc.authenticated {
+		// The token is the proof of the worker's ID, not the message.
+		msg.WorkerID = wc.status.ID
+		if msg.Result != nil {
+			msg.Result.WorkerID = wc.status.ID
+		}
+	} else if msg.WorkerID != "" {
+		wc.status.ID = msg.WorkerID
+	}
+
+	switch msg.Type {
+	case sharedapi.HeartbeatMessage:
+	case sharedapi.TestAcceptedMessage:
+		wc.setState(msg.TestID, WorkerAccepted, "")
+		if acks, ok := s.acks[msg.TestID]; ok {
+			select {
+			case acks <- struct{}{}:
+			default:
+			}
+		}
+	case sharedapi.TestPrimedMessage:
+		wc.setState(msg.TestID, WorkerPrimed, "")
+	case sharedapi.TestFinishedMessage:
+		wc.setState(msg.TestID, WorkerFinished, "")
+	case sharedapi.TestFailedMessage:
+		wc.setState(msg.TestID, WorkerFailed, msg.Error)
+	default:
+		log.Printf("unknown message type from worker: %q", msg.Type)
+	}
+	s.mu.Unlock()
+
+	switch msg.Type {
+	case sharedapi.TestFinishedMessage:
+		if msg.Result == nil {
+			log.Println("test finished message without a result")
+			return
+		}
+
+		err = s.store.AddResult(*msg.Result)
+		if err != nil {
+			log.Printf("failed to record test result: %s", err)
+		}
+	case sharedapi.TestFailedMessage:
+		err = s.store.AddFailure(msg.TestID, msg.WorkerID, msg.Error)
+		if err != nil {
+			log.Printf("failed to record test failure: %s", err)
+		}
+	}
+}
+
+// setState must be called with the WorkerHandler's mutex held.
+func (c *workerConn) setState(testID int64, state WorkerState, errMsg string) {
+	c.status.State = state
+	c.status.TestID = testID
+	c.status.Error = errMsg
+}
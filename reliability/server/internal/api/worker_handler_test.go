@@ -1,8 +1,13 @@
 package api_test
 
 import (
+	"encoding/json"
+	"io"
+	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
+	"time"
 
 	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
 	"code.cloudfoundry.org/loggregator-tools/reliability/server/internal/api"
@@ -100,24 +105,250 @@ var _ = Describe("WorkerServer", func() {
 		Consistently(clientA.tests).ShouldNot(Receive())
 	})
 
+	It("records tests and the results the clients send back", func() {
+		handler := api.NewWorkerHandler()
+		server := httptest.NewServer(handler)
+
+		client, err := newFakeClient(strings.Replace(server.URL, "http", "ws", 1))
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(handler.ConnCount).Should(Equal(1))
+
+		_, err = handler.Run(&sharedapi.Test{ID: 1, Cycles: 100})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(client.tests).Should(Receive())
+
+		err = client.send(sharedapi.Message{
+			Type:   sharedapi.TestFinishedMessage,
+			TestID: 1,
+			Result: &sharedapi.TestResult{
+				TestID:           1,
+				WorkerID:         "worker-0",
+				WriteCycles:      100,
+				ReceivedLogCount: 90,
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() uint64 {
+			run, _ := handler.TestStore().Get(1)
+			return run.ReceivedLogCount
+		}).Should(Equal(uint64(90)))
+	})
+
+	It("returns the number of clients that accepted the test", func() {
+		handler := api.NewWorkerHandler(api.WithAckTimeout(100 * time.Millisecond))
+		server := httptest.NewServer(handler)
+
+		_, err := newFakeClient(strings.Replace(server.URL, "http", "ws", 1))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = newFakeClientWithAck(strings.Replace(server.URL, "http", "ws", 1), false)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(handler.ConnCount).Should(Equal(2))
+
+		n, err := handler.Run(&sharedapi.Test{ID: 1})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(n).To(Equal(1))
+
+		run, _ := handler.TestStore().Get(1)
+		Expect(run.Workers).To(Equal(1))
+	})
+
+	It("returns an error when no client accepts the test", func() {
+		handler := api.NewWorkerHandler(api.WithAckTimeout(100 * time.Millisecond))
+		server := httptest.NewServer(handler)
+
+		client, err := newFakeClientWithAck(strings.Replace(server.URL, "http", "ws", 1), false)
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(handler.ConnCount).Should(Equal(1))
+
+		n, err := handler.Run(&sharedapi.Test{ID: 1})
+		Expect(err).To(HaveOccurred())
+		Expect(n).To(Equal(0))
+		Eventually(client.tests).Should(Receive())
+	})
+
+	It("tracks the state of each client", func() {
+		handler := api.NewWorkerHandler()
+		server := httptest.NewServer(handler)
+
+		client, err := newFakeClient(strings.Replace(server.URL, "http", "ws", 1))
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(handler.ConnCount).Should(Equal(1))
+		Expect(handler.Workers()[0].State).To(Equal(api.WorkerIdle))
+
+		_, err = handler.Run(&sharedapi.Test{ID: 1})
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() api.WorkerState {
+			return handler.Workers()[0].State
+		}).Should(Equal(api.WorkerAccepted))
+		Expect(handler.Workers()[0].ID).To(Equal("fake-worker"))
+		Expect(handler.Workers()[0].TestID).To(Equal(int64(1)))
+
+		Expect(client.send(sharedapi.Message{Type: sharedapi.TestPrimedMessage, TestID: 1})).To(Succeed())
+		Eventually(func() api.WorkerState {
+			return handler.Workers()[0].State
+		}).Should(Equal(api.WorkerPrimed))
+
+		Expect(client.send(sharedapi.Message{
+			Type:     sharedapi.TestFailedMessage,
+			WorkerID: "fake-worker",
+			TestID:   1,
+			Error:    "failed to prime",
+		})).To(Succeed())
+		Eventually(func() api.WorkerState {
+			return handler.Workers()[0].State
+		}).Should(Equal(api.WorkerFailed))
+		Expect(handler.Workers()[0].Error).To(Equal("failed to prime"))
+
+		run, _ := handler.TestStore().Get(1)
+		Expect(run.Failures).To(ConsistOf(api.WorkerFailure{
+			WorkerID: "fake-worker",
+			Error:    "failed to prime",
+		}))
+	})
+
+	It("serves the state of the clients to non websocket requests", func() {
+		handler := api.NewWorkerHandler()
+		server := httptest.NewServer(handler)
+
+		_, err := newFakeClient(strings.Replace(server.URL, "http", "ws", 1))
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(handler.ConnCount).Should(Equal(1))
+
+		resp, err := http.Get(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close() //nolint:errcheck
+
+		var statuses []api.WorkerStatus
+		Expect(json.NewDecoder(resp.Body).Decode(&statuses)).To(Succeed())
+		Expect(statuses).To(HaveLen(1))
+		Expect(statuses[0].State).To(Equal(api.WorkerIdle))
+	})
+
+	It("requires the api token for the state of the clients", func() {
+		server := httptest.NewServer(api.NewWorkerHandler(api.WithAPIToken("token")))
+		defer server.Close()
+
+		resp, err := http.Get(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		_ = resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+		req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.Header.Set("Authorization", "Bearer token")
+		resp, err = http.DefaultClient.Do(req)
+		Expect(err).ToNot(HaveOccurred())
+		_ = resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+
+	It("sends heartbeats and drops clients that stop sending them", func() {
+		handler := api.NewWorkerHandler(api.WithHeartbeatInterval(10 * time.Millisecond))
+		server := httptest.NewServer(handler)
+
+		conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(server.URL, "http", "ws", 1), nil)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close() //nolint:errcheck
+		Eventually(handler.ConnCount).Should(Equal(1))
+
+		var msg sharedapi.Message
+		Expect(conn.ReadJSON(&msg)).To(Succeed())
+		Expect(msg.Type).To(Equal(sharedapi.HeartbeatMessage))
+
+		Eventually(handler.ConnCount).Should(Equal(0))
+	})
+
 	Context("with no connections", func() {
 		It("return an error", func() {
 			handler := api.NewWorkerHandler()
 			n, err := handler.Run(&sharedapi.Test{})
-			Expect(err).To(HaveOccurred())
+			Expect(err).To(MatchError(api.ErrNoWorkers))
 			Expect(n).To(Equal(0))
 		})
 	})
+
+	Context("with a worker secret", func() {
+		var (
+			handler *api.WorkerHandler
+			server  *httptest.Server
+			addr    string
+		)
+
+		BeforeEach(func() {
+			handler = api.NewWorkerHandler(api.WithWorkerSecret("secret"))
+			server = httptest.NewServer(handler)
+			addr = strings.Replace(server.URL, "http", "ws", 1)
+		})
+
+		AfterEach(func() {
+			server.CloseClientConnections()
+			server.Close()
+		})
+
+		dial := func(token string) (*websocket.Conn, *http.Response, error) {
+			header := http.Header{}
+			if token != "" {
+				header.Set("Authorization", "Bearer "+token)
+			}
+			return websocket.DefaultDialer.Dial(addr, header)
+		}
+
+		It("rejects workers without a token", func() {
+			_, resp, err := dial("")
+			Expect(err).To(MatchError(websocket.ErrBadHandshake))
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+			body, _ := io.ReadAll(resp.Body)
+			Expect(string(body)).To(ContainSubstring("missing worker token"))
+			Expect(handler.ConnCount()).To(BeZero())
+		})
+
+		It("rejects workers with a token signed with another secret", func() {
+			_, resp, err := dial(sharedapi.SignWorkerToken("wrong", "worker-0", time.Now()))
+			Expect(err).To(MatchError(websocket.ErrBadHandshake))
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+			body, _ := io.ReadAll(resp.Body)
+			Expect(string(body)).To(ContainSubstring("invalid worker token: invalid signature"))
+		})
+
+		It("identifies workers by the ID in their token", func() {
+			conn, _, err := dial(sharedapi.SignWorkerToken("secret", "worker-0", time.Now()))
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close() //nolint:errcheck
+
+			Expect(conn.WriteJSON(&sharedapi.Message{
+				Type:     sharedapi.HeartbeatMessage,
+				WorkerID: "someone-else",
+			})).To(Succeed())
+
+			Eventually(handler.Workers).Should(HaveLen(1))
+			Consistently(func() string {
+				return handler.Workers()[0].ID
+			}).Should(Equal("worker-0"))
+		})
+	})
 })
 
 type fakeClient struct {
 	tests chan sharedapi.Test
 	conn  *websocket.Conn
+	ack   bool
+
+	writeMu sync.Mutex
 }
 
 func newFakeClient(addr string) (*fakeClient, error) {
+	return newFakeClientWithAck(addr, true)
+}
+
+// newFakeClientWithAck builds a fakeClient that accepts the tests it
+// receives if ack is true.
+func newFakeClientWithAck(addr string, ack bool) (*fakeClient, error) {
 	client := &fakeClient{
 		tests: make(chan sharedapi.Test, 100),
+		ack:   ack,
 	}
 
 	conn, _, err := websocket.DefaultDialer.Dial(addr, nil)
@@ -129,19 +360,38 @@ func newFakeClient(addr string) (*fakeClient, error) {
 
 	go func() {
 		for {
-			var test sharedapi.Test
-			err := conn.ReadJSON(&test)
+			var msg sharedapi.Message
+			err := conn.ReadJSON(&msg)
 			if err != nil {
 				break
 			}
 
-			client.tests <- test
+			if msg.Type != sharedapi.StartTestMessage {
+				continue
+			}
+
+			if client.ack {
+				_ = client.send(sharedapi.Message{
+					Type:     sharedapi.TestAcceptedMessage,
+					WorkerID: "fake-worker",
+					TestID:   msg.Test.ID,
+				})
+			}
+
+			client.tests <- *msg.Test
 		}
 	}()
 
 	return client, nil
 }
 
+func (f *fakeClient) send(msg sharedapi.Message) error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	return f.conn.WriteJSON(&msg)
+}
+
 func (f *fakeClient) Close() {
 	_ = f.conn.Close()
 }
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"code.cloudfoundry.org/loggregator-tools/reliability/server/internal/api"
@@ -11,13 +14,80 @@ import (
 
 func main() {
 	port := os.Getenv("PORT")
+	apiToken := os.Getenv("API_TOKEN")
+	workerSecret := os.Getenv("WORKER_SECRET")
 
-	workerHandler := api.NewWorkerHandler()
+	// Authentication is opt-in, so existing deployments keep working.
+	if apiToken == "" {
+		log.Println("WARNING: API_TOKEN is not set, anyone can start tests, pause schedules and see the workers")
+	}
 
-	http.Handle("/tests", api.NewCreateTestHandler(workerHandler, 5*time.Second))
+	if workerSecret == "" {
+		log.Println("WARNING: WORKER_SECRET is not set, any client can connect as a worker")
+	}
+
+	var storeOpts []api.TestStoreOption
+	if maxTests := os.Getenv("MAX_TESTS"); maxTests != "" {
+		n, err := strconv.Atoi(maxTests)
+		if err != nil || n < 1 {
+			log.Fatalf("invalid MAX_TESTS: %q", maxTests)
+		}
+		storeOpts = append(storeOpts, api.WithMaxTests(n))
+	}
+
+	store := api.NewTestStore(storeOpts...)
+	if resultsFile := os.Getenv("RESULTS_FILE"); resultsFile != "" {
+		var err error
+		store, err = api.NewFileTestStore(resultsFile, storeOpts...)
+		if err != nil {
+			log.Fatalf("failed to load RESULTS_FILE: %s", err)
+		}
+	}
+
+	workerHandler := api.NewWorkerHandler(
+		api.WithTestStore(store),
+		api.WithWorkerSecret(workerSecret),
+		api.WithAPIToken(apiToken),
+	)
+	historyHandler := api.NewTestHistoryHandler(store)
+
+	http.Handle("POST /tests", requireToken(
+		apiToken,
+		api.NewCreateTestHandler(workerHandler, 5*time.Second),
+	))
+	http.Handle("GET /tests", historyHandler)
+	http.Handle("GET /tests/{id}", historyHandler)
 	http.Handle("/workers", workerHandler)
+	http.Handle("GET /{$}", api.NewDashboardHandler())
+
+	var schedules []api.Schedule
+	if s := os.Getenv("SCHEDULES"); s != "" {
+		err := json.Unmarshal([]byte(s), &schedules)
+		if err != nil {
+			log.Fatalf("failed to decode SCHEDULES: %s", err)
+		}
+	}
+
+	scheduler, err := api.NewScheduler(workerHandler, workerHandler, schedules)
+	if err != nil {
+		log.Fatalf("invalid SCHEDULES: %s", err)
+	}
+	go scheduler.Run(context.Background())
+
+	scheduleHandler := api.NewScheduleHandler(scheduler)
+	http.Handle("GET /schedules", scheduleHandler)
+	http.Handle("POST /schedules/{name}/{action}", requireToken(apiToken, scheduleHandler))
 
 	addr := ":" + port
 	log.Printf("server started on %s", addr)
 	log.Println(http.ListenAndServe(addr, nil))
 }
+
+// requireToken protects the handler with the token, unless it is empty.
+func requireToken(token string, h http.Handler) http.Handler {
+	if token == "" {
+		return h
+	}
+
+	return api.RequireBearerToken(token, h)
+}
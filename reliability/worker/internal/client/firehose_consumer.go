@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/cloudfoundry/noaa/v2/consumer"
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+// FirehoseConsumer consumes the v1 firehose via noaa. Each stream gets its
+// own noaa consumer, so closing it does not affect other tests.
+type FirehoseConsumer struct {
+	addr      string
+	tlsConfig *tls.Config
+}
+
+// NewFirehoseConsumer builds a new FirehoseConsumer.
+func NewFirehoseConsumer(addr string, tlsConfig *tls.Config) *FirehoseConsumer {
+	return &FirehoseConsumer{
+		addr:      addr,
+		tlsConfig: tlsConfig,
+	}
+}
+
+// Consume implements Consumer.
+func (c *FirehoseConsumer) Consume(
+	ctx context.Context,
+	subscriptionID string,
+	token string,
+) (<-chan *events.Envelope, <-chan error) {
+	cnsmr := consumer.New(c.addr, c.tlsConfig, nil)
+	msgs, errs := cnsmr.FirehoseWithoutReconnect(subscriptionID, token)
+
+	go func() {
+		<-ctx.Done()
+		cnsmr.Close() //nolint:errcheck
+	}()
+
+	return msgs, errs
+}
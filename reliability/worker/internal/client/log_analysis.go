@@ -0,0 +1,214 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-tools/reliability/worker/internal/reporter"
+)
+
+// maxMissingRanges limits how many missing ranges are reported, so a test
+// with heavy loss does not produce a huge result.
+const maxMissingRanges = 100
+
+// formatTestLog builds a test log line. Besides the test prefix it holds
+// the sender, the sequence number of the log out of the sender's total
+// and the time it was emitted, e.g.
+//
+//	blackbox-test-1 - TEST 5f3a 41/1000 1700000000000000000
+func formatTestLog(prefix []byte, sender string, seq, total uint64, emitted time.Time) string {
+	return fmt.Sprintf("%s %s %d/%d %d", prefix, sender, seq, total, emitted.UnixNano())
+}
+
+// logAnalyzer tracks the test logs a worker receives. It finds the
+// sequence numbers that were never received, the logs that were received
+// more than once or out of order, and how long each log took to arrive.
+// When the workers share a subscription each one only receives part of
+// the logs, so the missing logs of one worker include the logs the others
+// received. Those analyzers do not look for missing logs.
+type logAnalyzer struct {
+	prefix      []byte
+	expected    uint64
+	findMissing bool
+	senders     map[string]*senderState
+	// unique is the number of distinct sequence numbers received.
+	unique     uint64
+	duplicates uint64
+	outOfOrder uint64
+	latencies  []time.Duration
+}
+
+type senderState struct {
+	total uint64
+	// seen is a bitset of the received sequence numbers.
+	seen    []uint64
+	maxSeq  uint64
+	anySeen bool
+}
+
+// newLogAnalyzer builds a logAnalyzer for the logs with the given prefix.
+// Expected is how many logs the senders write in total, so the logs of
+// senders that were never heard from are missing as well.
+func newLogAnalyzer(prefix []byte, expected uint64, findMissing bool) *logAnalyzer {
+	return &logAnalyzer{
+		prefix:      prefix,
+		expected:    expected,
+		findMissing: findMissing,
+		senders:     make(map[string]*senderState),
+	}
+}
+
+// observe records a received log. It returns true if the log is a test log
+// that was not received before. Test logs without a valid sequence number
+// can't be told apart, so they are counted as new but are not analyzed.
+func (a *logAnalyzer) observe(msg []byte, received time.Time) bool {
+	i := bytes.Index(msg, a.prefix)
+	if i < 0 {
+		return false
+	}
+
+	sender, seq, total, emitted, ok := parseTestLog(msg[i+len(a.prefix):])
+	if !ok {
+		return true
+	}
+
+	s, ok := a.senders[sender]
+	if !ok {
+		s = &senderState{
+			total: total,
+			seen:  make([]uint64, (total+63)/64),
+		}
+		a.senders[sender] = s
+	}
+	if seq >= s.total {
+		return true
+	}
+
+	word, bit := seq/64, uint64(1)<<(seq%64)
+	if s.seen[word]&bit != 0 {
+		a.duplicates++
+		return false
+	}
+	s.seen[word] |= bit
+	a.unique++
+
+	a.latencies = append(a.latencies, received.Sub(emitted))
+
+	if s.anySeen && seq < s.maxSeq {
+		a.outOfOrder++
+	}
+	if !s.anySeen || seq > s.maxSeq {
+		s.maxSeq = seq
+	}
+	s.anySeen = true
+
+	return true
+}
+
+func parseTestLog(msg []byte) (sender string, seq, total uint64, emitted time.Time, ok bool) {
+	fields := bytes.Fields(msg)
+	if len(fields) < 3 {
+		return "", 0, 0, time.Time{}, false
+	}
+
+	seqStr, totalStr, ok := bytes.Cut(fields[1], []byte("/"))
+	if !ok {
+		return "", 0, 0, time.Time{}, false
+	}
+
+	seq, err := strconv.ParseUint(string(seqStr), 10, 64)
+	if err != nil {
+		return "", 0, 0, time.Time{}, false
+	}
+
+	total, err = strconv.ParseUint(string(totalStr), 10, 64)
+	if err != nil || seq >= total {
+		return "", 0, 0, time.Time{}, false
+	}
+
+	nanos, err := strconv.ParseInt(string(fields[2]), 10, 64)
+	if err != nil {
+		return "", 0, 0, time.Time{}, false
+	}
+
+	return string(fields[0]), seq, total, time.Unix(0, nanos), true
+}
+
+// report adds the analysis to the given TestResult.
+func (a *logAnalyzer) report(r *reporter.TestResult) {
+	r.DuplicateLogCount = a.duplicates
+	r.OutOfOrderLogCount = a.outOfOrder
+
+	if a.findMissing {
+		a.reportMissing(r)
+	}
+
+	if len(a.latencies) == 0 {
+		return
+	}
+
+	sort.Slice(a.latencies, func(i, j int) bool {
+		return a.latencies[i] < a.latencies[j]
+	})
+	r.LatencyP50 = percentile(a.latencies, 50)
+	r.LatencyP90 = percentile(a.latencies, 90)
+	r.LatencyP99 = percentile(a.latencies, 99)
+	r.LatencyMax = a.latencies[len(a.latencies)-1]
+}
+
+func (a *logAnalyzer) reportMissing(r *reporter.TestResult) {
+	senders := make([]string, 0, len(a.senders))
+	for sender := range a.senders {
+		senders = append(senders, sender)
+	}
+	sort.Strings(senders)
+
+	for _, sender := range senders {
+		s := a.senders[sender]
+		for _, rng := range s.missing() {
+			r.MissingLogCount += rng.End - rng.Start + 1
+			if len(r.MissingRanges) < maxMissingRanges {
+				rng.Sender = sender
+				r.MissingRanges = append(r.MissingRanges, rng)
+			}
+		}
+	}
+
+	// Senders that were never heard from have no ranges, but their logs
+	// are missing from the expected total.
+	if a.expected > a.unique && a.expected-a.unique > r.MissingLogCount {
+		r.MissingLogCount = a.expected - a.unique
+	}
+}
+
+// missing returns the ranges of sequence numbers that were not received.
+func (s *senderState) missing() []reporter.SequenceRange {
+	var ranges []reporter.SequenceRange
+	for seq := uint64(0); seq < s.total; seq++ {
+		if s.seen[seq/64]&(uint64(1)<<(seq%64)) != 0 {
+			continue
+		}
+
+		if n := len(ranges); n > 0 && ranges[n-1].End == seq-1 {
+			ranges[n-1].End = seq
+			continue
+		}
+		ranges = append(ranges, reporter.SequenceRange{Start: seq, End: seq})
+	}
+
+	return ranges
+}
+
+// percentile returns the p-th percentile of the sorted durations using the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"github.com/cloudfoundry/sonde-go/events"
+)
+
+// LogCacheConsumer walks the logs of a source ID in Log Cache, usually the
+// worker app's own GUID. Log Cache has no notion of a subscription, so the
+// logs of every test of the source are returned and the runner filters
+// them by their content.
+type LogCacheConsumer struct {
+	addr         string
+	sourceID     string
+	doer         logcache.HTTPClient
+	pollInterval time.Duration
+}
+
+// NewLogCacheConsumer builds a new LogCacheConsumer. Log Cache is polled
+// every pollInterval for new logs.
+func NewLogCacheConsumer(
+	addr string,
+	sourceID string,
+	d logcache.HTTPClient,
+	pollInterval time.Duration,
+) *LogCacheConsumer {
+	return &LogCacheConsumer{
+		addr:         addr,
+		sourceID:     sourceID,
+		doer:         d,
+		pollInterval: pollInterval,
+	}
+}
+
+// Consume implements Consumer. The walk starts at the time Consume is
+// called, and the envelopes are converted to v1 log messages.
+func (c *LogCacheConsumer) Consume(
+	ctx context.Context,
+	_ string,
+	token string,
+) (<-chan *events.Envelope, <-chan error) {
+	msgs := make(chan *events.Envelope, 100)
+	errs := make(chan error, 1)
+
+	client := logcache.NewClient(
+		c.addr,
+		logcache.WithHTTPClient(&tokenDoer{token: token, doer: c.doer}),
+	)
+
+	go logcache.Walk(
+		ctx,
+		c.sourceID,
+		func(batch []*loggregator_v2.Envelope) bool {
+			return sendLogs(ctx, msgs, batch)
+		},
+		client.Read,
+		logcache.WithWalkStartTime(time.Now()),
+		logcache.WithWalkEnvelopeTypes(logcache_v1.EnvelopeType_LOG),
+		logcache.WithWalkBackoff(logcache.NewAlwaysRetryBackoff(c.pollInterval)),
+	)
+
+	return msgs, errs
+}
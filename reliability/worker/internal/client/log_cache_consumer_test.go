@@ -0,0 +1,94 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	"code.cloudfoundry.org/go-log-cache/v3/rpc/logcache_v1"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"github.com/cloudfoundry/sonde-go/events"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"code.cloudfoundry.org/loggregator-tools/reliability/worker/internal/client"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LogCacheConsumer", func() {
+	var (
+		reads    int64
+		requests chan *http.Request
+		server   *httptest.Server
+	)
+
+	BeforeEach(func() {
+		atomic.StoreInt64(&reads, 0)
+		requests = make(chan *http.Request, 100)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/v1/info" {
+				_, _ = w.Write([]byte(`{"version":"2.11.0"}`))
+				return
+			}
+			requests <- r
+
+			// Only the first read has logs, later ones are empty.
+			resp := &logcache_v1.ReadResponse{Envelopes: &loggregator_v2.EnvelopeBatch{}}
+			if atomic.AddInt64(&reads, 1) == 1 {
+				resp.Envelopes.Batch = []*loggregator_v2.Envelope{{
+					SourceId:  "app-guid",
+					Timestamp: time.Now().Add(-time.Second).UnixNano(),
+					Message: &loggregator_v2.Envelope_Log{
+						Log: &loggregator_v2.Log{Payload: []byte("sub-1 - TEST")},
+					},
+				}}
+			}
+
+			body, err := protojson.Marshal(resp)
+			Expect(err).ToNot(HaveOccurred())
+			_, _ = w.Write(body)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("walks the logs of the source ID as v1 log messages", func() {
+		consumer := client.NewLogCacheConsumer(server.URL, "app-guid", http.DefaultClient, 10*time.Millisecond)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		msgs, _ := consumer.Consume(ctx, "sub-1", "bearer token")
+
+		var r *http.Request
+		Eventually(requests).Should(Receive(&r))
+		Expect(r.URL.Path).To(Equal("/api/v1/read/app-guid"))
+		Expect(r.URL.Query().Get("envelope_types")).To(Equal("LOG"))
+		Expect(r.URL.Query().Get("start_time")).ToNot(BeEmpty())
+		Expect(r.Header.Get("Authorization")).To(Equal("bearer token"))
+
+		var e *events.Envelope
+		Eventually(msgs).Should(Receive(&e))
+		Expect(e.GetLogMessage().GetMessage()).To(Equal([]byte("sub-1 - TEST")))
+		Expect(e.GetLogMessage().GetAppId()).To(Equal("app-guid"))
+
+		Eventually(func() int64 { return atomic.LoadInt64(&reads) }).Should(BeNumerically(">", 2))
+	})
+
+	It("stops walking when the context is done", func() {
+		consumer := client.NewLogCacheConsumer(server.URL, "app-guid", http.DefaultClient, 10*time.Millisecond)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		_, _ = consumer.Consume(ctx, "sub-1", "bearer token")
+		Eventually(func() int64 { return atomic.LoadInt64(&reads) }).Should(BeNumerically(">", 1))
+		cancel()
+
+		time.Sleep(50 * time.Millisecond)
+		n := atomic.LoadInt64(&reads)
+		Consistently(func() int64 { return atomic.LoadInt64(&reads) }).Should(Equal(n))
+	})
+})
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"log"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
+)
+
+// logWriter writes the test logs of a worker at the rate of a LoadProfile.
+// Instead of sleeping between writes it tracks when each log is due since
+// the start, so the rate does not drift and a writer that fell behind
+// catches up.
+type logWriter struct {
+	// profile is nil when the logs are written as fast as possible.
+	profile *sharedapi.LoadProfile
+	sizes   []sharedapi.MessageSize
+
+	written   atomic.Uint64
+	lastWrite atomic.Int64
+}
+
+// newLogWriter builds a logWriter for the given test. A test without a
+// Load is written at a constant rate of one log per Delay.
+func newLogWriter(t *sharedapi.Test) *logWriter {
+	w := &logWriter{
+		profile: t.Load,
+	}
+
+	if t.Load != nil {
+		w.sizes = t.Load.Sizes
+	} else if t.Delay > 0 {
+		w.profile = &sharedapi.LoadProfile{
+			Type: sharedapi.ConstantLoad,
+			Rate: float64(time.Second) / float64(t.Delay),
+		}
+	}
+
+	return w
+}
+
+// write writes the given number of test logs. Each log is numbered, so the
+// receivers can tell which logs went missing.
+func (w *logWriter) write(prefix []byte, sender string, cycles uint64) {
+	start := time.Now()
+	for i := uint64(0); i < cycles; i++ {
+		if w.profile != nil && w.profile.Allowed(time.Since(start)) < float64(i+1) {
+			time.Sleep(time.Until(start.Add(w.profile.Due(i))))
+		}
+
+		log.Print(pad(formatTestLog(prefix, sender, i, cycles, time.Now()), w.size()))
+
+		w.lastWrite.Store(int64(time.Since(start)))
+		w.written.Add(1)
+	}
+}
+
+// rates returns the rate in logs per second the profile targets for the
+// given number of logs and the rate that was achieved so far. The target is
+// zero for logs written as fast as possible.
+func (w *logWriter) rates(cycles uint64) (target, achieved float64) {
+	if cycles > 1 && w.profile != nil {
+		if due := w.profile.Due(cycles - 1); due > 0 {
+			target = float64(cycles-1) / due.Seconds()
+		}
+	}
+
+	written := w.written.Load()
+	elapsed := time.Duration(w.lastWrite.Load())
+	if written > 1 && elapsed > 0 {
+		achieved = float64(written-1) / elapsed.Seconds()
+	}
+
+	return target, achieved
+}
+
+// size picks the size of the next log from the message size distribution.
+func (w *logWriter) size() int {
+	var total int
+	for _, s := range w.sizes {
+		total += s.Weight
+	}
+	if total == 0 {
+		return 0
+	}
+
+	n := rand.IntN(total)
+	for _, s := range w.sizes {
+		if n < s.Weight {
+			return s.Bytes
+		}
+		n -= s.Weight
+	}
+
+	return 0
+}
+
+// pad fills the log up to the given size.
+func pad(msg string, size int) string {
+	if len(msg)+1 >= size {
+		return msg
+	}
+
+	return msg + " " + strings.Repeat("x", size-len(msg)-1)
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	loggregator "code.cloudfoundry.org/go-loggregator/v10"
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"github.com/cloudfoundry/sonde-go/events"
+	"google.golang.org/protobuf/proto"
+)
+
+// RLPGatewayConsumer consumes the logs of every source from the v2 RLP
+// gateway. The gateway splits the envelopes of a shard across its
+// subscribers, so the shard ID is the subscription ID followed by the ID
+// of the worker. That way every worker receives all of the logs.
+type RLPGatewayConsumer struct {
+	addr     string
+	workerID string
+	doer     loggregator.Doer
+}
+
+// NewRLPGatewayConsumer builds a new RLPGatewayConsumer for the worker with
+// the given ID.
+func NewRLPGatewayConsumer(addr, workerID string, d loggregator.Doer) *RLPGatewayConsumer {
+	return &RLPGatewayConsumer{
+		addr:     addr,
+		workerID: workerID,
+		doer:     d,
+	}
+}
+
+// Consume implements Consumer. The envelopes are converted to v1 log
+// messages.
+func (c *RLPGatewayConsumer) Consume(
+	ctx context.Context,
+	subscriptionID string,
+	token string,
+) (<-chan *events.Envelope, <-chan error) {
+	msgs := make(chan *events.Envelope, 100)
+	errs := make(chan error, 1)
+
+	client := loggregator.NewRLPGatewayClient(
+		c.addr,
+		loggregator.WithRLPGatewayHTTPClient(&tokenDoer{token: token, doer: c.doer}),
+		loggregator.WithRLPGatewayErrChan(errs),
+	)
+
+	stream := client.Stream(ctx, &loggregator_v2.EgressBatchRequest{
+		ShardId: subscriptionID + "-" + c.workerID,
+		Selectors: []*loggregator_v2.Selector{
+			{Message: &loggregator_v2.Selector_Log{Log: &loggregator_v2.LogSelector{}}},
+		},
+	})
+
+	go func() {
+		for {
+			batch := stream()
+			if batch == nil {
+				return
+			}
+
+			if !sendLogs(ctx, msgs, batch) {
+				return
+			}
+		}
+	}()
+
+	return msgs, errs
+}
+
+// tokenDoer sets the Authorization header on every request.
+type tokenDoer struct {
+	token string
+	doer  loggregator.Doer
+}
+
+func (d *tokenDoer) Do(r *http.Request) (*http.Response, error) {
+	r.Header.Set("Authorization", d.token)
+	return d.doer.Do(r)
+}
+
+// sendLogs converts the log envelopes of the batch to v1 and sends them. It
+// returns false if the context is done.
+func sendLogs(ctx context.Context, msgs chan<- *events.Envelope, batch []*loggregator_v2.Envelope) bool {
+	for _, e := range batch {
+		if e.GetLog() == nil {
+			continue
+		}
+
+		select {
+		case msgs <- toV1Log(e):
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	return true
+}
+
+func toV1Log(e *loggregator_v2.Envelope) *events.Envelope {
+	msgType := events.LogMessage_OUT
+	if e.GetLog().GetType() == loggregator_v2.Log_ERR {
+		msgType = events.LogMessage_ERR
+	}
+
+	return &events.Envelope{
+		Origin:    proto.String(e.GetSourceId()),
+		EventType: events.Envelope_LogMessage.Enum(),
+		Timestamp: proto.Int64(e.GetTimestamp()),
+		LogMessage: &events.LogMessage{
+			Message:        e.GetLog().GetPayload(),
+			MessageType:    msgType.Enum(),
+			Timestamp:      proto.Int64(e.GetTimestamp()),
+			AppId:          proto.String(e.GetSourceId()),
+			SourceInstance: proto.String(e.GetInstanceId()),
+		},
+	}
+}
@@ -0,0 +1,100 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"github.com/cloudfoundry/sonde-go/events"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"code.cloudfoundry.org/loggregator-tools/reliability/worker/internal/client"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RLPGatewayConsumer", func() {
+	var (
+		requests chan *http.Request
+		server   *httptest.Server
+	)
+
+	BeforeEach(func() {
+		requests = make(chan *http.Request, 100)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests <- r
+
+			batch, err := protojson.Marshal(&loggregator_v2.EnvelopeBatch{
+				Batch: []*loggregator_v2.Envelope{
+					{
+						SourceId:  "app-guid",
+						Timestamp: 99,
+						Message: &loggregator_v2.Envelope_Log{
+							Log: &loggregator_v2.Log{Payload: []byte("sub-1 - TEST")},
+						},
+					},
+					{
+						SourceId: "app-guid",
+						Message: &loggregator_v2.Envelope_Counter{
+							Counter: &loggregator_v2.Counter{Name: "requests"},
+						},
+					},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", batch)
+			w.(http.Flusher).Flush()
+
+			<-r.Context().Done()
+		}))
+	})
+
+	AfterEach(func() {
+		server.CloseClientConnections()
+		server.Close()
+	})
+
+	It("streams the logs of the shard as v1 log messages", func() {
+		consumer := client.NewRLPGatewayConsumer(server.URL, "worker-0", http.DefaultClient)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		msgs, _ := consumer.Consume(ctx, "sub-1", "bearer token")
+
+		var r *http.Request
+		Eventually(requests).Should(Receive(&r))
+		Expect(r.URL.Path).To(Equal("/v2/read"))
+		Expect(r.URL.RawQuery).To(Equal("shard_id=sub-1-worker-0&log"))
+		Expect(r.Header.Get("Authorization")).To(Equal("bearer token"))
+
+		var e *events.Envelope
+		Eventually(msgs).Should(Receive(&e))
+		Expect(e.GetEventType()).To(Equal(events.Envelope_LogMessage))
+		Expect(e.GetLogMessage().GetMessage()).To(Equal([]byte("sub-1 - TEST")))
+		Expect(e.GetLogMessage().GetAppId()).To(Equal("app-guid"))
+		Expect(e.GetLogMessage().GetTimestamp()).To(Equal(int64(99)))
+		Consistently(msgs).ShouldNot(Receive())
+	})
+
+	It("uses a shard of its own for each worker", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		for _, id := range []string{"worker-0", "worker-1"} {
+			client.NewRLPGatewayConsumer(server.URL, id, http.DefaultClient).Consume(ctx, "sub-1", "bearer token")
+		}
+
+		var shards []string
+		for i := 0; i < 2; i++ {
+			var r *http.Request
+			Eventually(requests).Should(Receive(&r))
+			shards = append(shards, r.URL.Query().Get("shard_id"))
+		}
+		Expect(shards).To(ConsistOf("sub-1-worker-0", "sub-1-worker-1"))
+	})
+})
@@ -5,6 +5,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math/rand/v2"
+	"strconv"
 	"time"
 
 	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
@@ -25,97 +27,138 @@ type Authenticator interface {
 	Token() (string, error)
 }
 
-// Consumer is used to connect to a firehose.
+// Consumer is used to connect to a stream of logs.
 type Consumer interface {
-	// FirehoseWithoutReconnect establishes a firehose stream.
-	FirehoseWithoutReconnect(string, string) (<-chan *events.Envelope, <-chan error)
+	// Consume establishes a stream for the given subscription ID and token.
+	// The stream is closed when the given context is done.
+	Consume(ctx context.Context, subscriptionID, token string) (<-chan *events.Envelope, <-chan error)
 }
 
 // LogReliabilityTestRunner runs tests. Each test can be run in parallel to
 // each other, and the test result will be submitted to the given Reporter.
 // Tokens are required for the tests, which are fetched by the Authenticator.
+// Each test is consumed with the Consumer for its Mode.
 type LogReliabilityTestRunner struct {
 	loggregatorAddr      string
 	subscriptionIDPrefix string
 	authenticator        Authenticator
 	reporter             Reporter
-	consumer             Consumer
+	consumers            map[string]Consumer
 }
 
-// NewLogReliabilityTestRunner builds a new LogReliabilityTestRunner.
+// RunnerOption configures a LogReliabilityTestRunner.
+type RunnerOption func(*LogReliabilityTestRunner)
+
+// WithConsumer sets the Consumer for tests with the given Mode.
+func WithConsumer(mode string, c Consumer) RunnerOption {
+	return func(r *LogReliabilityTestRunner) {
+		r.consumers[mode] = c
+	}
+}
+
+// NewLogReliabilityTestRunner builds a new LogReliabilityTestRunner. The
+// given Consumer is used for tests with the firehose Mode.
 func NewLogReliabilityTestRunner(
 	loggregatorAddr string,
 	subscriptionIDPrefix string,
 	a Authenticator,
 	r Reporter,
 	c Consumer,
+	opts ...RunnerOption,
 ) *LogReliabilityTestRunner {
-	return &LogReliabilityTestRunner{
+	runner := &LogReliabilityTestRunner{
 		loggregatorAddr:      loggregatorAddr,
 		subscriptionIDPrefix: subscriptionIDPrefix,
 		authenticator:        a,
 		reporter:             r,
-		consumer:             c,
+		consumers: map[string]Consumer{
+			sharedapi.FirehoseMode: c,
+		},
+	}
+
+	for _, o := range opts {
+		o(runner)
 	}
+
+	return runner
 }
 
 // Run starts a new test. The test configuration is described by the Test
-// type. Each firehose connection has a shardID built by the test ID.
-func (r *LogReliabilityTestRunner) Run(t *sharedapi.Test) {
+// type. Each consumer connection has a shardID built by the test ID. The
+// primed func is called once the consumer connection receives logs. The
+// result is submitted to the Reporter and returned.
+func (r *LogReliabilityTestRunner) Run(t *sharedapi.Test, primed func()) (*reporter.TestResult, error) {
+	mode := t.Mode
+	if mode == "" {
+		mode = sharedapi.FirehoseMode
+	}
+
+	consumer, ok := r.consumers[mode]
+	if !ok {
+		return nil, fmt.Errorf("unsupported mode: %q", mode)
+	}
+
+	if t.Load != nil {
+		err := t.Load.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid load profile: %s", err)
+		}
+	}
+
 	subscriptionID := fmt.Sprint(r.subscriptionIDPrefix, t.ID)
 
 	authToken, err := r.authenticator.Token()
 	if err != nil {
-		log.Printf("failed to authenticate with UAA: %s", err)
-		return
+		return nil, fmt.Errorf("failed to authenticate with UAA: %s", err)
 	}
 
-	msgChan, errChan := r.consumer.FirehoseWithoutReconnect(subscriptionID, authToken)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	msgChan, errChan := consumer.Consume(ctx, subscriptionID, authToken)
 
 	if !prime(msgChan, errChan, subscriptionID) {
-		return
+		return nil, fmt.Errorf("failed to prime - %s", subscriptionID)
 	}
+	primed()
 
 	testLog := []byte(fmt.Sprintf("%s - TEST", subscriptionID))
-	go writeLogs(testLog, t.WriteCycles, time.Duration(t.Delay))
-
+	sender := strconv.FormatUint(rand.Uint64(), 36)
+	writer := newLogWriter(t)
+	go writer.write(testLog, sender, t.WriteCycles)
+
+	// The workers share the firehose subscription, so a single worker
+	// can't tell which logs were lost. In the other modes every worker
+	// reads all of the logs.
+	analyzer := newLogAnalyzer(testLog, t.Cycles, mode != sharedapi.FirehoseMode)
 	receivedLogCount, err := receiveLogs(
 		msgChan,
 		errChan,
-		testLog,
+		analyzer,
 		t.Cycles,
 		time.Duration(t.Timeout),
 		subscriptionID,
 	)
 	if err != nil {
-		log.Printf("Error receiving logs: %s", err)
-		return
+		return nil, fmt.Errorf("error receiving logs: %s", err)
 	}
 
-	err = r.reporter.Report(
-		reporter.NewTestResult(t, receivedLogCount),
-	)
+	result := reporter.NewTestResult(t, receivedLogCount)
+	analyzer.report(result)
+	result.TargetRate, result.AchievedRate = writer.rates(t.WriteCycles)
+	err = r.reporter.Report(result)
 	if err != nil {
+		// The result is still valid, only the Reporter missed it.
 		log.Printf("Error reporting: %s", err)
-		return
 	}
-}
 
-func writeLogs(
-	logMsg []byte,
-	cycles uint64,
-	delay time.Duration,
-) {
-	for i := uint64(0); i < cycles; i++ {
-		log.Printf("%s", logMsg)
-		time.Sleep(delay)
-	}
+	return result, nil
 }
 
 func receiveLogs(
 	msgChan <-chan *events.Envelope,
 	errChan <-chan error,
-	logMsg []byte,
+	analyzer *logAnalyzer,
 	logCycles uint64,
 	timeout time.Duration,
 	subscriptionID string,
@@ -137,8 +180,10 @@ func receiveLogs(
 
 			return 0, err
 		case msg := <-msgChan:
+			// Duplicates are not counted, so the test only ends once every
+			// distinct log arrived.
 			if msg.GetEventType() == events.Envelope_LogMessage {
-				if bytes.Contains(msg.GetLogMessage().GetMessage(), logMsg) {
+				if analyzer.observe(msg.GetLogMessage().GetMessage(), time.Now()) {
 					receivedLogCount++
 				}
 			}
@@ -1,6 +1,12 @@
 package client_test
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudfoundry/sonde-go/events"
@@ -38,15 +44,278 @@ var _ = Describe("Run()", func() {
 
 		spyConsumer.msgChan <- &primerLog
 
-		runner.Run(&sharedapi.Test{
+		var primed bool
+		result, err := runner.Run(&sharedapi.Test{
 			Cycles:    12413,
 			StartTime: startTime,
-		})
+		}, func() { primed = true })
+		Expect(err).ToNot(HaveOccurred())
+		Expect(primed).To(BeTrue())
 
 		Expect(spyRep.results.TestStartTime).To(Equal(startTime))
+		Expect(result.TestStartTime).To(Equal(startTime))
+	})
+
+	It("reports missing, duplicate and out of order logs", func() {
+		spyRep := &spyReporter{}
+		spyConsumer := NewSpyConsumer()
+		runner := client.NewLogReliabilityTestRunner(
+			"fh",
+			"subscriptionID",
+			&spyAuthenticator{},
+			spyRep,
+			NewSpyConsumer(),
+			client.WithConsumer(sharedapi.LogCacheMode, spyConsumer),
+		)
+
+		spyConsumer.msgChan <- primerLog("subscriptionID0 - PRIMER")
+		emitted := time.Now().Add(-100 * time.Millisecond).UnixNano()
+		for _, seq := range []int{0, 2, 2, 1, 5} {
+			spyConsumer.msgChan <- primerLog(
+				fmt.Sprintf("2024/01/01 00:00:00 subscriptionID0 - TEST a %d/6 %d\n", seq, emitted),
+			)
+		}
+		// Logs without a sequence number still count as received.
+		spyConsumer.msgChan <- primerLog("subscriptionID0 - TEST")
+
+		result, err := runner.Run(&sharedapi.Test{
+			Cycles:  6,
+			Timeout: sharedapi.Duration(500 * time.Millisecond),
+			Mode:    sharedapi.LogCacheMode,
+		}, func() {})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(result.ReceivedLogCount).To(Equal(uint64(5)))
+		Expect(result.MissingLogCount).To(Equal(uint64(2)))
+		Expect(result.MissingRanges).To(Equal([]reporter.SequenceRange{
+			{Sender: "a", Start: 3, End: 4},
+		}))
+		Expect(result.DuplicateLogCount).To(Equal(uint64(1)))
+		Expect(result.OutOfOrderLogCount).To(Equal(uint64(1)))
+		Expect(result.LatencyP50).To(BeNumerically(">=", 100*time.Millisecond))
+		Expect(result.LatencyP99).To(BeNumerically(">=", result.LatencyP50))
+		Expect(result.LatencyMax).To(BeNumerically(">=", result.LatencyP99))
+		Expect(spyRep.results.MissingLogCount).To(Equal(uint64(2)))
+	})
+
+	It("does not report missing logs in firehose mode", func() {
+		spyConsumer := NewSpyConsumer()
+		runner := client.NewLogReliabilityTestRunner(
+			"fh",
+			"subscriptionID",
+			&spyAuthenticator{},
+			&spyReporter{},
+			spyConsumer,
+		)
+
+		spyConsumer.msgChan <- primerLog("subscriptionID0 - PRIMER")
+		emitted := time.Now().UnixNano()
+		for _, seq := range []int{0, 2, 2} {
+			spyConsumer.msgChan <- primerLog(
+				fmt.Sprintf("subscriptionID0 - TEST a %d/6 %d", seq, emitted),
+			)
+		}
+
+		result, err := runner.Run(&sharedapi.Test{
+			Cycles:  3,
+			Timeout: sharedapi.Duration(500 * time.Millisecond),
+		}, func() {})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(result.MissingLogCount).To(BeZero())
+		Expect(result.MissingRanges).To(BeEmpty())
+		Expect(result.DuplicateLogCount).To(Equal(uint64(1)))
+	})
+
+	It("only counts and ends the test on distinct logs", func() {
+		spyConsumer := NewSpyConsumer()
+		runner := client.NewLogReliabilityTestRunner(
+			"fh",
+			"subscriptionID",
+			&spyAuthenticator{},
+			&spyReporter{},
+			spyConsumer,
+		)
+
+		spyConsumer.msgChan <- primerLog("subscriptionID0 - PRIMER")
+		emitted := time.Now().UnixNano()
+		for _, seq := range []int{0, 2, 2, 1} {
+			spyConsumer.msgChan <- primerLog(
+				fmt.Sprintf("subscriptionID0 - TEST a %d/3 %d", seq, emitted),
+			)
+		}
+
+		result, err := runner.Run(&sharedapi.Test{
+			Cycles:  3,
+			Timeout: sharedapi.Duration(time.Minute),
+		}, func() {})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(result.ReceivedLogCount).To(Equal(uint64(3)))
+		Expect(result.DuplicateLogCount).To(Equal(uint64(1)))
+		Expect(result.OutOfOrderLogCount).To(Equal(uint64(1)))
+	})
+
+	It("reports the logs of senders that sent nothing as missing", func() {
+		spyConsumer := NewSpyConsumer()
+		runner := client.NewLogReliabilityTestRunner(
+			"fh",
+			"subscriptionID",
+			&spyAuthenticator{},
+			&spyReporter{},
+			NewSpyConsumer(),
+			client.WithConsumer(sharedapi.LogCacheMode, spyConsumer),
+		)
+
+		spyConsumer.msgChan <- primerLog("subscriptionID0 - PRIMER")
+		emitted := time.Now().UnixNano()
+		for _, seq := range []int{0, 1, 2} {
+			spyConsumer.msgChan <- primerLog(
+				fmt.Sprintf("subscriptionID0 - TEST a %d/3 %d", seq, emitted),
+			)
+		}
+
+		result, err := runner.Run(&sharedapi.Test{
+			Cycles:  6,
+			Timeout: sharedapi.Duration(500 * time.Millisecond),
+			Mode:    sharedapi.LogCacheMode,
+		}, func() {})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(result.ReceivedLogCount).To(Equal(uint64(3)))
+		Expect(result.MissingLogCount).To(Equal(uint64(3)))
+		Expect(result.MissingRanges).To(BeEmpty())
+	})
+
+	It("writes the logs at the rate of the load profile", func() {
+		spyConsumer := NewSpyConsumer()
+		runner := client.NewLogReliabilityTestRunner(
+			"fh",
+			"subscriptionID",
+			&spyAuthenticator{},
+			&spyReporter{},
+			spyConsumer,
+		)
+		spyConsumer.msgChan <- primerLog("subscriptionID0 - PRIMER")
+
+		out := &lockedBuffer{}
+		log.SetOutput(out)
+		defer log.SetOutput(GinkgoWriter)
+
+		result, err := runner.Run(&sharedapi.Test{
+			Cycles:      100,
+			WriteCycles: 100,
+			Timeout:     sharedapi.Duration(300 * time.Millisecond),
+			Load: &sharedapi.LoadProfile{
+				Type:  sharedapi.ConstantLoad,
+				Rate:  1000,
+				Sizes: []sharedapi.MessageSize{{Bytes: 200, Weight: 1}},
+			},
+		}, func() {})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(result.TargetRate).To(BeNumerically("~", 1000, 1))
+		Expect(result.AchievedRate).To(BeNumerically("~", 1000, 100))
+
+		var testLogs int
+		for _, line := range strings.Split(out.String(), "\n") {
+			i := strings.Index(line, "subscriptionID0 - TEST")
+			if i < 0 {
+				continue
+			}
+			testLogs++
+			Expect(line[i:]).To(HaveLen(200))
+		}
+		Expect(testLogs).To(Equal(100))
+	})
+
+	It("returns an error for an invalid load profile", func() {
+		runner := client.NewLogReliabilityTestRunner(
+			"fh",
+			"subscriptionID",
+			&spyAuthenticator{},
+			&spyReporter{},
+			NewSpyConsumer(),
+		)
+
+		_, err := runner.Run(&sharedapi.Test{
+			Cycles: 1,
+			Load:   &sharedapi.LoadProfile{Type: sharedapi.ConstantLoad},
+		}, func() {})
+		Expect(err).To(MatchError(ContainSubstring("invalid load profile")))
+	})
+
+	It("consumes the logs with the consumer for the test's mode", func() {
+		firehose := NewSpyConsumer()
+		logCache := NewSpyConsumer()
+		runner := client.NewLogReliabilityTestRunner(
+			"fh",
+			"subscriptionID",
+			&spyAuthenticator{},
+			&spyReporter{},
+			firehose,
+			client.WithConsumer(sharedapi.LogCacheMode, logCache),
+		)
+		logCache.msgChan <- primerLog("subscriptionID0 - PRIMER")
+
+		_, err := runner.Run(&sharedapi.Test{
+			Cycles: 1,
+			Mode:   sharedapi.LogCacheMode,
+		}, func() {})
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(logCache.called).To(BeTrue())
+		Expect(firehose.called).To(BeFalse())
+	})
+
+	It("returns an error for a mode without a consumer", func() {
+		consumer := NewSpyConsumer()
+		runner := client.NewLogReliabilityTestRunner(
+			"fh",
+			"subscriptionID",
+			&spyAuthenticator{},
+			&spyReporter{},
+			consumer,
+		)
+
+		_, err := runner.Run(&sharedapi.Test{
+			Cycles: 1,
+			Mode:   sharedapi.RLPGatewayMode,
+		}, func() {})
+		Expect(err).To(MatchError(ContainSubstring("unsupported mode")))
+		Expect(consumer.called).To(BeFalse())
 	})
 })
 
+func primerLog(msg string) *events.Envelope {
+	return &events.Envelope{
+		Origin:    proto.String("origin"),
+		EventType: events.Envelope_LogMessage.Enum(),
+		LogMessage: &events.LogMessage{
+			Message:     []byte(msg),
+			MessageType: events.LogMessage_OUT.Enum(),
+			Timestamp:   proto.Int64(time.Now().UnixNano()),
+		},
+	}
+}
+
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
 type spyReporter struct {
 	results reporter.TestResult
 }
@@ -65,15 +334,17 @@ func (s spyAuthenticator) Token() (string, error) {
 type spyConsumer struct {
 	msgChan chan *events.Envelope
 	errChan chan error
+	called  bool
 }
 
 func NewSpyConsumer() *spyConsumer {
 	return &spyConsumer{
-		msgChan: make(chan *events.Envelope, 1),
+		msgChan: make(chan *events.Envelope, 100),
 		errChan: make(chan error, 1),
 	}
 }
 
-func (s *spyConsumer) FirehoseWithoutReconnect(string, string) (<-chan *events.Envelope, <-chan error) {
+func (s *spyConsumer) Consume(context.Context, string, string) (<-chan *events.Envelope, <-chan error) {
+	s.called = true
 	return s.msgChan, s.errChan
 }
@@ -3,70 +3,374 @@ package client
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
+	"code.cloudfoundry.org/loggregator-tools/reliability/worker/internal/reporter"
 
 	"github.com/gorilla/websocket"
 )
 
-// Runner runs the given tests.
+// ErrRejected is the error of a connection the control server rejected
+// because of the worker's credentials.
+var ErrRejected = errors.New("control server rejected the worker")
+
+// writeTimeout is how long a message may take to be written to the control
+// server before the connection is considered broken.
+const writeTimeout = 10 * time.Second
+
+// Runner runs the given tests. The primed func is called once the test is
+// receiving logs.
 type Runner interface {
-	Run(t *sharedapi.Test)
+	Run(t *sharedapi.Test, primed func()) (*reporter.TestResult, error)
 }
 
 // WorkerClient reaches out to the control server to enroll. When tests are
 // started, they will be sent via the websocket connection that the
 // WorkerClient initiates. The given Runner will be invoked with any tests
-// that the control server submits.
+// that the control server submits. The WorkerClient reports the progress
+// and result of each test back to the control server, and sends heartbeats
+// so the control server knows it is alive.
 type WorkerClient struct {
-	addr       string
-	skipVerify bool
-	runner     Runner
+	addr              string
+	skipVerify        bool
+	runner            Runner
+	id                string
+	secret            string
+	heartbeatInterval time.Duration
+	minBackoff        time.Duration
+	maxBackoff        time.Duration
+
+	// gorilla/websocket supports one concurrent writer, while messages are
+	// written from each test's go-routine. The connection changes when the
+	// WorkerClient reconnects, and messages sent while it is disconnected
+	// wait in pending.
+	writeMu sync.Mutex
+	conn    *websocket.Conn
+	pending []sharedapi.Message
+
+	mu      sync.Mutex
+	running map[int64]bool
+}
+
+// WorkerClientOption configures a WorkerClient.
+type WorkerClientOption func(*WorkerClient)
+
+// WithID sets the ID the WorkerClient reports its results with. Defaults to
+// the hostname.
+func WithID(id string) WorkerClientOption {
+	return func(w *WorkerClient) {
+		w.id = id
+	}
+}
+
+// WithHeartbeatInterval sets how often heartbeats are sent to the control
+// server. Defaults to 10 seconds.
+func WithHeartbeatInterval(d time.Duration) WorkerClientOption {
+	return func(w *WorkerClient) {
+		w.heartbeatInterval = d
+	}
+}
+
+// WithSecret signs a token with the given secret to prove the worker's ID
+// to the control server (see sharedapi.SignWorkerToken). Defaults to
+// connecting without a token.
+func WithSecret(secret string) WorkerClientOption {
+	return func(w *WorkerClient) {
+		w.secret = secret
+	}
+}
+
+// WithBackoff sets the range of the exponential backoff between attempts
+// to reconnect to the control server. Defaults to 1 second up to 1 minute.
+// Durations that are not positive keep the default, and a maximum below the
+// minimum is raised to the minimum.
+func WithBackoff(minBackoff, maxBackoff time.Duration) WorkerClientOption {
+	return func(w *WorkerClient) {
+		if minBackoff > 0 {
+			w.minBackoff = minBackoff
+		}
+		if maxBackoff > 0 {
+			w.maxBackoff = maxBackoff
+		}
+		w.maxBackoff = max(w.maxBackoff, w.minBackoff)
+	}
 }
 
 // NewWorkerClient builds a new WorkerClient.
-func NewWorkerClient(addr string, skipVerify bool, r Runner) *WorkerClient {
-	return &WorkerClient{
-		addr:       addr,
-		skipVerify: skipVerify,
-		runner:     r,
+func NewWorkerClient(addr string, skipVerify bool, r Runner, opts ...WorkerClientOption) *WorkerClient {
+	w := &WorkerClient{
+		addr:              addr,
+		skipVerify:        skipVerify,
+		runner:            r,
+		heartbeatInterval: 10 * time.Second,
+		minBackoff:        time.Second,
+		maxBackoff:        time.Minute,
+		running:           make(map[int64]bool),
 	}
+
+	for _, o := range opts {
+		o(w)
+	}
+
+	if w.id == "" {
+		w.id, _ = os.Hostname()
+	}
+
+	return w
 }
 
 // Run is used to start the WorkerClient. It starts the websocket connection
 // with the control server. The given context controls the lifecycle of the
 // Websocket. Each test will be ran (via the Runner) on a new go-routine.
+// A test that is already running is not started again.
+//
+// When the connection fails, Run reconnects with exponential backoff and
+// jitter until the context is done. Tests keep running while the worker is
+// disconnected and report their results once it has reconnected. A worker
+// the control server rejects keeps retrying as well, as the secret might
+// be rotated on the control server first.
 func (w *WorkerClient) Run(ctx context.Context) error {
+	backoff := w.minBackoff
+	for {
+		connected, err := w.connect(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if connected {
+			backoff = w.minBackoff
+		}
+		switch {
+		case errors.Is(err, ErrRejected):
+			log.Printf("ERROR: %s, check that WORKER_SECRET matches the control server", err)
+		case err != nil:
+			log.Printf("connection to control server failed: %s", err)
+		}
+
+		// The jitter keeps the workers from reconnecting in lockstep after
+		// the control server restarts.
+		wait := backoff/2 + rand.N(backoff/2+1)
+		log.Printf("reconnecting to control server in %s", wait)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+
+		backoff = min(2*backoff, w.maxBackoff)
+	}
+}
+
+// connect dials the control server and handles its messages until the
+// connection fails or the context is done. It returns whether the
+// connection was established.
+func (w *WorkerClient) connect(ctx context.Context) (bool, error) {
 	dialer := &websocket.Dialer{
 		TLSClientConfig: &tls.Config{
 			InsecureSkipVerify: w.skipVerify,
 		},
 	}
-	conn, _, err := dialer.Dial(w.addr, nil)
+
+	header := http.Header{}
+	if w.secret != "" {
+		header.Set("Authorization", "Bearer "+sharedapi.SignWorkerToken(w.secret, w.id, time.Now()))
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, w.addr, header)
+	if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return false, fmt.Errorf("%w: %s", ErrRejected, strings.TrimSpace(string(body)))
+	}
 	if err != nil {
-		return err
+		return false, err
 	}
+	defer conn.Close() //nolint:errcheck
 	log.Println("connected to control server")
 
-	var cancel func()
-	ctx, cancel = context.WithCancel(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w.attach(conn)
+	defer w.detach()
+	go w.sendHeartbeats(ctx)
+
+	readErr := make(chan error, 1)
 	go func() {
 		defer cancel()
 
 		for {
-			var test sharedapi.Test
-			err := conn.ReadJSON(&test)
+			err := conn.SetReadDeadline(time.Now().Add(3 * w.heartbeatInterval))
+			if err != nil {
+				readErr <- err
+				return
+			}
+
+			var msg sharedapi.Message
+			err = conn.ReadJSON(&msg)
 			if err != nil {
-				break
+				readErr <- err
+				return
 			}
 
-			log.Println("test received from control server")
-			go w.runner.Run(&test)
+			switch msg.Type {
+			case sharedapi.HeartbeatMessage:
+			case sharedapi.StartTestMessage:
+				if msg.Test == nil {
+					log.Println("start test message without a test")
+					continue
+				}
+
+				log.Println("test received from control server")
+				w.start(*msg.Test)
+			default:
+				log.Printf("unknown message type from control server: %q", msg.Type)
+			}
 		}
 	}()
 
 	<-ctx.Done()
 
-	return conn.Close()
+	select {
+	case err := <-readErr:
+		return true, err
+	default:
+		return true, nil
+	}
+}
+
+func (w *WorkerClient) start(t sharedapi.Test) {
+	w.mu.Lock()
+	alreadyRunning := w.running[t.ID]
+	w.running[t.ID] = true
+	w.mu.Unlock()
+
+	w.send(sharedapi.Message{
+		Type:   sharedapi.TestAcceptedMessage,
+		TestID: t.ID,
+	})
+
+	if alreadyRunning {
+		return
+	}
+
+	go w.run(t)
+}
+
+func (w *WorkerClient) run(t sharedapi.Test) {
+	defer func() {
+		w.mu.Lock()
+		delete(w.running, t.ID)
+		w.mu.Unlock()
+	}()
+
+	result, err := w.runner.Run(&t, func() {
+		w.send(sharedapi.Message{
+			Type:   sharedapi.TestPrimedMessage,
+			TestID: t.ID,
+		})
+	})
+	if err != nil {
+		log.Printf("test %d failed: %s", t.ID, err)
+		w.send(sharedapi.Message{
+			Type:   sharedapi.TestFailedMessage,
+			TestID: t.ID,
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	w.send(sharedapi.Message{
+		Type:   sharedapi.TestFinishedMessage,
+		TestID: t.ID,
+		Result: &sharedapi.TestResult{
+			TestID:           t.ID,
+			WorkerID:         w.id,
+			WriteCycles:      t.WriteCycles,
+			ReceivedLogCount: result.ReceivedLogCount,
+			LatencyP50:       sharedapi.Duration(result.LatencyP50),
+			LatencyP99:       sharedapi.Duration(result.LatencyP99),
+		},
+	})
+}
+
+func (w *WorkerClient) sendHeartbeats(ctx context.Context) {
+	ticker := time.NewTicker(w.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.send(sharedapi.Message{Type: sharedapi.HeartbeatMessage})
+		}
+	}
+}
+
+// send writes the message to the current connection. Messages other than
+// heartbeats that can not be written are kept until the next connection.
+func (w *WorkerClient) send(msg sharedapi.Message) {
+	msg.WorkerID = w.id
+
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	if w.conn == nil {
+		w.queue(msg)
+		return
+	}
+
+	// Without a deadline a control server that stops reading blocks every
+	// test that reports to it.
+	err := w.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err == nil {
+		err = w.conn.WriteJSON(&msg)
+	}
+	if err != nil {
+		log.Printf("failed to send %s to control server: %s", msg.Type, err)
+		w.queue(msg)
+	}
+}
+
+// queue must be called with the writeMu held.
+func (w *WorkerClient) queue(msg sharedapi.Message) {
+	if msg.Type == sharedapi.HeartbeatMessage {
+		return
+	}
+
+	w.pending = append(w.pending, msg)
+}
+
+// attach makes conn the current connection. The first heartbeat tells the
+// control server the ID of the worker, then the messages of tests that
+// progressed while the worker was disconnected are sent.
+func (w *WorkerClient) attach(conn *websocket.Conn) {
+	w.writeMu.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.conn = conn
+	w.writeMu.Unlock()
+
+	w.send(sharedapi.Message{Type: sharedapi.HeartbeatMessage})
+	for _, msg := range pending {
+		w.send(msg)
+	}
+}
+
+func (w *WorkerClient) detach() {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	w.conn = nil
 }
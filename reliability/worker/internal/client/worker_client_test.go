@@ -2,13 +2,19 @@ package client_test
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
 	"code.cloudfoundry.org/loggregator-tools/reliability/worker/internal/client"
+	"code.cloudfoundry.org/loggregator-tools/reliability/worker/internal/reporter"
 
 	"github.com/gorilla/websocket"
 
@@ -17,26 +23,235 @@ import (
 )
 
 var _ = Describe("WorkerClient", func() {
-	It("receives tests to run", func() {
-		server := newFakeWSServer()
-		defer server.stop()
-		runner := &spyRunner{}
+	var (
+		server *fakeWSServer
+		runner *spyRunner
+		cancel context.CancelFunc
+		done   chan struct{}
+	)
 
-		client := client.NewWorkerClient(server.wsAddr(), true, runner)
+	BeforeEach(func() {
+		server = newFakeWSServer()
+		runner = &spyRunner{}
+	})
 
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
+	AfterEach(func() {
+		cancel()
+		server.stop()
+	})
+
+	run := func(opts ...client.WorkerClientOption) {
+		c := client.NewWorkerClient(server.wsAddr(), true, runner, opts...)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan struct{})
 
 		go func() {
-			err := client.Run(ctx)
+			defer close(done)
+			err := c.Run(ctx)
 			Expect(err).ToNot(HaveOccurred())
 		}()
 		Eventually(server.connections).Should(Equal(int64(1)))
+	}
+
+	It("receives tests to run", func() {
+		run()
 
-		server.tests <- sharedapi.Test{}
-		server.tests <- sharedapi.Test{}
+		server.tests <- sharedapi.Test{ID: 1}
+		server.tests <- sharedapi.Test{ID: 2}
 		Eventually(runner.Count).Should(Equal(int64(2)))
 	})
+
+	It("reports the progress and result of each test", func() {
+		runner.receivedLogCount = 99
+		run(client.WithID("worker-0"))
+
+		server.tests <- sharedapi.Test{ID: 7, WriteCycles: 100}
+
+		msg := server.next()
+		Expect(msg.Type).To(Equal(sharedapi.TestAcceptedMessage))
+		Expect(msg.TestID).To(Equal(int64(7)))
+		Expect(msg.WorkerID).To(Equal("worker-0"))
+
+		msg = server.next()
+		Expect(msg.Type).To(Equal(sharedapi.TestPrimedMessage))
+		Expect(msg.TestID).To(Equal(int64(7)))
+
+		msg = server.next()
+		Expect(msg.Type).To(Equal(sharedapi.TestFinishedMessage))
+		Expect(msg.TestID).To(Equal(int64(7)))
+		Expect(*msg.Result).To(Equal(sharedapi.TestResult{
+			TestID:           7,
+			WorkerID:         "worker-0",
+			WriteCycles:      100,
+			ReceivedLogCount: 99,
+		}))
+	})
+
+	It("reports failed tests", func() {
+		runner.err = errors.New("failed to prime")
+		run()
+
+		server.tests <- sharedapi.Test{ID: 7}
+
+		Expect(server.next().Type).To(Equal(sharedapi.TestAcceptedMessage))
+		msg := server.next()
+		Expect(msg.Type).To(Equal(sharedapi.TestFailedMessage))
+		Expect(msg.TestID).To(Equal(int64(7)))
+		Expect(msg.Error).To(Equal("failed to prime"))
+	})
+
+	It("does not start a test that is already running", func() {
+		runner.block = make(chan struct{})
+		run()
+
+		server.tests <- sharedapi.Test{ID: 7}
+		Expect(server.next().Type).To(Equal(sharedapi.TestAcceptedMessage))
+		Expect(server.next().Type).To(Equal(sharedapi.TestPrimedMessage))
+
+		server.tests <- sharedapi.Test{ID: 7}
+		Expect(server.next().Type).To(Equal(sharedapi.TestAcceptedMessage))
+		Consistently(runner.Count).Should(Equal(int64(1)))
+
+		close(runner.block)
+		Expect(server.next().Type).To(Equal(sharedapi.TestFinishedMessage))
+	})
+
+	It("sends heartbeats with its ID", func() {
+		run(client.WithID("worker-0"), client.WithHeartbeatInterval(10*time.Millisecond))
+
+		Eventually(server.heartbeats).Should(BeNumerically(">", 3))
+		Expect(server.lastHeartbeatFrom()).To(Equal("worker-0"))
+	})
+
+	It("proves its ID with a token signed with the secret", func() {
+		server.secret = "secret"
+		run(client.WithID("worker-0"), client.WithSecret("secret"))
+
+		Expect(server.tokenID()).To(Equal("worker-0"))
+	})
+
+	It("keeps retrying while the control server rejects it", func() {
+		server.secret = "secret"
+		c := client.NewWorkerClient(
+			server.wsAddr(),
+			true,
+			runner,
+			client.WithSecret("wrong"),
+			client.WithBackoff(time.Millisecond, 10*time.Millisecond),
+		)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			Expect(c.Run(ctx)).To(Succeed())
+		}()
+
+		Eventually(server.rejections).Should(BeNumerically(">", 2))
+		Expect(server.connections()).To(BeZero())
+		Consistently(done).ShouldNot(BeClosed())
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("does not retry in a tight loop with a backoff of zero", func() {
+		server.secret = "secret"
+		c := client.NewWorkerClient(
+			server.wsAddr(),
+			true,
+			runner,
+			client.WithSecret("wrong"),
+			client.WithBackoff(0, 0),
+		)
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			Expect(c.Run(ctx)).To(Succeed())
+		}()
+
+		Eventually(server.rejections).Should(Equal(int64(1)))
+		Consistently(server.rejections, 200*time.Millisecond).Should(Equal(int64(1)))
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("reconnects when the control server stops sending heartbeats", func() {
+		server.sendHeartbeats = false
+		run(
+			client.WithHeartbeatInterval(10*time.Millisecond),
+			client.WithBackoff(time.Millisecond, 10*time.Millisecond),
+		)
+
+		Eventually(server.connections).Should(BeNumerically(">", 1))
+		Consistently(done).ShouldNot(BeClosed())
+	})
+
+	It("reconnects to a restarted control server and completes running tests", func() {
+		runner.block = make(chan struct{})
+		first := newFakeWSHandler()
+		s := httptest.NewServer(first)
+		addr := s.Listener.Addr().String()
+
+		c := client.NewWorkerClient(
+			"ws://"+addr,
+			true,
+			runner,
+			client.WithID("worker-0"),
+			client.WithBackoff(10*time.Millisecond, 50*time.Millisecond),
+		)
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			Expect(c.Run(ctx)).To(Succeed())
+		}()
+
+		Eventually(first.connections).Should(Equal(int64(1)))
+		first.tests <- sharedapi.Test{ID: 7, WriteCycles: 10}
+		Expect(first.next().Type).To(Equal(sharedapi.TestAcceptedMessage))
+		Expect(first.next().Type).To(Equal(sharedapi.TestPrimedMessage))
+
+		// Hijacked websocket connections are not closed by the server.
+		first.disconnect()
+		s.Close()
+
+		// The worker keeps running while the control server is down, and the
+		// test finishes meanwhile.
+		Consistently(done, 100*time.Millisecond).ShouldNot(BeClosed())
+		close(runner.block)
+
+		second := newFakeWSHandler()
+		restarted := httptest.NewUnstartedServer(second)
+		lis, err := net.Listen("tcp", addr)
+		Expect(err).ToNot(HaveOccurred())
+		restarted.Listener = lis
+		restarted.Start()
+		defer func() {
+			second.disconnect()
+			restarted.Close()
+		}()
+
+		Eventually(second.connections).Should(Equal(int64(1)))
+		Eventually(second.lastHeartbeatFrom).Should(Equal("worker-0"))
+
+		msg := second.next()
+		Expect(msg.Type).To(Equal(sharedapi.TestFinishedMessage))
+		Expect(msg.TestID).To(Equal(int64(7)))
+		Expect(msg.Result.WorkerID).To(Equal("worker-0"))
+		Expect(runner.Count()).To(Equal(int64(1)))
+
+		second.tests <- sharedapi.Test{ID: 8}
+		Expect(second.next().Type).To(Equal(sharedapi.TestAcceptedMessage))
+	})
 })
 
 var upgrader = websocket.Upgrader{
@@ -44,17 +259,38 @@ var upgrader = websocket.Upgrader{
 }
 
 type fakeWSServer struct {
-	listener net.Listener
-	tests    chan sharedapi.Test
+	listener       net.Listener
+	tests          chan sharedapi.Test
+	messages       chan sharedapi.Message
+	sendHeartbeats bool
+	quit           chan struct{}
+	// secret requires workers to connect with a signed token if set.
+	secret string
 
 	_connections int64
+	_heartbeats  int64
+	_rejections  int64
+
+	mu                 sync.Mutex
+	lastHeartbeatFrom_ string
+	tokenID_           string
 }
 
-func newFakeWSServer() *fakeWSServer {
-	server := &fakeWSServer{
-		tests: make(chan sharedapi.Test, 100),
+// newFakeWSHandler builds a fakeWSServer that does not listen, so it can be
+// served by an httptest.Server.
+func newFakeWSHandler() *fakeWSServer {
+	return &fakeWSServer{
+		tests:          make(chan sharedapi.Test, 100),
+		messages:       make(chan sharedapi.Message, 100),
+		sendHeartbeats: true,
+		quit:           make(chan struct{}),
 	}
-	http.Handle("/", server)
+}
+
+func newFakeWSServer() *fakeWSServer {
+	server := newFakeWSHandler()
+	mux := http.NewServeMux()
+	mux.Handle("/", server)
 
 	lis, err := net.Listen("tcp", "localhost:0")
 	if err != nil {
@@ -63,13 +299,27 @@ func newFakeWSServer() *fakeWSServer {
 	server.listener = lis
 
 	go func() {
-		log.Println(http.Serve(lis, nil))
+		log.Println(http.Serve(lis, mux))
 	}()
 
 	return server
 }
 
 func (f *fakeWSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.secret != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		id, err := sharedapi.VerifyWorkerToken(f.secret, token, time.Now())
+		if err != nil {
+			atomic.AddInt64(&f._rejections, 1)
+			http.Error(w, "invalid worker token: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		f.mu.Lock()
+		f.tokenID_ = id
+		f.mu.Unlock()
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -84,25 +334,58 @@ func (f *fakeWSServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		defer cancel()
 
 		for {
-			_, _, err := conn.ReadMessage()
+			var msg sharedapi.Message
+			err := conn.ReadJSON(&msg)
 			if err != nil {
 				break
 			}
+
+			if msg.Type == sharedapi.HeartbeatMessage {
+				atomic.AddInt64(&f._heartbeats, 1)
+				f.mu.Lock()
+				f.lastHeartbeatFrom_ = msg.WorkerID
+				f.mu.Unlock()
+				continue
+			}
+
+			f.messages <- msg
 		}
 	}()
 
+	heartbeats := time.NewTicker(10 * time.Millisecond)
+	defer heartbeats.Stop()
+
 	for {
+		var msg sharedapi.Message
 		select {
 		case test := <-f.tests:
-			err := conn.WriteJSON(&test)
-			if err != nil {
-				panic(err)
+			msg = sharedapi.Message{
+				Type: sharedapi.StartTestMessage,
+				Test: &test,
 			}
+		case <-heartbeats.C:
+			if !f.sendHeartbeats {
+				continue
+			}
+			msg = sharedapi.Message{Type: sharedapi.HeartbeatMessage}
 		case <-ctx.Done():
 			return
+		case <-f.quit:
+			return
+		}
+
+		err := conn.WriteJSON(&msg)
+		if err != nil {
+			return
 		}
 	}
+}
 
+// next returns the next message that is not a heartbeat.
+func (f *fakeWSServer) next() sharedapi.Message {
+	var msg sharedapi.Message
+	EventuallyWithOffset(1, f.messages).Should(Receive(&msg))
+	return msg
 }
 
 func (f *fakeWSServer) wsAddr() string {
@@ -113,6 +396,32 @@ func (f *fakeWSServer) connections() int64 {
 	return atomic.LoadInt64(&f._connections)
 }
 
+func (f *fakeWSServer) rejections() int64 {
+	return atomic.LoadInt64(&f._rejections)
+}
+
+func (f *fakeWSServer) heartbeats() int64 {
+	return atomic.LoadInt64(&f._heartbeats)
+}
+
+func (f *fakeWSServer) lastHeartbeatFrom() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.lastHeartbeatFrom_
+}
+
+func (f *fakeWSServer) tokenID() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.tokenID_
+}
+
+// disconnect closes every connection of the server.
+func (f *fakeWSServer) disconnect() {
+	close(f.quit)
+}
+
 func (f *fakeWSServer) stop() {
 	err := f.listener.Close()
 	if err != nil {
@@ -122,11 +431,24 @@ func (f *fakeWSServer) stop() {
 
 type spyRunner struct {
 	client.Runner
-	runCallCount int64
+	runCallCount     int64
+	receivedLogCount uint64
+	err              error
+	block            chan struct{}
 }
 
-func (s *spyRunner) Run(*sharedapi.Test) {
+func (s *spyRunner) Run(_ *sharedapi.Test, primed func()) (*reporter.TestResult, error) {
 	atomic.AddInt64(&s.runCallCount, 1)
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	primed()
+	if s.block != nil {
+		<-s.block
+	}
+
+	return &reporter.TestResult{ReceivedLogCount: s.receivedLogCount}, nil
 }
 
 func (s *spyRunner) Count() int64 {
@@ -80,6 +80,34 @@ type TestResult struct {
 	Delay            time.Duration
 	Cycles           uint64
 	TestStartTime    time.Time
+
+	// MissingLogCount is the number of sequence numbers that were never
+	// received. MissingRanges holds where they are, up to a limit. Both
+	// are empty in firehose mode, where the workers share a subscription.
+	MissingLogCount    uint64
+	MissingRanges      []SequenceRange
+	DuplicateLogCount  uint64
+	OutOfOrderLogCount uint64
+
+	// Latencies between a log being written and received.
+	LatencyP50 time.Duration
+	LatencyP90 time.Duration
+	LatencyP99 time.Duration
+	LatencyMax time.Duration
+
+	// The rate in logs per second the worker's load profile targeted and
+	// the rate it achieved. TargetRate is zero for logs written as fast as
+	// possible.
+	TargetRate   float64
+	AchievedRate float64
+}
+
+// SequenceRange is an inclusive range of sequence numbers written by a
+// sender.
+type SequenceRange struct {
+	Sender string `json:"sender"`
+	Start  uint64 `json:"start"`
+	End    uint64 `json:"end"`
 }
 
 func NewTestResult(test *sharedapi.Test, count uint64) *TestResult {
@@ -0,0 +1,79 @@
+package reporter
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// JSONReporter writes each test result as a line of JSON, e.g. to a file or
+// to stdout.
+type JSONReporter struct {
+	host          string
+	instanceIndex string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONReporter builds a new JSONReporter that writes to the given
+// writer.
+func NewJSONReporter(host, instanceIndex string, w io.Writer) *JSONReporter {
+	return &JSONReporter{
+		host:          host,
+		instanceIndex: instanceIndex,
+		w:             w,
+	}
+}
+
+type jsonResult struct {
+	Host             string    `json:"host"`
+	InstanceIndex    string    `json:"instance_index"`
+	TestStartTime    time.Time `json:"test_start_time"`
+	Cycles           uint64    `json:"cycles"`
+	Delay            string    `json:"delay"`
+	ReceivedLogCount uint64    `json:"received_log_count"`
+
+	MissingLogCount    uint64          `json:"missing_log_count"`
+	MissingRanges      []SequenceRange `json:"missing_ranges"`
+	DuplicateLogCount  uint64          `json:"duplicate_log_count"`
+	OutOfOrderLogCount uint64          `json:"out_of_order_log_count"`
+	LatencyP50         string          `json:"latency_p50"`
+	LatencyP90         string          `json:"latency_p90"`
+	LatencyP99         string          `json:"latency_p99"`
+	LatencyMax         string          `json:"latency_max"`
+	TargetRate         float64         `json:"target_rate"`
+	AchievedRate       float64         `json:"achieved_rate"`
+}
+
+func (r *JSONReporter) Report(t *TestResult) error {
+	line, err := json.Marshal(jsonResult{
+		Host:             r.host,
+		InstanceIndex:    r.instanceIndex,
+		TestStartTime:    t.TestStartTime,
+		Cycles:           t.Cycles,
+		Delay:            t.Delay.String(),
+		ReceivedLogCount: t.ReceivedLogCount,
+
+		MissingLogCount:    t.MissingLogCount,
+		MissingRanges:      append([]SequenceRange{}, t.MissingRanges...),
+		DuplicateLogCount:  t.DuplicateLogCount,
+		OutOfOrderLogCount: t.OutOfOrderLogCount,
+		LatencyP50:         t.LatencyP50.String(),
+		LatencyP90:         t.LatencyP90.String(),
+		LatencyP99:         t.LatencyP99.String(),
+		LatencyMax:         t.LatencyMax.String(),
+		TargetRate:         t.TargetRate,
+		AchievedRate:       t.AchievedRate,
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, err = r.w.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,76 @@
+package reporter_test
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-tools/reliability/worker/internal/reporter"
+)
+
+var _ = Describe("JSONReporter", func() {
+	It("writes a line of JSON for each test result", func() {
+		dir, err := os.MkdirTemp("", "json-reporter")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir) //nolint:errcheck
+
+		path := filepath.Join(dir, "results.jsonl")
+		f, err := os.Create(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close() //nolint:errcheck
+
+		r := reporter.NewJSONReporter("mycoolhost.cfapps.io", "3", f)
+		Expect(r.Report(&reporter.TestResult{
+			Delay:            time.Second,
+			Cycles:           100,
+			ReceivedLogCount: 99,
+			TestStartTime:    time.Unix(20, 0).UTC(),
+			MissingLogCount:  1,
+			MissingRanges: []reporter.SequenceRange{
+				{Sender: "a", Start: 41, End: 41},
+			},
+			DuplicateLogCount:  2,
+			OutOfOrderLogCount: 3,
+			LatencyP50:         10 * time.Millisecond,
+			LatencyP90:         20 * time.Millisecond,
+			LatencyP99:         30 * time.Millisecond,
+			LatencyMax:         time.Second,
+			TargetRate:         100,
+			AchievedRate:       99.5,
+		})).To(Succeed())
+		Expect(r.Report(&reporter.TestResult{Cycles: 10})).To(Succeed())
+
+		f, err = os.Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close() //nolint:errcheck
+
+		var lines []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(MatchJSON(`{
+			"host": "mycoolhost.cfapps.io",
+			"instance_index": "3",
+			"test_start_time": "1970-01-01T00:00:20Z",
+			"cycles": 100,
+			"delay": "1s",
+			"received_log_count": 99,
+			"missing_log_count": 1,
+			"missing_ranges": [{"sender": "a", "start": 41, "end": 41}],
+			"duplicate_log_count": 2,
+			"out_of_order_log_count": 3,
+			"latency_p50": "10ms",
+			"latency_p90": "20ms",
+			"latency_p99": "30ms",
+			"latency_max": "1s",
+			"target_rate": 100,
+			"achieved_rate": 99.5
+		}`))
+	})
+})
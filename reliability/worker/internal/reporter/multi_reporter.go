@@ -0,0 +1,36 @@
+package reporter
+
+import (
+	"errors"
+)
+
+// Reporter reports a test result.
+type Reporter interface {
+	Report(t *TestResult) error
+}
+
+// MultiReporter reports each test result to several reporters.
+type MultiReporter struct {
+	reporters []Reporter
+}
+
+// NewMultiReporter builds a new MultiReporter.
+func NewMultiReporter(rs ...Reporter) *MultiReporter {
+	return &MultiReporter{
+		reporters: rs,
+	}
+}
+
+// Report reports the test result to every reporter, even if one of them
+// fails. It returns the errors of every reporter that failed.
+func (r *MultiReporter) Report(t *TestResult) error {
+	var errs []error
+	for _, rep := range r.reporters {
+		err := rep.Report(t)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,46 @@
+package reporter_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-tools/reliability/worker/internal/reporter"
+)
+
+var _ = Describe("MultiReporter", func() {
+	It("reports to every reporter", func() {
+		a := &spyReporter{}
+		b := &spyReporter{}
+		r := reporter.NewMultiReporter(a, b)
+
+		result := &reporter.TestResult{Cycles: 10}
+		Expect(r.Report(result)).To(Succeed())
+
+		Expect(a.results).To(ConsistOf(result))
+		Expect(b.results).To(ConsistOf(result))
+	})
+
+	It("reports to every reporter even if one fails", func() {
+		a := &spyReporter{err: errors.New("a failed")}
+		b := &spyReporter{}
+		c := &spyReporter{err: errors.New("c failed")}
+		r := reporter.NewMultiReporter(a, b, c)
+
+		err := r.Report(&reporter.TestResult{})
+		Expect(err).To(MatchError(ContainSubstring("a failed")))
+		Expect(err).To(MatchError(ContainSubstring("c failed")))
+		Expect(b.results).To(HaveLen(1))
+	})
+})
+
+type spyReporter struct {
+	results []*reporter.TestResult
+	err     error
+}
+
+func (r *spyReporter) Report(t *reporter.TestResult) error {
+	r.results = append(r.results, t)
+	return r.err
+}
@@ -0,0 +1,84 @@
+package reporter
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PrometheusReporter pushes test results to a Prometheus pushgateway. Each
+// worker pushes to its own group, so the results of the workers do not
+// overwrite each other.
+type PrometheusReporter struct {
+	url    string
+	client HTTP
+}
+
+// NewPrometheusReporter builds a new PrometheusReporter that pushes to the
+// pushgateway at the given address.
+func NewPrometheusReporter(addr, job, host, instanceIndex string, h HTTP) *PrometheusReporter {
+	return &PrometheusReporter{
+		url: fmt.Sprintf(
+			"%s/metrics/job/%s/host/%s/instance_index/%s",
+			strings.TrimSuffix(addr, "/"),
+			url.PathEscape(job),
+			url.PathEscape(host),
+			url.PathEscape(instanceIndex),
+		),
+		client: h,
+	}
+}
+
+func (r *PrometheusReporter) Report(t *TestResult) error {
+	resp, err := r.client.Post(
+		r.url,
+		"text/plain; version=0.0.4",
+		strings.NewReader(buildExposition(t)),
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	log.Printf("pushgateway response status code: %d", resp.StatusCode)
+	if resp.StatusCode != http.StatusAccepted &&
+		resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code was %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func buildExposition(t *TestResult) string {
+	return fmt.Sprintf(`# TYPE loggregator_reliability_msg_count gauge
+loggregator_reliability_msg_count %d
+# TYPE loggregator_reliability_cycles gauge
+loggregator_reliability_cycles %d
+# TYPE loggregator_reliability_delay_seconds gauge
+loggregator_reliability_delay_seconds %g
+# TYPE loggregator_reliability_test_start_time_seconds gauge
+loggregator_reliability_test_start_time_seconds %d
+# TYPE loggregator_reliability_missing_count gauge
+loggregator_reliability_missing_count %d
+# TYPE loggregator_reliability_duplicate_count gauge
+loggregator_reliability_duplicate_count %d
+# TYPE loggregator_reliability_out_of_order_count gauge
+loggregator_reliability_out_of_order_count %d
+# TYPE loggregator_reliability_latency_seconds gauge
+loggregator_reliability_latency_seconds{quantile="0.5"} %g
+loggregator_reliability_latency_seconds{quantile="0.9"} %g
+loggregator_reliability_latency_seconds{quantile="0.99"} %g
+loggregator_reliability_latency_seconds{quantile="1"} %g
+# TYPE loggregator_reliability_target_rate gauge
+loggregator_reliability_target_rate %g
+# TYPE loggregator_reliability_achieved_rate gauge
+loggregator_reliability_achieved_rate %g
+`,
+		t.ReceivedLogCount, t.Cycles, t.Delay.Seconds(), t.TestStartTime.Unix(),
+		t.MissingLogCount, t.DuplicateLogCount, t.OutOfOrderLogCount,
+		t.LatencyP50.Seconds(), t.LatencyP90.Seconds(), t.LatencyP99.Seconds(), t.LatencyMax.Seconds(),
+		t.TargetRate, t.AchievedRate,
+	)
+}
@@ -0,0 +1,97 @@
+package reporter_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"code.cloudfoundry.org/loggregator-tools/reliability/worker/internal/reporter"
+)
+
+var _ = Describe("PrometheusReporter", func() {
+	var (
+		status   int
+		requests chan *http.Request
+		bodies   chan string
+		server   *httptest.Server
+	)
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		requests = make(chan *http.Request, 10)
+		bodies = make(chan string, 10)
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			requests <- r
+			bodies <- string(body)
+			w.WriteHeader(status)
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("pushes a test result to the worker's group", func() {
+		r := reporter.NewPrometheusReporter(
+			server.URL+"/",
+			"reliability",
+			"mycoolhost.cfapps.io",
+			"3",
+			http.DefaultClient,
+		)
+
+		err := r.Report(&reporter.TestResult{
+			Delay:            1500 * time.Millisecond,
+			Cycles:           54321,
+			ReceivedLogCount: 12345,
+			TestStartTime:    time.Unix(20, 0),
+			MissingLogCount:  4,
+			LatencyP99:       250 * time.Millisecond,
+			TargetRate:       1000,
+			AchievedRate:     987.5,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var req *http.Request
+		Expect(requests).To(Receive(&req))
+		Expect(req.Method).To(Equal(http.MethodPost))
+		Expect(req.URL.Path).To(Equal(
+			"/metrics/job/reliability/host/mycoolhost.cfapps.io/instance_index/3",
+		))
+		Expect(req.Header.Get("Content-Type")).To(Equal("text/plain; version=0.0.4"))
+
+		var body string
+		Expect(bodies).To(Receive(&body))
+		Expect(body).To(ContainSubstring("\nloggregator_reliability_msg_count 12345\n"))
+		Expect(body).To(ContainSubstring("\nloggregator_reliability_cycles 54321\n"))
+		Expect(body).To(ContainSubstring("\nloggregator_reliability_delay_seconds 1.5\n"))
+		Expect(body).To(ContainSubstring("\nloggregator_reliability_test_start_time_seconds 20\n"))
+		Expect(body).To(ContainSubstring("\nloggregator_reliability_missing_count 4\n"))
+		Expect(body).To(ContainSubstring("\nloggregator_reliability_latency_seconds{quantile=\"0.99\"} 0.25\n"))
+		Expect(body).To(ContainSubstring("\nloggregator_reliability_target_rate 1000\n"))
+		Expect(body).To(ContainSubstring("\nloggregator_reliability_achieved_rate 987.5\n"))
+	})
+
+	It("returns an error for a failed push", func() {
+		status = http.StatusBadRequest
+		r := reporter.NewPrometheusReporter(server.URL, "reliability", "host", "0", http.DefaultClient)
+
+		err := r.Report(&reporter.TestResult{})
+		Expect(err).To(MatchError("status code was 400"))
+	})
+
+	It("returns an error if the client fails", func() {
+		spyHTTPClient := &spyHTTPClient{}
+		spyHTTPClient.postErrorReturn = errors.New("something failed")
+		r := reporter.NewPrometheusReporter(server.URL, "reliability", "host", "0", spyHTTPClient)
+
+		err := r.Report(&reporter.TestResult{})
+		Expect(err).To(HaveOccurred())
+	})
+})
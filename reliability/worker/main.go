@@ -3,15 +3,17 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"time"
 
+	sharedapi "code.cloudfoundry.org/loggregator-tools/reliability/api"
 	"code.cloudfoundry.org/loggregator-tools/reliability/worker/internal/client"
 	"code.cloudfoundry.org/loggregator-tools/reliability/worker/internal/reporter"
-
-	"github.com/cloudfoundry/noaa/v2/consumer"
 )
 
 func main() {
@@ -23,8 +25,11 @@ func main() {
 	clientID := os.Getenv("CLIENT_ID")
 	clientSecret := os.Getenv("CLIENT_SECRET")
 	dataDogAPIKey := os.Getenv("DATADOG_API_KEY")
+	pushgatewayAddr := os.Getenv("PUSHGATEWAY_ADDR")
+	resultsFile := os.Getenv("RESULTS_FILE")
 	logEndpoint := os.Getenv("LOG_ENDPOINT")
 	controlServerAddr := os.Getenv("CONTROL_SERVER_ADDR")
+	workerSecret := os.Getenv("WORKER_SECRET")
 	host := os.Getenv("HOSTNAME")
 	skipCertVerify := os.Getenv("SKIP_CERT_VERIFY") == "true"
 
@@ -40,10 +45,6 @@ func main() {
 		log.Fatal("CLIENT_SECRET is required")
 	}
 
-	if dataDogAPIKey == "" {
-		log.Fatal("DATADOG_API_KEY is required")
-	}
-
 	if logEndpoint == "" {
 		log.Fatal("LOG_ENDPOINT is required")
 	}
@@ -56,6 +57,11 @@ func main() {
 		log.Fatal("HOSTNAME is required")
 	}
 
+	// Authentication is opt-in, so existing deployments keep working.
+	if workerSecret == "" {
+		log.Println("WARNING: WORKER_SECRET is not set, the worker connects without a token")
+	}
+
 	httpClient := &http.Client{
 		Timeout: 30 * time.Second,
 		Transport: &http.Transport{
@@ -73,25 +79,109 @@ func main() {
 		httpClient,
 	)
 
-	log.Println("Building DataDog reporter")
-	reporter := reporter.NewDataDogReporter(
-		dataDogAPIKey,
-		host,
-		instanceIndex,
-		httpClient,
-	)
+	var reporters []reporter.Reporter
+	if dataDogAPIKey != "" {
+		log.Println("Building DataDog reporter")
+		reporters = append(reporters, reporter.NewDataDogReporter(
+			dataDogAPIKey,
+			host,
+			instanceIndex,
+			httpClient,
+		))
+	}
+
+	if pushgatewayAddr != "" {
+		log.Println("Building Prometheus reporter")
+		reporters = append(reporters, reporter.NewPrometheusReporter(
+			pushgatewayAddr,
+			"loggregator_reliability",
+			host,
+			instanceIndex,
+			httpClient,
+		))
+	}
+
+	// Without any other reporter the results are written to stdout.
+	if resultsFile != "" || len(reporters) == 0 {
+		w := os.Stdout
+		if resultsFile != "" && resultsFile != "-" {
+			log.Printf("Building JSON reporter for %s", resultsFile)
+			f, err := os.OpenFile(resultsFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				log.Fatalf("failed to open RESULTS_FILE: %s", err)
+			}
+			defer f.Close() //nolint:errcheck
+			w = f
+		}
+		reporters = append(reporters, reporter.NewJSONReporter(host, instanceIndex, w))
+	}
 
-	consumer := consumer.New(logEndpoint, &tls.Config{InsecureSkipVerify: skipCertVerify}, nil)
+	workerID := fmt.Sprintf("%s/%s", host, instanceIndex)
+	consumer := client.NewFirehoseConsumer(logEndpoint, &tls.Config{InsecureSkipVerify: skipCertVerify})
+
+	var runnerOpts []client.RunnerOption
+	if rlpGatewayAddr := os.Getenv("RLP_GATEWAY_ADDR"); rlpGatewayAddr != "" {
+		log.Println("Building RLP gateway consumer")
+		// The stream is long lived, so the client must not time out.
+		streamClient := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: skipCertVerify,
+				},
+			},
+		}
+		runnerOpts = append(runnerOpts, client.WithConsumer(
+			sharedapi.RLPGatewayMode,
+			client.NewRLPGatewayConsumer(rlpGatewayAddr, workerID, streamClient),
+		))
+	}
+
+	if logCacheAddr := os.Getenv("LOG_CACHE_ADDR"); logCacheAddr != "" {
+		log.Println("Building Log Cache consumer")
+		sourceID, err := appGUID()
+		if err != nil {
+			log.Fatalf("LOG_CACHE_ADDR requires the app GUID from VCAP_APPLICATION: %s", err)
+		}
+		runnerOpts = append(runnerOpts, client.WithConsumer(
+			sharedapi.LogCacheMode,
+			client.NewLogCacheConsumer(logCacheAddr, sourceID, httpClient, 250*time.Millisecond),
+		))
+	}
 
 	log.Println("Building TestRunner")
 	testRunner := client.NewLogReliabilityTestRunner(
 		logEndpoint,
 		"blackbox-test-",
 		uaaClient,
-		reporter,
+		reporter.NewMultiReporter(reporters...),
 		consumer,
+		runnerOpts...,
 	)
 
-	client := client.NewWorkerClient(controlServerAddr, skipCertVerify, testRunner)
+	client := client.NewWorkerClient(
+		controlServerAddr,
+		skipCertVerify,
+		testRunner,
+		client.WithID(workerID),
+		client.WithSecret(workerSecret),
+	)
 	log.Println(client.Run(context.Background()))
 }
+
+// appGUID returns the GUID of the app from VCAP_APPLICATION, which is the
+// source ID of the logs the app writes.
+func appGUID() (string, error) {
+	var vcap struct {
+		ApplicationID string `json:"application_id"`
+	}
+	err := json.Unmarshal([]byte(os.Getenv("VCAP_APPLICATION")), &vcap)
+	if err != nil {
+		return "", err
+	}
+
+	if vcap.ApplicationID == "" {
+		return "", errors.New("application_id is missing")
+	}
+
+	return vcap.ApplicationID, nil
+}
@@ -0,0 +1,76 @@
+// drain-reconciler: a tool that makes the syslog drains in a space match a
+// YAML spec.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog-forwarder/internal/cloudcontroller"
+	"code.cloudfoundry.org/loggregator-tools/syslog-forwarder/internal/drain"
+)
+
+var (
+	specPath  = flag.String("spec", "drains.yml", "path to the YAML drain spec")
+	api       = flag.String("api", "", "the address of the cloud controller")
+	spaceGuid = flag.String("space-guid", "", "guid of the space to reconcile")
+	apply     = flag.Bool("apply", false, "apply the plan instead of only printing it")
+)
+
+func main() {
+	flag.Parse()
+
+	token := os.Getenv("CF_TOKEN")
+	if *api == "" || *spaceGuid == "" || token == "" {
+		log.Fatal("-api, -space-guid and CF_TOKEN (see `cf oauth-token`) are required")
+	}
+
+	data, err := os.ReadFile(*specPath)
+	if err != nil {
+		log.Fatalf("failed to read spec: %s", err)
+	}
+
+	spec, err := drain.ParseSpec(data)
+	if err != nil {
+		log.Fatalf("failed to parse spec: %s", err)
+	}
+
+	c := cloudcontroller.NewHTTPCurlClient(
+		*api,
+		http.DefaultClient,
+		staticToken(token),
+		cloudcontroller.SaveAndRestagerFunc(func(string) {
+			log.Fatal("CF_TOKEN was rejected, it may have expired")
+		}),
+	)
+	r := drain.NewReconciler(c, *spaceGuid)
+
+	plan, err := r.Plan(spec)
+	if err != nil {
+		log.Fatalf("failed to plan: %s", err)
+	}
+
+	if len(plan) == 0 {
+		log.Println("drains are up to date")
+		return
+	}
+
+	log.Printf("plan:\n%s", plan)
+	if !*apply {
+		return
+	}
+
+	err = r.Apply(plan)
+	if err != nil {
+		log.Fatalf("failed to apply: %s", err)
+	}
+	log.Println("applied plan")
+}
+
+type staticToken string
+
+func (t staticToken) Token() (string, string, error) {
+	return string(t), "", nil
+}
@@ -2,6 +2,7 @@ package cloudcontroller
 
 import (
 	"fmt"
+	"net/url"
 )
 
 type CreateDrainClient struct {
@@ -14,17 +15,24 @@ func NewCreateDrainClient(c Curler) *CreateDrainClient {
 	}
 }
 
-func (c *CreateDrainClient) CreateDrain(name, url, spaceGuid, drainType string) error {
+func (c *CreateDrainClient) CreateDrain(name, drainURL, spaceGuid, drainType string) error {
 	if !validDrainType(drainType) {
 		return fmt.Errorf("invalid drain type: %s", drainType)
 	}
 
-	url = fmt.Sprintf("%s?drain-type=%s", url, drainType)
+	u, err := url.Parse(drainURL)
+	if err != nil {
+		return fmt.Errorf("invalid drain url: %s", err)
+	}
+
+	q := u.Query()
+	q.Set("drain-type", drainType)
+	u.RawQuery = q.Encode()
 
-	_, err := c.c.Curl(
+	_, err = c.c.Curl(
 		"/v2/user_provided_service_instances",
 		"POST",
-		c.buildRequestBody(name, url, spaceGuid),
+		c.buildRequestBody(name, u.String(), spaceGuid),
 	)
 
 	return err
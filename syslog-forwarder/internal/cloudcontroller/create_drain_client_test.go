@@ -36,6 +36,18 @@ var _ = Describe("CreateDrainClient", func() {
 		)))
 	})
 
+	It("adds the drain type to the query of the url", func() {
+		err := c.CreateDrain("some-name", "https://some-url/path?b=2&a=1", "some-space", "logs")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(curler.bodies).To(ConsistOf(MatchJSON(`
+		{
+		   "space_guid": "some-space",
+		   "name": "some-name",
+		   "syslog_drain_url": "https://some-url/path?a=1&b=2&drain-type=logs"
+		}`,
+		)))
+	})
+
 	It("returns an error if the POST fails", func() {
 		curler.errs["/v2/user_provided_service_instances"] = errors.New("some-error")
 		err := c.CreateDrain("some-name", "some-url", "some-space", "all")
@@ -0,0 +1,27 @@
+package cloudcontroller
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type DeleteDrainClient struct {
+	c Curler
+}
+
+func NewDeleteDrainClient(c Curler) *DeleteDrainClient {
+	return &DeleteDrainClient{
+		c: c,
+	}
+}
+
+// DeleteDrain deletes the user provided service instance. Any remaining
+// bindings are removed along with it.
+func (c *DeleteDrainClient) DeleteDrain(serviceInstanceGuid string) error {
+	_, err := c.c.Curl(
+		fmt.Sprintf("/v2/user_provided_service_instances/%s?recursive=true", serviceInstanceGuid),
+		http.MethodDelete,
+		"",
+	)
+	return err
+}
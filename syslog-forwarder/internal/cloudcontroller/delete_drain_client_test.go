@@ -0,0 +1,36 @@
+package cloudcontroller_test
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog-forwarder/internal/cloudcontroller"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DeleteDrainClient", func() {
+	var (
+		curler *stubCurler
+		c      *cloudcontroller.DeleteDrainClient
+	)
+
+	BeforeEach(func() {
+		curler = newStubCurler()
+		c = cloudcontroller.NewDeleteDrainClient(curler)
+	})
+
+	It("DELETEs the service instance", func() {
+		err := c.DeleteDrain("some-drain-guid")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(curler.methods).To(ConsistOf("DELETE"))
+		Expect(curler.URLs).To(ConsistOf("/v2/user_provided_service_instances/some-drain-guid?recursive=true"))
+		Expect(curler.bodies).To(ConsistOf(""))
+	})
+
+	It("returns an error if the DELETE fails", func() {
+		curler.errs["/v2/user_provided_service_instances/some-drain-guid?recursive=true"] = errors.New("some-error")
+		err := c.DeleteDrain("some-drain-guid")
+		Expect(err).To(MatchError("some-error"))
+	})
+})
@@ -0,0 +1,57 @@
+package cloudcontroller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type UnbindDrainClient struct {
+	c Curler
+}
+
+func NewUnbindDrainClient(c Curler) *UnbindDrainClient {
+	return &UnbindDrainClient{
+		c: c,
+	}
+}
+
+func (c *UnbindDrainClient) UnbindDrain(appGuid, serviceInstanceGuid string) error {
+	resp, err := c.c.Curl(
+		fmt.Sprintf(
+			"/v2/service_bindings?q=app_guid:%s&q=service_instance_guid:%s",
+			appGuid,
+			serviceInstanceGuid,
+		),
+		http.MethodGet,
+		"",
+	)
+	if err != nil {
+		return err
+	}
+
+	var bindings struct {
+		Resources []struct {
+			Metadata struct {
+				Guid string `json:"guid"`
+			} `json:"metadata"`
+		} `json:"resources"`
+	}
+	err = json.Unmarshal(resp, &bindings)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range bindings.Resources {
+		_, err := c.c.Curl(
+			fmt.Sprintf("/v2/service_bindings/%s", b.Metadata.Guid),
+			http.MethodDelete,
+			"",
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
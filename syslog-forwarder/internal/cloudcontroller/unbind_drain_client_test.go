@@ -0,0 +1,62 @@
+package cloudcontroller_test
+
+import (
+	"errors"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog-forwarder/internal/cloudcontroller"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("UnbindDrainClient", func() {
+	var (
+		curler *stubCurler
+		c      *cloudcontroller.UnbindDrainClient
+	)
+
+	BeforeEach(func() {
+		curler = newStubCurler()
+		c = cloudcontroller.NewUnbindDrainClient(curler)
+	})
+
+	It("DELETEs each binding between the app and the drain", func() {
+		curler.resps["/v2/service_bindings?q=app_guid:some-app-guid&q=service_instance_guid:some-drain-guid"] = `{
+			"resources": [
+				{"metadata": {"guid": "binding-1"}},
+				{"metadata": {"guid": "binding-2"}}
+			]
+		}`
+
+		err := c.UnbindDrain("some-app-guid", "some-drain-guid")
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(curler.methods).To(Equal([]string{"GET", "DELETE", "DELETE"}))
+		Expect(curler.URLs).To(Equal([]string{
+			"/v2/service_bindings?q=app_guid:some-app-guid&q=service_instance_guid:some-drain-guid",
+			"/v2/service_bindings/binding-1",
+			"/v2/service_bindings/binding-2",
+		}))
+	})
+
+	It("returns an error if listing the bindings fails", func() {
+		curler.errs["/v2/service_bindings?q=app_guid:some-app-guid&q=service_instance_guid:some-drain-guid"] = errors.New("some-error")
+		err := c.UnbindDrain("some-app-guid", "some-drain-guid")
+		Expect(err).To(MatchError("some-error"))
+	})
+
+	It("returns an error if the bindings are not valid JSON", func() {
+		curler.resps["/v2/service_bindings?q=app_guid:some-app-guid&q=service_instance_guid:some-drain-guid"] = "not json"
+		err := c.UnbindDrain("some-app-guid", "some-drain-guid")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns an error if the DELETE fails", func() {
+		curler.resps["/v2/service_bindings?q=app_guid:some-app-guid&q=service_instance_guid:some-drain-guid"] = `{
+			"resources": [{"metadata": {"guid": "binding-1"}}]
+		}`
+		curler.errs["/v2/service_bindings/binding-1"] = errors.New("some-error")
+
+		err := c.UnbindDrain("some-app-guid", "some-drain-guid")
+		Expect(err).To(MatchError("some-error"))
+	})
+})
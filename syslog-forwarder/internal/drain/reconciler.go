@@ -0,0 +1,287 @@
+package drain
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog-forwarder/internal/cloudcontroller"
+)
+
+// Action is the kind of change a Step makes to a space's drains.
+type Action string
+
+const (
+	// ActionCreate creates a drain that does not exist yet.
+	ActionCreate Action = "create"
+	// ActionRebind recreates a drain whose URL or type changed. Its apps
+	// are bound again by the Bind steps that follow it.
+	ActionRebind Action = "rebind"
+	// ActionBind binds an app to a drain.
+	ActionBind Action = "bind"
+	// ActionUnbind unbinds an app from a drain.
+	ActionUnbind Action = "unbind"
+	// ActionDelete deletes a drain that is not in the spec.
+	ActionDelete Action = "delete"
+)
+
+// Step is a single change required to make a space match a Spec.
+type Step struct {
+	Action Action
+	Drain  string
+
+	// DrainGuid is empty for drains that will be created or recreated
+	// while applying the plan.
+	DrainGuid string
+	URL       string
+	Type      string
+
+	App     string
+	AppGuid string
+}
+
+func (s Step) String() string {
+	switch s.Action {
+	case ActionCreate, ActionRebind:
+		return fmt.Sprintf("%s drain %s (%s, %s)", s.Action, s.Drain, s.URL, s.Type)
+	case ActionBind:
+		return fmt.Sprintf("bind app %s to drain %s", s.App, s.Drain)
+	case ActionUnbind:
+		return fmt.Sprintf("unbind app %s from drain %s", s.App, s.Drain)
+	default:
+		return fmt.Sprintf("%s drain %s", s.Action, s.Drain)
+	}
+}
+
+// Plan is the ordered list of steps that reconcile a space with a Spec.
+// An empty Plan means the space already matches.
+type Plan []Step
+
+func (p Plan) String() string {
+	var lines []string
+	for _, s := range p {
+		lines = append(lines, s.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Reconciler compares the drains in a space against a Spec and applies the
+// difference.
+type Reconciler struct {
+	spaceGuid string
+
+	drains   *ServiceDrainLister
+	apps     *cloudcontroller.AppListerClient
+	creator  *cloudcontroller.CreateDrainClient
+	binder   *cloudcontroller.BindDrainClient
+	unbinder *cloudcontroller.UnbindDrainClient
+	deleter  *cloudcontroller.DeleteDrainClient
+}
+
+func NewReconciler(c cloudcontroller.Curler, spaceGuid string, opts ...ServiceDrainListerOption) *Reconciler {
+	return &Reconciler{
+		spaceGuid: spaceGuid,
+		drains:    NewServiceDrainLister(c, opts...),
+		apps:      cloudcontroller.NewAppListerClient(c),
+		creator:   cloudcontroller.NewCreateDrainClient(c),
+		binder:    cloudcontroller.NewBindDrainClient(c),
+		unbinder:  cloudcontroller.NewUnbindDrainClient(c),
+		deleter:   cloudcontroller.NewDeleteDrainClient(c),
+	}
+}
+
+// Plan computes the steps required to make the space match the spec. It
+// does not modify anything.
+func (r *Reconciler) Plan(spec Spec) (Plan, error) {
+	current, err := r.drains.Drains(r.spaceGuid)
+	if err != nil {
+		return nil, err
+	}
+
+	apps, err := r.apps.ListApps(r.spaceGuid)
+	if err != nil {
+		return nil, err
+	}
+
+	appGuids := make(map[string]string)
+	appNames := make(map[string]string)
+	for _, a := range apps {
+		appGuids[a.Name] = a.Guid
+		appNames[a.Guid] = a.Name
+	}
+
+	currentByName := make(map[string]Drain)
+	for _, d := range current {
+		currentByName[d.Name] = d
+	}
+
+	var plan Plan
+	for _, ds := range spec.Drains {
+		desired := make(map[string]bool)
+		var binds []Step
+		for _, name := range ds.Apps {
+			guid, ok := appGuids[name]
+			if !ok {
+				return nil, fmt.Errorf("drain %s: unknown app %s", ds.Name, name)
+			}
+			desired[guid] = true
+
+			binds = append(binds, Step{
+				Action:  ActionBind,
+				Drain:   ds.Name,
+				App:     name,
+				AppGuid: guid,
+			})
+		}
+
+		d, ok := currentByName[ds.Name]
+		if !ok {
+			plan = append(plan, Step{
+				Action: ActionCreate,
+				Drain:  ds.Name,
+				URL:    ds.URL,
+				Type:   ds.Type,
+			})
+			plan = append(plan, binds...)
+			continue
+		}
+
+		if baseDrainURL(d.DrainURL) != baseDrainURL(ds.URL) || d.Type != ds.Type {
+			plan = append(plan, Step{
+				Action:    ActionRebind,
+				Drain:     ds.Name,
+				DrainGuid: d.Guid,
+				URL:       ds.URL,
+				Type:      ds.Type,
+			})
+			plan = append(plan, binds...)
+			continue
+		}
+
+		bound := make(map[string]bool)
+		for _, guid := range d.AppGuids {
+			bound[guid] = true
+		}
+
+		for _, b := range binds {
+			if bound[b.AppGuid] {
+				continue
+			}
+			b.DrainGuid = d.Guid
+			plan = append(plan, b)
+		}
+
+		for _, guid := range d.AppGuids {
+			if desired[guid] {
+				continue
+			}
+			plan = append(plan, Step{
+				Action:    ActionUnbind,
+				Drain:     d.Name,
+				DrainGuid: d.Guid,
+				App:       appNames[guid],
+				AppGuid:   guid,
+			})
+		}
+	}
+
+	inSpec := make(map[string]bool)
+	for _, ds := range spec.Drains {
+		inSpec[ds.Name] = true
+	}
+
+	for _, d := range current {
+		if inSpec[d.Name] {
+			continue
+		}
+		plan = append(plan, Step{
+			Action:    ActionDelete,
+			Drain:     d.Name,
+			DrainGuid: d.Guid,
+		})
+	}
+
+	return plan, nil
+}
+
+// Apply executes the steps of a plan in order. It stops at the first
+// failure. Since Plan only emits the steps that are still required,
+// planning and applying again after a failure picks up where it left off.
+func (r *Reconciler) Apply(p Plan) error {
+	guids := make(map[string]string)
+	for _, s := range p {
+		var err error
+		switch s.Action {
+		case ActionCreate:
+			err = r.creator.CreateDrain(s.Drain, s.URL, r.spaceGuid, s.Type)
+		case ActionRebind:
+			err = r.deleter.DeleteDrain(s.DrainGuid)
+			if err == nil {
+				err = r.creator.CreateDrain(s.Drain, s.URL, r.spaceGuid, s.Type)
+			}
+			delete(guids, s.Drain)
+		case ActionBind:
+			guid := s.DrainGuid
+			if guid == "" {
+				guid, err = r.drainGuid(s.Drain, guids)
+				if err != nil {
+					break
+				}
+			}
+			err = r.binder.BindDrain(s.AppGuid, guid)
+		case ActionUnbind:
+			err = r.unbinder.UnbindDrain(s.AppGuid, s.DrainGuid)
+		case ActionDelete:
+			err = r.deleter.DeleteDrain(s.DrainGuid)
+		default:
+			err = fmt.Errorf("unknown action: %s", s.Action)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to %s: %s", s, err)
+		}
+	}
+
+	return nil
+}
+
+// drainGuid resolves the guid of a drain that was created while applying
+// the plan. The cache is refreshed whenever a name is not in it.
+func (r *Reconciler) drainGuid(name string, cache map[string]string) (string, error) {
+	if guid, ok := cache[name]; ok {
+		return guid, nil
+	}
+
+	drains, err := r.drains.Drains(r.spaceGuid)
+	if err != nil {
+		return "", err
+	}
+
+	for _, d := range drains {
+		cache[d.Name] = d.Guid
+	}
+
+	guid, ok := cache[name]
+	if !ok {
+		return "", fmt.Errorf("drain %s was not found", name)
+	}
+
+	return guid, nil
+}
+
+// baseDrainURL strips the drain-type query parameter that CreateDrainClient
+// adds and sorts the rest of the query. Both the current and the spec URL go
+// through it so they compare equal regardless of how the query is encoded.
+func baseDrainURL(drainURL string) string {
+	u, err := url.Parse(drainURL)
+	if err != nil {
+		return drainURL
+	}
+
+	q := u.Query()
+	q.Del("drain-type")
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
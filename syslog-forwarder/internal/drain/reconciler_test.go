@@ -0,0 +1,265 @@
+package drain_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog-forwarder/internal/drain"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reconciler", func() {
+	var (
+		curler *stubCurler
+		r      *drain.Reconciler
+		spec   drain.Spec
+	)
+
+	BeforeEach(func() {
+		curler = newStubCurler()
+		r = drain.NewReconciler(curler, "space-guid")
+
+		curler.resps["/v2/apps?q=space_guid:space-guid"] = `{
+		   "resources": [
+		      {"metadata": {"guid": "app-1"}, "entity": {"name": "My App One"}},
+		      {"metadata": {"guid": "app-2"}, "entity": {"name": "My App Two"}},
+		      {"metadata": {"guid": "app-3"}, "entity": {"name": "My App Three"}}
+		   ]
+		}`
+
+		var err error
+		spec, err = drain.ParseSpec([]byte(`
+drains:
+- name: keep
+  url: syslog://keep.example.com
+  apps: [My App One, My App Two]
+- name: changed
+  url: syslog-tls://changed.example.com
+  type: all
+  apps: [My App Three]
+- name: new
+  url: https://new.example.com
+  type: metrics
+  apps: [My App Two]
+`))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("when the space matches the spec", func() {
+		BeforeEach(func() {
+			stubDrains(curler,
+				stubDrain{"keep", "keep-guid", "syslog://keep.example.com?drain-type=logs", []string{"app-1", "app-2"}},
+				stubDrain{"changed", "changed-guid", "syslog-tls://changed.example.com?drain-type=all", []string{"app-3"}},
+				stubDrain{"new", "new-guid", "https://new.example.com?drain-type=metrics", []string{"app-2"}},
+			)
+		})
+
+		It("plans nothing", func() {
+			p, err := r.Plan(spec)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p).To(BeEmpty())
+			Expect(p.String()).To(BeEmpty())
+		})
+
+		It("does not modify anything when applied", func() {
+			p, err := r.Plan(spec)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = r.Apply(p)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(curler.methods).To(HaveEach("GET"))
+		})
+	})
+
+	Context("when the space differs from the spec", func() {
+		BeforeEach(func() {
+			stubDrains(curler,
+				stubDrain{"keep", "keep-guid", "syslog://keep.example.com", []string{"app-1", "app-3"}},
+				stubDrain{"changed", "changed-guid", "syslog://changed.example.com?drain-type=all", []string{"app-3"}},
+				stubDrain{"stale", "stale-guid", "syslog://stale.example.com", []string{"app-1"}},
+			)
+		})
+
+		It("plans every change", func() {
+			p, err := r.Plan(spec)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.String()).To(Equal(strings.Join([]string{
+				"bind app My App Two to drain keep",
+				"unbind app My App Three from drain keep",
+				"rebind drain changed (syslog-tls://changed.example.com, all)",
+				"bind app My App Three to drain changed",
+				"create drain new (https://new.example.com, metrics)",
+				"bind app My App Two to drain new",
+				"delete drain stale",
+			}, "\n")))
+		})
+
+		It("applies every change", func() {
+			p, err := r.Plan(spec)
+			Expect(err).ToNot(HaveOccurred())
+
+			stubDrains(curler,
+				stubDrain{"keep", "keep-guid", "syslog://keep.example.com", []string{"app-1", "app-2"}},
+				stubDrain{"changed", "changed-guid-2", "syslog-tls://changed.example.com?drain-type=all", nil},
+				stubDrain{"new", "new-guid", "https://new.example.com?drain-type=metrics", nil},
+			)
+			curler.resps["/v2/service_bindings"] = "{}"
+			curler.resps["/v2/user_provided_service_instances"] = "{}"
+			curler.resps["/v2/service_bindings?q=app_guid:app-3&q=service_instance_guid:keep-guid"] = `{
+			   "resources": [{"metadata": {"guid": "binding-1"}}]
+			}`
+			curler.resps["/v2/service_bindings/binding-1"] = "{}"
+			curler.resps["/v2/user_provided_service_instances/changed-guid?recursive=true"] = "{}"
+			curler.resps["/v2/user_provided_service_instances/stale-guid?recursive=true"] = "{}"
+			curler.URLs = nil
+			curler.methods = nil
+			curler.bodies = nil
+
+			err = r.Apply(p)
+			Expect(err).ToNot(HaveOccurred())
+
+			var writes []string
+			for i, m := range curler.methods {
+				if m == "GET" {
+					continue
+				}
+				writes = append(writes, fmt.Sprintf("%s %s", m, curler.URLs[i]))
+			}
+			Expect(writes).To(Equal([]string{
+				"POST /v2/service_bindings",
+				"DELETE /v2/service_bindings/binding-1",
+				"DELETE /v2/user_provided_service_instances/changed-guid?recursive=true",
+				"POST /v2/user_provided_service_instances",
+				"POST /v2/service_bindings",
+				"POST /v2/user_provided_service_instances",
+				"POST /v2/service_bindings",
+				"DELETE /v2/user_provided_service_instances/stale-guid?recursive=true",
+			}))
+
+			var bindings []string
+			for i, u := range curler.URLs {
+				if u == "/v2/service_bindings" {
+					bindings = append(bindings, curler.bodies[i])
+				}
+			}
+			Expect(bindings).To(HaveLen(3))
+			Expect(bindings[0]).To(MatchJSON(`{"service_instance_guid": "keep-guid", "app_guid": "app-2"}`))
+			Expect(bindings[1]).To(MatchJSON(`{"service_instance_guid": "changed-guid-2", "app_guid": "app-3"}`))
+			Expect(bindings[2]).To(MatchJSON(`{"service_instance_guid": "new-guid", "app_guid": "app-2"}`))
+		})
+
+		It("returns the failing step when applying fails", func() {
+			p, err := r.Plan(spec)
+			Expect(err).ToNot(HaveOccurred())
+
+			curler.errs["/v2/service_bindings"] = errors.New("some error")
+
+			err = r.Apply(p)
+			Expect(err).To(MatchError("failed to bind app My App Two to drain keep: some error"))
+		})
+	})
+
+	It("plans nothing for drains created from a url with a query string", func() {
+		var err error
+		spec, err = drain.ParseSpec([]byte(`
+drains:
+- name: query
+  url: https://query.example.com/logs?token=abc&format=json
+  apps: [My App One]
+`))
+		Expect(err).ToNot(HaveOccurred())
+		stubDrains(curler,
+			stubDrain{"query", "query-guid", "https://query.example.com/logs?drain-type=logs&format=json&token=abc", []string{"app-1"}},
+		)
+
+		p, err := r.Plan(spec)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(BeEmpty())
+	})
+
+	It("returns an error for apps that are not in the space", func() {
+		stubDrains(curler)
+		spec.Drains[0].Apps = append(spec.Drains[0].Apps, "unknown-app")
+
+		_, err := r.Plan(spec)
+		Expect(err).To(MatchError("drain keep: unknown app unknown-app"))
+	})
+
+	It("returns the error if listing the drains fails", func() {
+		curler.errs["/v2/user_provided_service_instances?q=space_guid:space-guid"] = errors.New("some error")
+
+		_, err := r.Plan(spec)
+		Expect(err).To(MatchError("some error"))
+	})
+
+	It("returns the error if listing the apps fails", func() {
+		stubDrains(curler)
+		curler.errs["/v2/apps?q=space_guid:space-guid"] = errors.New("some error")
+
+		_, err := r.Plan(spec)
+		Expect(err).To(MatchError("some error"))
+	})
+})
+
+type stubDrain struct {
+	name     string
+	guid     string
+	url      string
+	appGuids []string
+}
+
+// stubDrains sets up the responses ServiceDrainLister needs to list the
+// given drains. App names are derived from the app-N guids.
+func stubDrains(curler *stubCurler, drains ...stubDrain) {
+	var instances, guids []string
+	for _, d := range drains {
+		bindingsURL := fmt.Sprintf("/v2/user_provided_service_instances/%s/service_bindings", d.guid)
+		instances = append(instances, fmt.Sprintf(`{
+		   "metadata": {"guid": %q},
+		   "entity": {"name": %q, "syslog_drain_url": %q, "service_bindings_url": %q}
+		}`, d.guid, d.name, d.url, bindingsURL))
+
+		var bindings []string
+		for _, g := range d.appGuids {
+			bindings = append(bindings, fmt.Sprintf(`{"entity": {"app_guid": %q}}`, g))
+			guids = append(guids, g)
+		}
+		curler.resps[bindingsURL] = fmt.Sprintf(`{"resources": [%s]}`, strings.Join(bindings, ","))
+	}
+	curler.resps["/v2/user_provided_service_instances?q=space_guid:space-guid"] = fmt.Sprintf(
+		`{"resources": [%s]}`,
+		strings.Join(instances, ","),
+	)
+
+	names := map[string]string{
+		"app-1": "My App One",
+		"app-2": "My App Two",
+		"app-3": "My App Three",
+	}
+	var seen []string
+	var apps []string
+	for _, g := range guids {
+		if contains(seen, g) {
+			continue
+		}
+		seen = append(seen, g)
+		apps = append(apps, fmt.Sprintf(`{"guid": %q, "name": %q}`, g, names[g]))
+	}
+	if len(seen) > 0 {
+		curler.resps["/v3/apps?guids="+strings.Join(seen, ",")] = fmt.Sprintf(
+			`{"resources": [%s]}`,
+			strings.Join(apps, ","),
+		)
+	}
+}
+
+func contains(s []string, e string) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
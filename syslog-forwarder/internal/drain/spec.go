@@ -0,0 +1,61 @@
+package drain
+
+import (
+	"fmt"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Spec is the desired set of syslog drains for a space.
+type Spec struct {
+	Drains []DrainSpec `yaml:"drains"`
+}
+
+// DrainSpec describes a single desired drain and the names of the apps
+// bound to it.
+type DrainSpec struct {
+	Name string   `yaml:"name"`
+	URL  string   `yaml:"url"`
+	Type string   `yaml:"type"`
+	Apps []string `yaml:"apps"`
+}
+
+// ParseSpec reads a YAML drain spec. A drain without a type defaults to
+// "logs".
+func ParseSpec(data []byte) (Spec, error) {
+	var s Spec
+	err := yaml.Unmarshal(data, &s)
+	if err != nil {
+		return Spec{}, err
+	}
+
+	names := make(map[string]bool)
+	for i, d := range s.Drains {
+		if d.Name == "" {
+			return Spec{}, fmt.Errorf("drain %d is missing a name", i)
+		}
+
+		if names[d.Name] {
+			return Spec{}, fmt.Errorf("drain %s is listed more than once", d.Name)
+		}
+		names[d.Name] = true
+
+		if d.URL == "" {
+			return Spec{}, fmt.Errorf("drain %s is missing a url", d.Name)
+		}
+
+		if d.Type == "" {
+			s.Drains[i].Type = "logs"
+		}
+
+		switch s.Drains[i].Type {
+		case "all", "metrics", "logs":
+		default:
+			return Spec{}, fmt.Errorf("drain %s has invalid drain type: %s", d.Name, d.Type)
+		}
+
+		s.Drains[i].Apps = uniqueStringSlice(d.Apps)
+	}
+
+	return s, nil
+}
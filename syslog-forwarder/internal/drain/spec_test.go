@@ -0,0 +1,77 @@
+package drain_test
+
+import (
+	"code.cloudfoundry.org/loggregator-tools/syslog-forwarder/internal/drain"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseSpec", func() {
+	It("parses every drain", func() {
+		s, err := drain.ParseSpec([]byte(`
+drains:
+- name: drain-1
+  url: syslog-tls://drain.example.com:6514
+  type: all
+  apps: [app-1, app-2, app-1]
+- name: drain-2
+  url: https://drain.example.com
+`))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(s.Drains).To(Equal([]drain.DrainSpec{
+			{
+				Name: "drain-1",
+				URL:  "syslog-tls://drain.example.com:6514",
+				Type: "all",
+				Apps: []string{"app-1", "app-2"},
+			},
+			{
+				Name: "drain-2",
+				URL:  "https://drain.example.com",
+				Type: "logs",
+			},
+		}))
+	})
+
+	It("returns an error for invalid YAML", func() {
+		_, err := drain.ParseSpec([]byte("drains: {"))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("returns an error for a drain without a name", func() {
+		_, err := drain.ParseSpec([]byte(`
+drains:
+- url: https://drain.example.com
+`))
+		Expect(err).To(MatchError("drain 0 is missing a name"))
+	})
+
+	It("returns an error for a drain without a url", func() {
+		_, err := drain.ParseSpec([]byte(`
+drains:
+- name: drain-1
+`))
+		Expect(err).To(MatchError("drain drain-1 is missing a url"))
+	})
+
+	It("returns an error for duplicate drain names", func() {
+		_, err := drain.ParseSpec([]byte(`
+drains:
+- name: drain-1
+  url: https://drain.example.com
+- name: drain-1
+  url: https://other.example.com
+`))
+		Expect(err).To(MatchError("drain drain-1 is listed more than once"))
+	})
+
+	It("returns an error for an invalid drain type", func() {
+		_, err := drain.ParseSpec([]byte(`
+drains:
+- name: drain-1
+  url: https://drain.example.com
+  type: traces
+`))
+		Expect(err).To(MatchError("drain drain-1 has invalid drain type: traces"))
+	})
+})
@@ -1,34 +1,129 @@
 package app
 
-// Queue is a thread safe queue.
+import (
+	"sync"
+)
+
+// Queue is a thread safe, bounded FIFO queue.
 type Queue struct {
-	buffer chan []byte
+	mu      sync.Mutex
+	notFull *sync.Cond
+	buffer  [][]byte
+	head    int
+	len     int
+
+	ready chan struct{}
+
+	received uint64
+	dropped  uint64
 }
 
 // NewQueue returns a new Queue configured with the given size.
 func NewQueue(size int) *Queue {
-	return &Queue{
-		buffer: make(chan []byte, size),
+	q := &Queue{
+		buffer: make([][]byte, size),
+		ready:  make(chan struct{}, 1),
 	}
+	q.notFull = sync.NewCond(&q.mu)
+
+	return q
 }
 
 // Push adds a slice of bytes to the queue. If the queue is full the given
-// slice will be dropped.
-func (q *Queue) Push(eb []byte) {
+// slice is dropped and Push returns false.
+func (q *Queue) Push(eb []byte) bool {
+	q.mu.Lock()
+	q.received++
+	if q.len == len(q.buffer) {
+		q.dropped++
+		q.mu.Unlock()
+		return false
+	}
+	q.push(eb)
+	q.mu.Unlock()
+
+	q.signal()
+	return true
+}
+
+// PushWait adds a slice of bytes to the queue. If the queue is full it
+// blocks until an item is popped.
+func (q *Queue) PushWait(eb []byte) {
+	q.mu.Lock()
+	q.received++
+	for q.len == len(q.buffer) {
+		q.notFull.Wait()
+	}
+	q.push(eb)
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+func (q *Queue) push(eb []byte) {
+	q.buffer[(q.head+q.len)%len(q.buffer)] = eb
+	q.len++
+}
+
+// signal wakes a reader waiting on Ready without blocking the writer.
+func (q *Queue) signal() {
 	select {
-	case q.buffer <- eb:
+	case q.ready <- struct{}{}:
 	default:
-		// Drop message
 	}
 }
 
 // Pop pulls a slice of bytes off the queue and returns the slice. If the
 // queue is empty the returned slice will be nil and the bool will be false.
 func (q *Queue) Pop() ([]byte, bool) {
-	select {
-	case b := <-q.buffer:
-		return b, true
-	default:
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.len == 0 {
 		return nil, false
 	}
+
+	b := q.buffer[q.head]
+	q.buffer[q.head] = nil
+	q.head = (q.head + 1) % len(q.buffer)
+	q.len--
+	q.notFull.Signal()
+
+	return b, true
+}
+
+// Ready returns a channel that receives after items are pushed. A reader
+// that finds the queue empty can wait on it instead of polling.
+func (q *Queue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Len returns the number of items in the queue.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.len
+}
+
+// QueueStats is a snapshot of the Queue's counters.
+type QueueStats struct {
+	// Queued is the number of items waiting to be popped.
+	Queued int `json:"queued"`
+	// Received is the number of items pushed, including dropped ones.
+	Received uint64 `json:"received"`
+	// Dropped is the number of items dropped because the queue was full.
+	Dropped uint64 `json:"dropped"`
+}
+
+// Stats returns the Queue's current counters.
+func (q *Queue) Stats() QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return QueueStats{
+		Queued:   q.len,
+		Received: q.received,
+		Dropped:  q.dropped,
+	}
 }
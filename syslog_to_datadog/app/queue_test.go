@@ -35,8 +35,54 @@ var _ = Describe("Queue", func() {
 			q.Push([]byte(fmt.Sprintf("%d", i)))
 		}
 
+		Expect(q.Push([]byte{'1'})).To(BeFalse())
+		Expect(q.Push([]byte{'2'})).To(BeFalse())
+		Expect(q.Stats()).To(Equal(app.QueueStats{
+			Queued:   20,
+			Received: 22,
+			Dropped:  2,
+		}))
+	})
+
+	It("pops items in the order they were pushed", func() {
+		q := app.NewQueue(2)
+
+		for i := 0; i < 5; i++ {
+			Expect(q.Push([]byte(fmt.Sprintf("%d", i)))).To(BeTrue())
+			b, ok := q.Pop()
+			Expect(ok).To(BeTrue())
+			Expect(string(b)).To(Equal(fmt.Sprintf("%d", i)))
+		}
+	})
+
+	It("blocks PushWait until there is room", func() {
+		q := app.NewQueue(1)
+		q.Push([]byte{'1'})
+
+		pushed := make(chan struct{})
+		go func() {
+			q.PushWait([]byte{'2'})
+			close(pushed)
+		}()
+		Consistently(pushed).ShouldNot(BeClosed())
+
+		b, _ := q.Pop()
+		Expect(b).To(Equal([]byte{'1'}))
+		Eventually(pushed).Should(BeClosed())
+
+		b, _ = q.Pop()
+		Expect(b).To(Equal([]byte{'2'}))
+		Expect(q.Stats().Dropped).To(BeZero())
+	})
+
+	It("signals Ready when items are pushed", func() {
+		q := app.NewQueue(20)
+		Expect(q.Ready()).ToNot(Receive())
+
 		q.Push([]byte{'1'})
 		q.Push([]byte{'2'})
+		Expect(q.Ready()).To(Receive())
+		Expect(q.Ready()).ToNot(Receive())
 	})
 
 	It("does not block if buffer is empty", func(done Done) {
@@ -1,12 +1,20 @@
 package app
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"log"
 	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/sink"
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/syslog"
 	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/web"
 )
 
@@ -15,12 +23,30 @@ var httpClient = &http.Client{
 }
 
 // Server handles initilizing an HTTP server as well as a rfc 5425 message
-// processor.
+// processor. It can also receive syslog streams over TCP and TLS.
 type Server struct {
 	listener       net.Listener
+	tcpAddr        string
+	tcpServer      *syslog.Server
+	tlsAddr        string
+	tlsConfig      *tls.Config
+	tlsServer      *syslog.Server
+	handlerOpts    []web.HandlerOption
+	authOpts       []web.AuthOption
+	auth           *web.Authenticator
+	hostnames      map[string]bool
+	rejectedHosts  uint64
+	backpressure   bool
+	queueSize      int
 	queue          *Queue
 	datadogBaseURL string
 	datadogKey     string
+	sink           processor.Sink
+	processorOpts  []processor.Option
+	processor      *processor.Processor
+	httpServer     *http.Server
+	stopped        chan struct{}
+	statsInterval  time.Duration
 }
 
 // ServerOption is a func that can be passed into NewServer to configure
@@ -34,41 +60,372 @@ func WithDatadogBaseURL(baseURL string) ServerOption {
 	}
 }
 
+// WithSink sets the sink metrics are written to. Defaults to datadog.
+func WithSink(sk processor.Sink) ServerOption {
+	return func(s *Server) {
+		s.sink = sk
+	}
+}
+
+// WithSyslogTCP starts a listener on the given addr that receives octet
+// counted streams of rfc 5424 messages.
+func WithSyslogTCP(addr string) ServerOption {
+	return func(s *Server) {
+		s.tcpAddr = addr
+	}
+}
+
+// WithSyslogTLS starts a TLS listener on the given addr that receives
+// octet counted streams of rfc 5424 messages.
+func WithSyslogTLS(addr string, c *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsAddr = addr
+		s.tlsConfig = c
+	}
+}
+
+// WithHTTPMultipleMessages configures the HTTP server to accept several
+// newline or octet framed messages per request.
+func WithHTTPMultipleMessages() ServerOption {
+	return func(s *Server) {
+		s.handlerOpts = append(s.handlerOpts, web.WithMultipleMessages())
+	}
+}
+
+// WithToken requires HTTP requests to carry the token in their path or
+// token query parameter. See web.WithToken.
+func WithToken(token string) ServerOption {
+	return func(s *Server) {
+		s.authOpts = append(s.authOpts, web.WithToken(token))
+	}
+}
+
+// WithBasicAuth requires HTTP requests to carry the given basic auth
+// credentials. When combined with WithToken either is accepted.
+func WithBasicAuth(username, password string) ServerOption {
+	return func(s *Server) {
+		s.authOpts = append(s.authOpts, web.WithBasicAuth(username, password))
+	}
+}
+
+// WithHostnameAllowlist drops messages whose rfc 5424 hostname is not one
+// of the given hostnames. Dropped messages are counted but still
+// acknowledged so senders do not retry them.
+func WithHostnameAllowlist(hostnames []string) ServerOption {
+	return func(s *Server) {
+		s.hostnames = make(map[string]bool)
+		for _, h := range hostnames {
+			s.hostnames[h] = true
+		}
+	}
+}
+
+// WithQueueSize sets how many messages are buffered between receiving and
+// processing them. Defaults to 10000.
+func WithQueueSize(n int) ServerOption {
+	return func(s *Server) {
+		s.queueSize = n
+	}
+}
+
+// WithBackpressure applies backpressure when the queue is full instead of
+// dropping messages. HTTP requests are answered with the given status
+// code, e.g. 429 or 503, and syslog streams stop being read until the
+// queue has room.
+// The queue only fills up while the processor cannot keep up. Metrics
+// waiting for a sink that is stuck are dropped by the processor.
+func WithBackpressure(statusCode int) ServerOption {
+	return func(s *Server) {
+		s.backpressure = true
+		s.handlerOpts = append(s.handlerOpts, web.WithRejectStatus(statusCode))
+	}
+}
+
+// WithMetricTypes sets the type counters are reported as, keyed by
+// metric name. See processor.WithMetricTypes.
+func WithMetricTypes(types map[string]string) ServerOption {
+	return func(s *Server) {
+		s.processorOpts = append(s.processorOpts, processor.WithMetricTypes(types))
+	}
+}
+
+// WithCountInterval sets the interval reported with count and rate metrics.
+func WithCountInterval(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.processorOpts = append(s.processorOpts, processor.WithCountInterval(d))
+	}
+}
+
+// WithMetricPrefix sets the prefix of every metric name. It replaces the
+// hostname of the message.
+func WithMetricPrefix(prefix string) ServerOption {
+	return func(s *Server) {
+		s.processorOpts = append(s.processorOpts, processor.WithMetricPrefix(prefix))
+	}
+}
+
+// WithTagAllowlist limits the tags written to the sink to the given keys.
+func WithTagAllowlist(keys []string) ServerOption {
+	return func(s *Server) {
+		s.processorOpts = append(s.processorOpts, processor.WithTagAllowlist(keys))
+	}
+}
+
+// WithFlushInterval sets how often batched metrics are written to the sink.
+func WithFlushInterval(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.processorOpts = append(s.processorOpts, processor.WithFlushInterval(d))
+	}
+}
+
+// WithMaxPayloadBytes sets the estimated payload size at which a batch is
+// written early.
+func WithMaxPayloadBytes(n int) ServerOption {
+	return func(s *Server) {
+		s.processorOpts = append(s.processorOpts, processor.WithMaxPayloadBytes(n))
+	}
+}
+
+// WithWorkers sets how many workers write metrics to the sink
+// concurrently. See processor.WithWorkers.
+func WithWorkers(n int) ServerOption {
+	return func(s *Server) {
+		s.processorOpts = append(s.processorOpts, processor.WithWorkers(n))
+	}
+}
+
+// WithStatsInterval sets how often the queue and flush stats are logged.
+// Defaults to 1 minute.
+func WithStatsInterval(d time.Duration) ServerOption {
+	return func(s *Server) {
+		s.statsInterval = d
+	}
+}
+
 // NewServer will start a listener on the given addr and configure a server
 // for processing rfc5424 messages.
 func NewServer(addr, datadogKey string, opts ...ServerOption) *Server {
-	lis, err := net.Listen("tcp", addr)
-	if err != nil {
-		log.Fatalf("failed to open listener (%s): %s", addr, err)
-	}
-	log.Printf("listening on: %s", addr)
+	lis := listen(addr)
 
-	queue := NewQueue(10000)
 	server := &Server{
 		listener:       lis,
-		queue:          queue,
-		datadogBaseURL: "https://app.datadoghq.com",
+		queueSize:      10000,
+		datadogBaseURL: "https://api.datadoghq.com",
 		datadogKey:     datadogKey,
+		statsInterval:  time.Minute,
+		stopped:        make(chan struct{}),
 	}
 	for _, o := range opts {
 		o(server)
 	}
+
+	queue := NewQueue(server.queueSize)
+	server.queue = queue
+
+	push := func(b []byte) {
+		if server.allowed(b) {
+			queue.Push(b)
+		}
+	}
+	if server.backpressure {
+		push = func(b []byte) {
+			if server.allowed(b) {
+				queue.PushWait(b)
+			}
+		}
+	}
+
+	if server.tcpAddr != "" {
+		lis := listen(server.tcpAddr)
+		server.tcpServer = syslog.NewServer(lis, push)
+	}
+
+	if server.tlsAddr != "" {
+		lis := tls.NewListener(listen(server.tlsAddr), server.tlsConfig)
+		server.tlsServer = syslog.NewServer(lis, push)
+	}
+
+	if server.sink == nil {
+		server.sink = sink.NewDatadog(httpClient, server.datadogBaseURL, server.datadogKey)
+	}
+
+	server.processor = processor.New(
+		queue.Pop,
+		server.sink,
+		append(server.processorOpts, processor.WithWakeup(queue.Ready()))...,
+	)
+
+	set := func(b []byte) bool {
+		return !server.allowed(b) || queue.Push(b)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", server.serveStats)
+	mux.Handle("/", web.NewHandler(set, server.handlerOpts...))
+	server.auth = web.NewAuthenticator(server.authOpts...)
+	server.httpServer = &http.Server{Handler: server.auth.Wrap(mux)}
+
 	return server
 }
 
-// Run will start the message processor and serve the HTTP server.
+// allowed checks the hostname of a message against the allowlist and
+// counts the messages it rejects.
+func (s *Server) allowed(msg []byte) bool {
+	if s.hostnames == nil || s.hostnames[hostname(msg)] {
+		return true
+	}
+
+	atomic.AddUint64(&s.rejectedHosts, 1)
+	return false
+}
+
+// hostname returns the HOSTNAME field of an rfc 5424 message, which is the
+// third field of the header: <PRI>VERSION TIMESTAMP HOSTNAME ...
+func hostname(msg []byte) string {
+	fields := bytes.SplitN(msg, []byte(" "), 4)
+	if len(fields) < 4 {
+		return ""
+	}
+
+	return string(fields[2])
+}
+
+func listen(addr string) net.Listener {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("failed to open listener (%s): %s", addr, err)
+	}
+	log.Printf("listening on: %s", addr)
+
+	return lis
+}
+
+// Run will start the message processor and serve the HTTP server and any
+// syslog listeners. The HTTP server reports the stats as JSON on GET /stats
+// and accepts messages on every other path. It blocks until Stop has
+// finished.
 func (s *Server) Run() {
-	go processor.New(
-		s.queue.Pop,
-		httpClient,
-		s.datadogBaseURL,
-		s.datadogKey,
-	).Run()
-	httpServer := &http.Server{Handler: web.NewHandler(s.queue.Push)}
-	log.Fatalf("http server shutting down: %s", httpServer.Serve(s.listener))
+	go s.processor.Run()
+	go s.logStats()
+
+	if s.tcpServer != nil {
+		go func() {
+			err := s.tcpServer.Serve()
+			if !errors.Is(err, net.ErrClosed) {
+				log.Fatalf("syslog tcp server shutting down: %s", err)
+			}
+		}()
+	}
+
+	if s.tlsServer != nil {
+		go func() {
+			err := s.tlsServer.Serve()
+			if !errors.Is(err, net.ErrClosed) {
+				log.Fatalf("syslog tls server shutting down: %s", err)
+			}
+		}()
+	}
+
+	err := s.httpServer.Serve(s.listener)
+	if err != http.ErrServerClosed {
+		log.Fatalf("http server shutting down: %s", err)
+	}
+	<-s.stopped
+}
+
+// Stop stops receiving messages, then blocks until the queued messages are
+// processed and every pending metric is written to the sink. In-flight
+// HTTP requests are given up to the context's deadline to finish.
+func (s *Server) Stop(ctx context.Context) {
+	err := s.httpServer.Shutdown(ctx)
+	if err != nil {
+		log.Printf("failed to shut down http server: %s", err)
+	}
+
+	if s.tcpServer != nil {
+		s.tcpServer.Close() //nolint:errcheck
+	}
+	if s.tlsServer != nil {
+		s.tlsServer.Close() //nolint:errcheck
+	}
+
+	s.processor.Stop()
+	close(s.stopped)
 }
 
 // Addr returns the address the listener is bound to.
 func (s *Server) Addr() string {
 	return s.listener.Addr().String()
 }
+
+// TCPAddr returns the address the syslog TCP listener is bound to.
+func (s *Server) TCPAddr() string {
+	return s.tcpServer.Addr()
+}
+
+// TLSAddr returns the address the syslog TLS listener is bound to.
+func (s *Server) TLSAddr() string {
+	return s.tlsServer.Addr()
+}
+
+// Stats is a snapshot of the queue, processor and rejection stats.
+type Stats struct {
+	Queue     QueueStats      `json:"queue"`
+	Processor processor.Stats `json:"processor"`
+	Rejected  RejectedStats   `json:"rejected"`
+}
+
+// RejectedStats counts what was rejected before reaching the queue.
+type RejectedStats struct {
+	// Unauthorized is the number of HTTP requests without valid
+	// credentials.
+	Unauthorized uint64 `json:"unauthorized"`
+	// Handshakes is the number of syslog TLS connections that failed the
+	// handshake, e.g. without a trusted client certificate.
+	Handshakes uint64 `json:"handshakes"`
+	// Hostnames is the number of messages from hostnames that are not
+	// allowed.
+	Hostnames uint64 `json:"hostnames"`
+}
+
+// Stats returns the current queue, processor and rejection stats.
+func (s *Server) Stats() Stats {
+	st := Stats{
+		Queue:     s.queue.Stats(),
+		Processor: s.processor.Stats(),
+		Rejected: RejectedStats{
+			Unauthorized: s.auth.Rejected(),
+			Hostnames:    atomic.LoadUint64(&s.rejectedHosts),
+		},
+	}
+	if s.tlsServer != nil {
+		st.Rejected.Handshakes = s.tlsServer.Rejected()
+	}
+
+	return st
+}
+
+func (s *Server) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(s.Stats())
+	if err != nil {
+		log.Printf("failed to write stats: %s", err)
+	}
+}
+
+func (s *Server) logStats() {
+	for range time.Tick(s.statsInterval) {
+		st := s.Stats()
+		log.Printf(
+			"received: %d, dropped: %d, queued: %d, pending: %d, flushes: %d, posted: %d, failed: %d, retries: %d, rejected: %d",
+			st.Queue.Received, st.Queue.Dropped, st.Queue.Queued,
+			st.Processor.Pending, st.Processor.Flushes, st.Processor.Posted, st.Processor.Dropped, st.Processor.Retries,
+			st.Rejected.Unauthorized+st.Rejected.Handshakes+st.Rejected.Hostnames,
+		)
+	}
+}
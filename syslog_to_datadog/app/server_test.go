@@ -2,13 +2,19 @@ package app_test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"sync"
+	"time"
 
 	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/app"
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -17,7 +23,12 @@ import (
 var _ = Describe("Server", func() {
 	It("forwards rfc5424 messages containing metrics to datadog", func() {
 		datadog := newSpyDatadog()
-		s := app.NewServer(":0", "junk-key", app.WithDatadogBaseURL(datadog.server.URL))
+		s := app.NewServer(
+			":0",
+			"junk-key",
+			app.WithDatadogBaseURL(datadog.server.URL),
+			app.WithFlushInterval(10*time.Millisecond),
+		)
 		go s.Run()
 
 		resp, err := http.Post(fmt.Sprintf(
@@ -34,20 +45,341 @@ var _ = Describe("Server", func() {
 			"series": [
 				{
 					"metric": "myhostname.cpu",
-					"points": [[1507143652, 0.23]],
-					"type": "gauge",
-					"host": "myhostname",
+					"points": [{"timestamp": 1507143652, "value": 0.23}],
+					"type": 3,
+					"unit": "percentage",
+					"resources": [{"name": "myhostname", "type": "host"}],
+					"tags": ["instance_id:4"]
+				}
+			]
+		}`))
+	})
+
+	It("forwards counters with the configured metric type", func() {
+		datadog := newSpyDatadog()
+		s := app.NewServer(
+			":0",
+			"junk-key",
+			app.WithDatadogBaseURL(datadog.server.URL),
+			app.WithFlushInterval(10*time.Millisecond),
+			app.WithMetricTypes(map[string]string{"ingress": "rate"}),
+			app.WithCountInterval(20*time.Second),
+		)
+		go s.Run()
+
+		for i, msg := range []string{
+			`<30>1 2017-10-04T13:00:52.662629-06:00 myhostname someapp [4] - [counter@47450 name="requests" total="1234" delta="40"]`,
+			`<30>1 2017-10-04T13:00:52.662629-06:00 myhostname someapp [4] - [counter@47450 name="ingress" total="1234" delta="40"]`,
+		} {
+			resp, err := http.Post(fmt.Sprintf("http://%s", s.Addr()), "text/plain", strings.NewReader(msg))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+			Eventually(datadog.requests).Should(HaveLen(i + 1))
+		}
+
+		Expect(datadog.requests()[0].body).To(MatchJSON(`{
+			"series": [
+				{
+					"metric": "myhostname.requests",
+					"points": [{"timestamp": 1507143652, "value": 40}],
+					"type": 1,
+					"interval": 20,
+					"resources": [{"name": "myhostname", "type": "host"}],
+					"tags": ["instance_id:4"]
+				}
+			]
+		}`))
+		Expect(datadog.requests()[1].body).To(MatchJSON(`{
+			"series": [
+				{
+					"metric": "myhostname.ingress",
+					"points": [{"timestamp": 1507143652, "value": 2}],
+					"type": 2,
+					"interval": 20,
+					"resources": [{"name": "myhostname", "type": "host"}],
+					"tags": ["instance_id:4"]
+				}
+			]
+		}`))
+	})
+
+	It("posts gzipped batches once they reach the max payload size and reports stats", func() {
+		datadog := newSpyDatadog()
+		s := app.NewServer(
+			":0",
+			"junk-key",
+			app.WithDatadogBaseURL(datadog.server.URL),
+			app.WithFlushInterval(time.Hour),
+			app.WithMaxPayloadBytes(1),
+		)
+		go s.Run()
+
+		for _, msg := range []string{
+			`<30>1 2017-10-04T13:00:52.662629-06:00 myhostname someapp [4] - [gauge@47450 name="cpu" value="0.23" unit="percentage"]`,
+			`<30>1 2017-10-04T13:00:52.662629-06:00 myhostname someapp [4] - [gauge@47450 name="memory" value="1024" unit="bytes"]`,
+		} {
+			resp, err := http.Post(fmt.Sprintf("http://%s", s.Addr()), "text/plain", strings.NewReader(msg))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		}
+
+		Eventually(datadog.requests).Should(HaveLen(1))
+		req := datadog.requests()[0]
+		Expect(req.contentEncoding).To(Equal("gzip"))
+		Expect(req.body).To(MatchJSON(`{
+			"series": [
+				{
+					"metric": "myhostname.cpu",
+					"points": [{"timestamp": 1507143652, "value": 0.23}],
+					"type": 3,
+					"unit": "percentage",
+					"resources": [{"name": "myhostname", "type": "host"}],
 					"tags": ["instance_id:4"]
 				}
 			]
 		}`))
+		Eventually(s.Stats).Should(Equal(app.Stats{
+			Queue: app.QueueStats{
+				Received: 2,
+			},
+			Processor: processor.Stats{
+				Pending: 1,
+				Flushes: 1,
+				Posted:  1,
+			},
+		}))
+	})
+
+	It("forwards metrics received over syslog TCP", func() {
+		datadog := newSpyDatadog()
+		s := app.NewServer(
+			":0",
+			"junk-key",
+			app.WithDatadogBaseURL(datadog.server.URL),
+			app.WithFlushInterval(10*time.Millisecond),
+			app.WithSyslogTCP("127.0.0.1:0"),
+		)
+		go s.Run()
+
+		conn, err := net.Dial("tcp", s.TCPAddr())
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close() //nolint:errcheck
+
+		msg := `<30>1 2017-10-04T13:00:52.662629-06:00 myhostname someapp [4] - [gauge@47450 name="cpu" value="0.23" unit="percentage"]`
+		_, err = fmt.Fprintf(conn, "%d %s", len(msg), msg)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(datadog.requests).Should(HaveLen(1))
+		Expect(datadog.requests()[0].body).To(ContainSubstring(`"metric":"myhostname.cpu"`))
+	})
+
+	It("accepts multiple messages per HTTP request", func() {
+		datadog := newSpyDatadog()
+		s := app.NewServer(
+			":0",
+			"junk-key",
+			app.WithDatadogBaseURL(datadog.server.URL),
+			app.WithFlushInterval(100*time.Millisecond),
+			app.WithHTTPMultipleMessages(),
+		)
+		go s.Run()
+
+		resp, err := http.Post(fmt.Sprintf(
+			"http://%s", s.Addr()),
+			"text/plain",
+			strings.NewReader(
+				`<30>1 2017-10-04T13:00:52.662629-06:00 myhostname someapp [4] - [gauge@47450 name="cpu" value="0.23" unit="percentage"]`+"\n"+
+					`<30>1 2017-10-04T13:00:52.662629-06:00 myhostname someapp [4] - [gauge@47450 name="memory" value="1024" unit="bytes"]`+"\n",
+			),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+
+		Eventually(datadog.bodies).Should(And(
+			ContainSubstring(`"metric":"myhostname.cpu"`),
+			ContainSubstring(`"metric":"myhostname.memory"`),
+		))
+	})
+
+	It("writes pending metrics when stopped", func() {
+		datadog := newSpyDatadog()
+		s := app.NewServer(
+			":0",
+			"junk-key",
+			app.WithDatadogBaseURL(datadog.server.URL),
+			app.WithFlushInterval(time.Hour),
+			app.WithWorkers(4),
+			app.WithSyslogTCP("127.0.0.1:0"),
+		)
+		stopped := make(chan struct{})
+		go func() {
+			s.Run()
+			close(stopped)
+		}()
+
+		for _, name := range []string{"cpu", "memory"} {
+			resp, err := http.Post(fmt.Sprintf(
+				"http://%s", s.Addr()),
+				"text/plain",
+				strings.NewReader(`<30>1 2017-10-04T13:00:52.662629-06:00 myhostname someapp [4] - [gauge@47450 name="`+name+`" value="0.23" unit="percentage"]`),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		}
+		Consistently(datadog.requests).Should(BeEmpty())
+
+		s.Stop(context.Background())
+
+		Expect(datadog.bodies()).To(And(
+			ContainSubstring(`"metric":"myhostname.cpu"`),
+			ContainSubstring(`"metric":"myhostname.memory"`),
+		))
+		Eventually(stopped).Should(BeClosed())
+
+		_, err := http.Get(fmt.Sprintf("http://%s/stats", s.Addr()))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reports stats as JSON", func() {
+		datadog := newSpyDatadog()
+		s := app.NewServer(
+			":0",
+			"junk-key",
+			app.WithDatadogBaseURL(datadog.server.URL),
+			app.WithFlushInterval(10*time.Millisecond),
+		)
+		go s.Run()
+
+		resp, err := http.Post(fmt.Sprintf(
+			"http://%s", s.Addr()),
+			"text/plain",
+			strings.NewReader(`<30>1 2017-10-04T13:00:52.662629-06:00 myhostname someapp [4] - [gauge@47450 name="cpu" value="0.23" unit="percentage"]`),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusAccepted))
+		Eventually(datadog.requests).Should(HaveLen(1))
+
+		Eventually(func() string {
+			resp, err := http.Get(fmt.Sprintf("http://%s/stats", s.Addr()))
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close() //nolint:errcheck
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			return string(body)
+		}).Should(MatchJSON(`{
+			"queue": {"queued": 0, "received": 1, "dropped": 0},
+			"processor": {"pending": 0, "flushes": 1, "posted": 1, "dropped": 0, "retries": 0},
+			"rejected": {"unauthorized": 0, "handshakes": 0, "hostnames": 0}
+		}`))
+	})
+
+	It("rejects requests without the token and messages from other hostnames", func() {
+		datadog := newSpyDatadog()
+		s := app.NewServer(
+			":0",
+			"junk-key",
+			app.WithDatadogBaseURL(datadog.server.URL),
+			app.WithFlushInterval(10*time.Millisecond),
+			app.WithToken("secret"),
+			app.WithHostnameAllowlist([]string{"myhostname"}),
+		)
+		go s.Run()
+
+		post := func(path, hostname string) int {
+			resp, err := http.Post(
+				fmt.Sprintf("http://%s%s", s.Addr(), path),
+				"text/plain",
+				strings.NewReader(`<30>1 2017-10-04T13:00:52.662629-06:00 `+hostname+` someapp [4] - [gauge@47450 name="cpu" value="0.23" unit="percentage"]`),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close() //nolint:errcheck
+			return resp.StatusCode
+		}
+
+		Expect(post("/", "myhostname")).To(Equal(http.StatusUnauthorized))
+		Expect(post("/?token=wrong", "myhostname")).To(Equal(http.StatusUnauthorized))
+		Expect(post("/secret", "otherhostname")).To(Equal(http.StatusAccepted))
+		Expect(post("/secret", "myhostname")).To(Equal(http.StatusAccepted))
+
+		Eventually(datadog.requests).Should(HaveLen(1))
+		Consistently(datadog.requests).Should(HaveLen(1))
+		Expect(datadog.requests()[0].body).To(ContainSubstring(`"resources":[{"name":"myhostname","type":"host"}]`))
+		Expect(s.Stats().Rejected).To(Equal(app.RejectedStats{
+			Unauthorized: 2,
+			Hostnames:    1,
+		}))
+	})
+
+	It("keeps accepting messages while the sink is stuck", func() {
+		sink := newBlockingSink()
+		defer sink.unblock()
+		s := app.NewServer(
+			":0",
+			"junk-key",
+			app.WithSink(sink),
+			app.WithQueueSize(1),
+			app.WithMaxPayloadBytes(1),
+			app.WithBackpressure(http.StatusServiceUnavailable),
+		)
+		go s.Run()
+
+		post := func() int {
+			resp, err := http.Post(fmt.Sprintf(
+				"http://%s", s.Addr()),
+				"text/plain",
+				strings.NewReader(`<30>1 2017-10-04T13:00:52.662629-06:00 myhostname someapp [4] - [gauge@47450 name="cpu" value="0.23" unit="percentage"]`),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close() //nolint:errcheck
+			return resp.StatusCode
+		}
+
+		// The second message makes the processor write the first one. Once
+		// the sink blocks, the metrics its worker cannot take are dropped
+		// instead of backing up the queue.
+		Expect(post()).To(Equal(http.StatusAccepted))
+		Expect(post()).To(Equal(http.StatusAccepted))
+		Eventually(sink.writing).Should(BeClosed())
+
+		Eventually(func() uint64 {
+			Expect(post()).To(Equal(http.StatusAccepted))
+			return s.Stats().Processor.Dropped
+		}, 10*time.Second, time.Millisecond).Should(BeNumerically(">", 0))
+		Expect(s.Stats().Queue.Dropped).To(BeZero())
 	})
 })
 
+// blockingSink blocks every write until it is unblocked.
+type blockingSink struct {
+	writing  chan struct{}
+	once     sync.Once
+	released chan struct{}
+}
+
+func newBlockingSink() *blockingSink {
+	return &blockingSink{
+		writing:  make(chan struct{}),
+		released: make(chan struct{}),
+	}
+}
+
+func (s *blockingSink) Write([]processor.Metric) error {
+	s.once.Do(func() { close(s.writing) })
+	<-s.released
+	return nil
+}
+
+func (s *blockingSink) unblock() {
+	close(s.released)
+}
+
 type request struct {
-	url         string
-	body        string
-	contentType string
+	url             string
+	body            string
+	contentType     string
+	contentEncoding string
 }
 
 type spyDatadog struct {
@@ -65,15 +397,23 @@ func newSpyDatadog() *spyDatadog {
 }
 
 func (s *spyDatadog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		Expect(err).ToNot(HaveOccurred())
+		body = gz
+	}
+
 	buf := bytes.NewBuffer(make([]byte, 0, r.ContentLength))
-	_, err := buf.ReadFrom(r.Body)
+	_, err := buf.ReadFrom(body)
 	Expect(err).ToNot(HaveOccurred())
 
 	s.mu.Lock()
 	s._requests = append(s._requests, request{
-		url:         r.URL.String(),
-		body:        buf.String(),
-		contentType: r.Header.Get("Content-Type"),
+		url:             r.URL.String(),
+		body:            buf.String(),
+		contentType:     r.Header.Get("Content-Type"),
+		contentEncoding: r.Header.Get("Content-Encoding"),
 	})
 	s.mu.Unlock()
 
@@ -86,3 +426,13 @@ func (s *spyDatadog) requests() []request {
 
 	return s._requests
 }
+
+// bodies returns the bodies of every request joined together.
+func (s *spyDatadog) bodies() string {
+	var bodies []string
+	for _, r := range s.requests() {
+		bodies = append(bodies, r.body)
+	}
+
+	return strings.Join(bodies, "\n")
+}
@@ -1,158 +1,491 @@
 package processor
 
 import (
+	"errors"
 	"fmt"
-	"io"
+	"hash/fnv"
 	"log"
-	"net/http"
-	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/rfc5424"
 )
 
+// Metric types.
 const (
-	datadogAPIEndpoint = "/api/v1/series"
+	Count = "count"
+	Gauge = "gauge"
+	Rate  = "rate"
 )
 
-var (
-	template = `{
-		"series": [{
-			"metric": "%s.%s",
-			"points": [[%d, %s]],
-			"type": "gauge",
-			"host": "%s",
-			"tags": ["instance_id:%s"]
-		}]
-	}`
-)
-
-// Getter is used to get rfc5424 encoded bytes to send to datadog.
+// Getter is used to get rfc5424 encoded bytes to send to the sink.
 type Getter func() ([]byte, bool)
 
-// HTTPClient is used to communicate to the datadog API.
-type HTTPClient interface {
-	Post(url, contentType string, body io.Reader) (*http.Response, error)
+// Sink writes batches of metrics to a metrics backend.
+type Sink interface {
+	// Write writes the metrics. Errors wrapped with Retryable are retried.
+	Write([]Metric) error
+}
+
+// Metric is a single point parsed from a gauge@ or counter@ structured
+// data element.
+type Metric struct {
+	Name string `json:"name"`
+	// Type is the type the metric is reported as. Gauges are always Gauge,
+	// see WithMetricTypes for counters.
+	Type string `json:"type"`
+	// Value is the value for the Type: a gauge's value, a counter's delta
+	// for Count, its delta per second for Rate and its total for Gauge.
+	Value float64 `json:"value"`
+	// Counter is set for metrics from counters. Total is the counter's
+	// total for sinks that expect monotonic counters.
+	Counter   bool          `json:"counter,omitempty"`
+	Total     float64       `json:"total,omitempty"`
+	Interval  time.Duration `json:"interval,omitempty"`
+	Unit      string        `json:"unit,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+	Host      string        `json:"host"`
+	Tags      []Tag         `json:"tags"`
+}
+
+// Tag is a key value pair attached to a Metric.
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type retryableError struct {
+	err error
 }
 
-// Processor gets rfc5424 messages and sends them to the datadog API.
+func (e retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e retryableError) Unwrap() error {
+	return e.err
+}
+
+// Retryable marks an error returned by a Sink as worth retrying.
+func Retryable(err error) error {
+	return retryableError{err: err}
+}
+
+// IsRetryable reports whether the error was marked with Retryable.
+func IsRetryable(err error) bool {
+	var retryable retryableError
+	return errors.As(err, &retryable)
+}
+
+// Processor gets rfc5424 messages and writes the metrics in them to a Sink.
+// Metrics are handed to workers that batch them and write a batch once per
+// flush interval, or sooner when it reaches the max payload size.
 type Processor struct {
 	getter Getter
-	client HTTPClient
-	apiURL *url.URL
+	sink   Sink
+
+	metricTypes   map[string]string
+	countInterval time.Duration
+	metricPrefix  *string
+	tagAllowlist  map[string]bool
+
+	flushInterval   time.Duration
+	maxPayloadBytes int
+	maxRetries      int
+	retryBackoff    time.Duration
+	wakeup          <-chan struct{}
+
+	workers  []*worker
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	pending int64
+	flushes uint64
+	posted  uint64
+	dropped uint64
+	retries uint64
+}
+
+// Option is a func that can be passed into New to configure optional
+// settings on the Processor.
+type Option func(*Processor)
+
+// WithMetricTypes sets the type counters are reported as, keyed by metric
+// name. Counters default to Count, which reports the counter's delta over
+// the count interval. Rate reports the delta per second over the count
+// interval and Gauge reports the counter's total. Gauges are always
+// reported as Gauge.
+func WithMetricTypes(types map[string]string) Option {
+	return func(p *Processor) {
+		p.metricTypes = types
+	}
+}
+
+// WithCountInterval sets the interval reported with Count and Rate metrics.
+// It should match how often counters are emitted. Defaults to 10 seconds.
+// Durations that are not positive are ignored.
+func WithCountInterval(d time.Duration) Option {
+	return func(p *Processor) {
+		if d > 0 {
+			p.countInterval = d
+		}
+	}
+}
+
+// WithMetricPrefix sets the prefix of every metric name. Metrics are
+// named <prefix>.<name>, or just <name> for an empty prefix. Defaults to the
+// hostname of the message.
+func WithMetricPrefix(prefix string) Option {
+	return func(p *Processor) {
+		p.metricPrefix = &prefix
+	}
+}
+
+// WithTagAllowlist limits the tags written to the sink to the given keys.
+// Tags come from the parameters of tags@ structured data elements and from
+// the parameters of a gauge or counter element other than its name, value,
+// unit, total and delta. The instance_id tag is always written. By default
+// every tag is written.
+func WithTagAllowlist(keys []string) Option {
+	return func(p *Processor) {
+		p.tagAllowlist = make(map[string]bool)
+		for _, k := range keys {
+			p.tagAllowlist[k] = true
+		}
+	}
+}
+
+// WithFlushInterval sets how often batched metrics are written to the sink.
+// Defaults to 5 seconds. Durations that are not positive are ignored.
+func WithFlushInterval(d time.Duration) Option {
+	return func(p *Processor) {
+		if d > 0 {
+			p.flushInterval = d
+		}
+	}
+}
+
+// WithMaxPayloadBytes sets the size at which a batch is written before the
+// flush interval has elapsed. The size is estimated from the JSON encoding
+// of the metrics. Defaults to 512KB.
+func WithMaxPayloadBytes(n int) Option {
+	return func(p *Processor) {
+		p.maxPayloadBytes = n
+	}
+}
+
+// WithRetries sets how many times a write that failed with a Retryable
+// error is retried and the backoff before the first retry. The backoff
+// doubles with every retry. Defaults to 3 retries starting at 1 second.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(p *Processor) {
+		p.maxRetries = maxRetries
+		p.retryBackoff = backoff
+	}
+}
+
+// WithWakeup sets a channel that receives when the Getter has data. The
+// Processor waits on it while the Getter is empty instead of polling the
+// Getter every 10 milliseconds.
+func WithWakeup(c <-chan struct{}) Option {
+	return func(p *Processor) {
+		p.wakeup = c
+	}
+}
+
+// WithWorkers sets how many workers batch and write metrics concurrently,
+// so one slow write does not hold up every metric. Metrics are sharded by
+// host and name, which keeps the points of a series in order. Defaults
+// to 1.
+func WithWorkers(n int) Option {
+	return func(p *Processor) {
+		p.workers = make([]*worker, n)
+	}
 }
 
 // New creates a new Processor.
-func New(g Getter, c HTTPClient, apiBaseURL, apiKey string) *Processor {
-	apiURL, err := url.Parse(apiBaseURL + datadogAPIEndpoint)
-	if err != nil {
-		log.Fatalf("Failed to parse datadog URL: %s", err)
+func New(g Getter, s Sink, opts ...Option) *Processor {
+	p := &Processor{
+		getter:          g,
+		sink:            s,
+		countInterval:   10 * time.Second,
+		flushInterval:   5 * time.Second,
+		maxPayloadBytes: 512 * 1024,
+		maxRetries:      3,
+		retryBackoff:    time.Second,
+		workers:         make([]*worker, 1),
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
 	}
-	query := url.Values{
-		"api_key": []string{apiKey},
+	for _, o := range opts {
+		o(p)
 	}
-	apiURL.RawQuery = query.Encode()
 
-	return &Processor{
-		getter: g,
-		client: c,
-		apiURL: apiURL,
+	for i := range p.workers {
+		p.workers[i] = newWorker(p)
 	}
+
+	return p
 }
 
-// Run reads from the Getter and writes to datadog. It blocks while reading.
+// Run reads from the Getter and hands the metrics to the workers. It
+// blocks until Stop is called and the Getter is drained.
 func (p *Processor) Run() {
+	var wg sync.WaitGroup
+	for _, w := range p.workers {
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			w.run()
+		}(w)
+	}
+
+	defer func() {
+		for _, w := range p.workers {
+			close(w.metrics)
+		}
+		wg.Wait()
+		close(p.done)
+	}()
+
+	stopping := false
 	for {
 		data, ok := p.getter()
 		if !ok {
-			time.Sleep(10 * time.Millisecond)
-			continue
-		}
+			if stopping {
+				return
+			}
+
+			// Receiving from a nil channel blocks, so only one of wakeup
+			// and poll is ever ready.
+			var poll <-chan time.Time
+			if p.wakeup == nil {
+				poll = time.After(10 * time.Millisecond)
+			}
 
-		var msg rfc5424.Message
-		err := msg.UnmarshalBinary(data)
-		if err != nil {
+			select {
+			case <-p.wakeup:
+			case <-poll:
+			case <-p.stop:
+				stopping = true
+			}
 			continue
 		}
 
-		for _, sd := range msg.StructuredData {
-			if strings.HasPrefix(sd.ID, "gauge@") {
-				err := p.postGauge(msg, sd)
-				if err != nil {
-					log.Printf("failed to post to datadog: %s", err)
-				}
-				break
+		p.process(data)
+	}
+}
+
+// Stop makes Run return once the Getter is empty and blocks until every
+// worker has written its batch. It must only be called after Run.
+func (p *Processor) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	<-p.done
+}
+
+func (p *Processor) process(data []byte) {
+	var msg rfc5424.Message
+	err := msg.UnmarshalBinary(data)
+	if err != nil {
+		return
+	}
+
+	tags := p.messageTags(msg)
+	for _, sd := range msg.StructuredData {
+		if strings.HasPrefix(sd.ID, "gauge@") {
+			err := p.addGauge(msg, sd, tags)
+			if err != nil {
+				log.Printf("failed to process gauge: %s", err)
 			}
-			if strings.HasPrefix(sd.ID, "counter@") {
-				err := p.postCounter(msg, sd)
-				if err != nil {
-					log.Printf("failed to post to datadog: %s", err)
-				}
-				break
+		}
+		if strings.HasPrefix(sd.ID, "counter@") {
+			err := p.addCounter(msg, sd, tags)
+			if err != nil {
+				log.Printf("failed to process counter: %s", err)
 			}
 		}
 	}
 }
 
-func (p *Processor) postGauge(msg rfc5424.Message, sd rfc5424.StructuredData) error {
-	var name, value string
-	for _, p := range sd.Parameters {
-		switch p.Name {
+// Stats is a snapshot of the Processor's counters.
+type Stats struct {
+	// Pending is the number of metrics waiting to be written.
+	Pending int64 `json:"pending"`
+	// Flushes is the number of batches written to the sink.
+	Flushes uint64 `json:"flushes"`
+	// Posted is the number of metrics the sink accepted.
+	Posted uint64 `json:"posted"`
+	// Dropped is the number of metrics dropped after failing to write or
+	// because the queue of their worker was full.
+	Dropped uint64 `json:"dropped"`
+	// Retries is the number of writes that were retried.
+	Retries uint64 `json:"retries"`
+}
+
+// Stats returns the Processor's current counters. It is safe to call while
+// the Processor is running.
+func (p *Processor) Stats() Stats {
+	return Stats{
+		Pending: atomic.LoadInt64(&p.pending),
+		Flushes: atomic.LoadUint64(&p.flushes),
+		Posted:  atomic.LoadUint64(&p.posted),
+		Dropped: atomic.LoadUint64(&p.dropped),
+		Retries: atomic.LoadUint64(&p.retries),
+	}
+}
+
+// messageTags returns the instance_id tag and the tags from the message's
+// tags@ structured data elements.
+func (p *Processor) messageTags(msg rfc5424.Message) []Tag {
+	instanceID := strings.TrimPrefix(msg.ProcessID, "[")
+	instanceID = strings.TrimSuffix(instanceID, "]")
+
+	tags := []Tag{{Key: "instance_id", Value: instanceID}}
+	for _, sd := range msg.StructuredData {
+		if !strings.HasPrefix(sd.ID, "tags@") {
+			continue
+		}
+
+		for _, param := range sd.Parameters {
+			tags = p.appendTag(tags, param)
+		}
+	}
+
+	return tags
+}
+
+func (p *Processor) appendTag(tags []Tag, param rfc5424.SDParam) []Tag {
+	if p.tagAllowlist != nil && !p.tagAllowlist[param.Name] {
+		return tags
+	}
+
+	return append(tags, Tag{Key: param.Name, Value: param.Value})
+}
+
+func (p *Processor) addGauge(msg rfc5424.Message, sd rfc5424.StructuredData, tags []Tag) error {
+	// The message tags are shared by every metric in the message, so limit
+	// their capacity to make sure appending copies them.
+	tags = tags[:len(tags):len(tags)]
+
+	var name, value, unit string
+	for _, param := range sd.Parameters {
+		switch param.Name {
 		case "name":
-			name = p.Value
+			name = param.Value
 		case "value":
-			value = p.Value
+			value = param.Value
+		case "unit":
+			unit = param.Value
+		default:
+			tags = p.appendTag(tags, param)
 		}
 	}
-	return p.postMetric(name, value, msg)
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid value for gauge %s: %s", name, err)
+	}
+
+	return p.addMetric(Metric{
+		Name:  name,
+		Type:  Gauge,
+		Value: v,
+		Unit:  unit,
+		Tags:  tags,
+	}, msg)
 }
 
-func (p *Processor) postCounter(msg rfc5424.Message, sd rfc5424.StructuredData) error {
-	var name, value string
-	for _, p := range sd.Parameters {
-		switch p.Name {
+func (p *Processor) addCounter(msg rfc5424.Message, sd rfc5424.StructuredData, tags []Tag) error {
+	// See addGauge.
+	tags = tags[:len(tags):len(tags)]
+
+	var name, total, delta string
+	for _, param := range sd.Parameters {
+		switch param.Name {
 		case "name":
-			name = p.Value
+			name = param.Value
 		case "total":
-			value = p.Value
+			total = param.Value
+		case "delta":
+			delta = param.Value
+		default:
+			tags = p.appendTag(tags, param)
 		}
 	}
-	return p.postMetric(name, value, msg)
-}
 
-func (p *Processor) postMetric(name, value string, msg rfc5424.Message) error {
-	instanceID := strings.TrimPrefix(msg.ProcessID, "[")
-	instanceID = strings.TrimSuffix(instanceID, "]")
+	m := Metric{
+		Name: name,
+		Type: p.counterType(name),
+		Tags: tags,
+	}
 
-	body := strings.NewReader(
-		fmt.Sprintf(
-			template,
-			msg.Hostname,
-			name,
-			msg.Timestamp.Unix(),
-			value,
-			msg.Hostname,
-			instanceID,
-		),
-	)
-	return p.rawPost(body)
-}
-
-func (p *Processor) rawPost(body io.Reader) error {
-	resp, err := p.client.Post(p.apiURL.String(), "application/json", body)
+	value := delta
+	if m.Type == Gauge {
+		value = total
+	}
+	v, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid value for counter %s: %s", name, err)
 	}
-	defer resp.Body.Close() //nolint:errcheck
 
-	if resp.StatusCode > 299 || resp.StatusCode < 200 {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return fmt.Errorf("expected success status code, got %d", resp.StatusCode)
-		}
+	t, err := strconv.ParseFloat(total, 64)
+	if err == nil {
+		m.Counter = true
+		m.Total = t
+	}
+
+	switch m.Type {
+	case Rate:
+		v /= p.countInterval.Seconds()
+		m.Interval = p.countInterval
+	case Count:
+		m.Interval = p.countInterval
+	}
+	m.Value = v
+
+	return p.addMetric(m, msg)
+}
+
+func (p *Processor) counterType(name string) string {
+	switch t := p.metricTypes[name]; t {
+	case Gauge, Rate:
+		return t
+	default:
+		return Count
+	}
+}
+
+func (p *Processor) addMetric(m Metric, msg rfc5424.Message) error {
+	prefix := msg.Hostname
+	if p.metricPrefix != nil {
+		prefix = *p.metricPrefix
+	}
+	if prefix != "" {
+		m.Name = prefix + "." + m.Name
+	}
+	m.Host = msg.Hostname
+	m.Timestamp = msg.Timestamp
+
+	h := fnv.New32a()
+	h.Write([]byte(m.Host)) //nolint:errcheck
+	h.Write([]byte{0})      //nolint:errcheck
+	h.Write([]byte(m.Name)) //nolint:errcheck
+	w := p.workers[h.Sum32()%uint32(len(p.workers))]
 
-		return fmt.Errorf("expected success status code, got %d: %s", resp.StatusCode, body)
+	// A full queue means the worker is stuck writing, so the metric is
+	// dropped rather than holding up the metrics of every other worker.
+	atomic.AddInt64(&p.pending, 1)
+	select {
+	case w.metrics <- m:
+	default:
+		atomic.AddInt64(&p.pending, -1)
+		atomic.AddUint64(&p.dropped, 1)
 	}
 
 	return nil
@@ -1,10 +1,11 @@
 package processor_test
 
 import (
-	"bytes"
-	"io"
-	"net/http"
+	"errors"
+	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
@@ -15,101 +16,432 @@ import (
 )
 
 var _ = Describe("Processor", func() {
-	It("posts metrics as rfc5424 message to datadog", func() {
-		var getterCalled bool
-		getter := func() ([]byte, bool) {
-			if getterCalled {
-				return nil, false
-			}
-			getterCalled = true
-			return buildGaugeMessage(), true
-		}
-		spyClient := &spyClient{}
-		p := processor.New(getter, spyClient, "https://an-api-addr", "an-api-key")
+	It("writes metrics from rfc5424 messages to the sink", func() {
+		sink := &spySink{}
+		p := processor.New(newGetter(buildGaugeMessage()), sink, flushFast)
 
 		go p.Run()
 
-		Eventually(spyClient.posts).Should(HaveLen(1))
-		post := spyClient.posts()[0]
-		Expect(post.url).To(Equal("https://an-api-addr/api/v1/series?api_key=an-api-key"))
-		Expect(post.contentType).To(Equal("application/json"))
-		Expect(post.body).To(MatchJSON(`{
-			"series": [
-				{
-					"metric": "myhostname.cpu",
-					"points": [[0, 0.23]],
-					"type": "gauge",
-					"host": "myhostname",
-					"tags": ["instance_id:4"]
-				}
-			]
-		}`))
+		Eventually(sink.writes).Should(HaveLen(1))
+		Expect(withoutTimestamps(sink.writes()[0])).To(Equal([]processor.Metric{
+			{
+				Name:  "myhostname.cpu",
+				Type:  processor.Gauge,
+				Value: 0.23,
+				Unit:  "percentage",
+				Host:  "myhostname",
+				Tags:  []processor.Tag{{Key: "instance_id", Value: "4"}},
+			},
+		}))
 	})
 
 	It("ignores messages that are not proper rfc5424 messages", func() {
-		var getterCalled bool
+		sink := &spySink{}
+		p := processor.New(newGetter([]byte("bunch o garbage")), sink, flushFast)
+
+		go p.Run()
+
+		Consistently(sink.writes).Should(BeEmpty())
+	})
+
+	It("processes counter metrics as counts of the delta", func() {
+		sink := &spySink{}
+		p := processor.New(newGetter(buildCounterMessage()), sink, flushFast)
+
+		go p.Run()
+
+		Eventually(sink.writes).Should(HaveLen(1))
+		Expect(withoutTimestamps(sink.writes()[0])).To(Equal([]processor.Metric{
+			{
+				Name:     "myhostname.requests",
+				Type:     processor.Count,
+				Value:    5,
+				Counter:  true,
+				Total:    1234,
+				Interval: 10 * time.Second,
+				Host:     "myhostname",
+				Tags:     []processor.Tag{{Key: "instance_id", Value: "4"}},
+			},
+		}))
+	})
+
+	It("reports counters with the configured metric type", func() {
+		sink := &spySink{}
+		p := processor.New(
+			newGetter(buildCounterMessage()),
+			sink,
+			flushFast,
+			processor.WithMetricTypes(map[string]string{"requests": processor.Rate}),
+			processor.WithCountInterval(5*time.Second),
+		)
+
+		go p.Run()
+
+		Eventually(sink.writes).Should(HaveLen(1))
+		m := sink.writes()[0][0]
+		Expect(m.Type).To(Equal(processor.Rate))
+		Expect(m.Value).To(Equal(1.0))
+		Expect(m.Interval).To(Equal(5 * time.Second))
+		Expect(m.Total).To(Equal(1234.0))
+	})
+
+	It("ignores intervals that are not positive", func() {
+		sink := &spySink{}
+		p := processor.New(
+			newGetter(buildCounterMessage()),
+			sink,
+			processor.WithFlushInterval(0),
+			processor.WithMetricTypes(map[string]string{"requests": processor.Rate}),
+			processor.WithCountInterval(-time.Second),
+		)
+		go p.Run()
+
+		p.Stop()
+
+		Expect(sink.writes()).To(HaveLen(1))
+		m := sink.writes()[0][0]
+		Expect(m.Value).To(Equal(0.5))
+		Expect(m.Interval).To(Equal(10 * time.Second))
+	})
+
+	It("reports the counter total when configured as a gauge", func() {
+		sink := &spySink{}
+		p := processor.New(
+			newGetter(buildCounterMessage()),
+			sink,
+			flushFast,
+			processor.WithMetricTypes(map[string]string{"requests": processor.Gauge}),
+		)
+
+		go p.Run()
+
+		Eventually(sink.writes).Should(HaveLen(1))
+		m := sink.writes()[0][0]
+		Expect(m.Type).To(Equal(processor.Gauge))
+		Expect(m.Value).To(Equal(1234.0))
+		Expect(m.Interval).To(BeZero())
+	})
+
+	It("sends every metric structured data element", func() {
+		sink := &spySink{}
+		p := processor.New(newGetter(buildBloatedGaugeMessage()), sink, flushFast)
+
+		go p.Run()
+
+		Eventually(sink.writes).Should(HaveLen(1))
+		Consistently(sink.writes).Should(HaveLen(1))
+		Expect(sink.names()).To(Equal([]string{"myhostname.cpu", "myhostname.memory"}))
+	})
+
+	It("turns tags@ elements and extra parameters into tags", func() {
+		sink := &spySink{}
+		p := processor.New(newGetter(buildTaggedMessage()), sink, flushFast)
+
+		go p.Run()
+
+		Eventually(sink.writes).Should(HaveLen(1))
+		batch := sink.writes()[0]
+		Expect(batch).To(HaveLen(2))
+		Expect(batch[0].Tags).To(Equal([]processor.Tag{
+			{Key: "instance_id", Value: "4"},
+			{Key: "deployment", Value: "cf"},
+			{Key: "job", Value: "router"},
+			{Key: "core", Value: "1"},
+		}))
+		Expect(batch[1].Tags).To(Equal([]processor.Tag{
+			{Key: "instance_id", Value: "4"},
+			{Key: "deployment", Value: "cf"},
+			{Key: "job", Value: "router"},
+			{Key: "status", Value: "200"},
+		}))
+	})
+
+	It("only sends allowed tags", func() {
+		sink := &spySink{}
+		p := processor.New(
+			newGetter(buildTaggedMessage()),
+			sink,
+			flushFast,
+			processor.WithTagAllowlist([]string{"job", "status"}),
+		)
+
+		go p.Run()
+
+		Eventually(sink.writes).Should(HaveLen(1))
+		batch := sink.writes()[0]
+		Expect(batch[0].Tags).To(Equal([]processor.Tag{
+			{Key: "instance_id", Value: "4"},
+			{Key: "job", Value: "router"},
+		}))
+		Expect(batch[1].Tags).To(Equal([]processor.Tag{
+			{Key: "instance_id", Value: "4"},
+			{Key: "job", Value: "router"},
+			{Key: "status", Value: "200"},
+		}))
+	})
+
+	It("prefixes metric names with the configured prefix", func() {
+		sink := &spySink{}
+		p := processor.New(
+			newGetter(buildGaugeMessage()),
+			sink,
+			flushFast,
+			processor.WithMetricPrefix("cf.router"),
+		)
+
+		go p.Run()
+
+		Eventually(sink.names).Should(Equal([]string{"cf.router.cpu"}))
+	})
+
+	It("does not prefix metric names when the prefix is empty", func() {
+		sink := &spySink{}
+		p := processor.New(
+			newGetter(buildGaugeMessage()),
+			sink,
+			flushFast,
+			processor.WithMetricPrefix(""),
+		)
+
+		go p.Run()
+
+		Eventually(sink.names).Should(Equal([]string{"cpu"}))
+	})
+
+	It("waits on the wakeup channel instead of polling an empty getter", func() {
+		var calls int64
 		getter := func() ([]byte, bool) {
-			if getterCalled {
-				return nil, false
-			}
-			getterCalled = true
-			return []byte("bunch o garbage"), true
+			atomic.AddInt64(&calls, 1)
+			return nil, false
 		}
-		spyClient := &spyClient{}
-		p := processor.New(getter, spyClient, "", "an-api-key")
+		getCalls := func() int64 {
+			return atomic.LoadInt64(&calls)
+		}
+		wakeup := make(chan struct{})
+		p := processor.New(
+			getter,
+			&spySink{},
+			processor.WithFlushInterval(time.Hour),
+			processor.WithWakeup(wakeup),
+		)
 
 		go p.Run()
 
-		Consistently(spyClient.posts).Should(BeEmpty())
+		Eventually(getCalls).Should(Equal(int64(1)))
+		Consistently(getCalls).Should(Equal(int64(1)))
+
+		wakeup <- struct{}{}
+		Eventually(getCalls).Should(Equal(int64(2)))
 	})
 
-	It("processes counter metrics", func() {
-		var getterCalled bool
-		getter := func() ([]byte, bool) {
-			if getterCalled {
-				return nil, false
+	It("batches metrics into a single write", func() {
+		sink := &spySink{}
+		p := processor.New(
+			newGetter(buildGaugeMessage(), buildCounterMessage()),
+			sink,
+			processor.WithFlushInterval(100*time.Millisecond),
+		)
+
+		go p.Run()
+
+		Eventually(sink.writes).Should(HaveLen(1))
+		Expect(sink.names()).To(Equal([]string{"myhostname.cpu", "myhostname.requests"}))
+		Eventually(p.Stats).Should(Equal(processor.Stats{
+			Flushes: 1,
+			Posted:  2,
+		}))
+	})
+
+	It("writes early when the batch reaches the max payload size", func() {
+		sink := &spySink{}
+		p := processor.New(
+			newGetter(buildGaugeMessage(), buildGaugeMessage(), buildGaugeMessage()),
+			sink,
+			processor.WithFlushInterval(time.Hour),
+			processor.WithMaxPayloadBytes(400),
+		)
+
+		go p.Run()
+
+		Eventually(sink.writes).Should(HaveLen(1))
+		Expect(sink.writes()[0]).To(HaveLen(2))
+		Consistently(sink.writes).Should(HaveLen(1))
+		Expect(p.Stats().Pending).To(Equal(int64(1)))
+	})
+
+	It("writes pending metrics and drains the getter when stopped", func() {
+		sink := &spySink{}
+		p := processor.New(
+			newGetter(buildGaugeMessage(), buildCounterMessage()),
+			sink,
+			processor.WithFlushInterval(time.Hour),
+			processor.WithWorkers(4),
+		)
+		go p.Run()
+
+		p.Stop()
+
+		Expect(sink.names()).To(ConsistOf("myhostname.cpu", "myhostname.requests"))
+		Expect(p.Stats()).To(Equal(processor.Stats{
+			Flushes: 2,
+			Posted:  2,
+		}))
+	})
+
+	It("drops metrics instead of waiting for a worker that is stuck writing", func() {
+		var msgs [][]byte
+		for i := 0; i < 2000; i++ {
+			msgs = append(msgs, buildNamedGaugeMessage("cpu", i))
+		}
+		getter := newGetter(msgs...)
+		var got int64
+		countingGetter := func() ([]byte, bool) {
+			data, ok := getter()
+			if ok {
+				atomic.AddInt64(&got, 1)
 			}
-			getterCalled = true
-			return buildCounterMessage(), true
+			return data, ok
 		}
-		spyClient := &spyClient{}
-		p := processor.New(getter, spyClient, "https://an-api-addr", "an-api-key")
+		sink := &spySink{block: make(chan struct{})}
+		p := processor.New(
+			countingGetter,
+			sink,
+			processor.WithMaxPayloadBytes(1),
+		)
+		go p.Run()
+
+		Eventually(func() int64 { return atomic.LoadInt64(&got) }).Should(Equal(int64(2000)))
+		Expect(p.Stats().Dropped).To(BeNumerically(">", 0))
+		Expect(p.Stats().Pending).To(BeNumerically("<=", 1002))
+
+		close(sink.block)
+		p.Stop()
+
+		stats := p.Stats()
+		Expect(stats.Pending).To(BeZero())
+		Expect(stats.Posted + stats.Dropped).To(Equal(uint64(2000)))
+	})
 
+	It("keeps the points of a series in order across workers", func() {
+		var msgs [][]byte
+		for i := 0; i < 50; i++ {
+			msgs = append(msgs, buildNamedGaugeMessage("cpu", i), buildNamedGaugeMessage("memory", i))
+		}
+		sink := &spySink{latency: time.Millisecond}
+		p := processor.New(
+			newGetter(msgs...),
+			sink,
+			processor.WithMaxPayloadBytes(1),
+			processor.WithWorkers(4),
+		)
 		go p.Run()
+		p.Stop()
 
-		Eventually(spyClient.posts).Should(HaveLen(1))
-		post := spyClient.posts()[0]
-		Expect(post.url).To(Equal("https://an-api-addr/api/v1/series?api_key=an-api-key"))
-		Expect(post.contentType).To(Equal("application/json"))
-		Expect(post.body).To(MatchJSON(`{
-			"series": [
-				{
-					"metric": "myhostname.requests",
-					"points": [[0, 1234]],
-					"type": "gauge",
-					"host": "myhostname",
-					"tags": ["instance_id:4"]
-				}
-			]
-		}`))
+		values := map[string][]float64{}
+		for _, w := range sink.writes() {
+			for _, m := range w {
+				values[m.Name] = append(values[m.Name], m.Value)
+			}
+		}
+		Expect(values).To(HaveLen(2))
+		for _, v := range values {
+			Expect(v).To(HaveLen(50))
+			Expect(sort.Float64sAreSorted(v)).To(BeTrue())
+		}
 	})
 
-	It("only sends the first structured data element", func() {
-		var getterCalled bool
-		getter := func() ([]byte, bool) {
-			if getterCalled {
-				return nil, false
+	It("writes concurrently with multiple workers", func() {
+		duration := func(workers int) time.Duration {
+			var msgs [][]byte
+			for i := 0; i < 40; i++ {
+				msgs = append(msgs, buildNamedGaugeMessage(fmt.Sprintf("metric-%d", i), i))
 			}
-			getterCalled = true
-			return buildBloatedGaugeMessage(), true
+			sink := &spySink{latency: 20 * time.Millisecond}
+			p := processor.New(
+				newGetter(msgs...),
+				sink,
+				processor.WithMaxPayloadBytes(1),
+				processor.WithWorkers(workers),
+			)
+
+			start := time.Now()
+			go p.Run()
+			p.Stop()
+			Expect(sink.names()).To(HaveLen(40))
+
+			return time.Since(start)
+		}
+
+		single := duration(1)
+		Expect(single).To(BeNumerically(">=", 800*time.Millisecond))
+		Expect(duration(8)).To(BeNumerically("<", single/2))
+	})
+
+	It("retries writes that fail with a retryable error", func() {
+		sink := &spySink{
+			errs: []error{
+				processor.Retryable(errors.New("rate limited")),
+				processor.Retryable(errors.New("bad gateway")),
+			},
+		}
+		p := processor.New(
+			newGetter(buildGaugeMessage()),
+			sink,
+			flushFast,
+			processor.WithRetries(3, time.Millisecond),
+		)
+
+		go p.Run()
+
+		Eventually(sink.writes).Should(HaveLen(3))
+		Consistently(sink.writes).Should(HaveLen(3))
+		Expect(p.Stats()).To(Equal(processor.Stats{
+			Flushes: 1,
+			Posted:  1,
+			Retries: 2,
+		}))
+	})
+
+	It("drops the batch when retries are exhausted", func() {
+		err := processor.Retryable(errors.New("server error"))
+		sink := &spySink{
+			errs: []error{err, err, err},
 		}
-		spyClient := &spyClient{}
-		p := processor.New(getter, spyClient, "", "an-api-key")
+		p := processor.New(
+			newGetter(buildGaugeMessage()),
+			sink,
+			flushFast,
+			processor.WithRetries(2, time.Millisecond),
+		)
 
 		go p.Run()
 
-		Eventually(spyClient.posts).Should(HaveLen(1))
-		Consistently(spyClient.posts).Should(HaveLen(1))
+		Eventually(sink.writes).Should(HaveLen(3))
+		Eventually(p.Stats).Should(Equal(processor.Stats{
+			Flushes: 1,
+			Dropped: 1,
+			Retries: 2,
+		}))
+	})
+
+	It("does not retry errors that are not retryable", func() {
+		sink := &spySink{
+			errs: []error{errors.New("bad request")},
+		}
+		p := processor.New(
+			newGetter(buildGaugeMessage()),
+			sink,
+			flushFast,
+			processor.WithRetries(3, time.Millisecond),
+		)
+
+		go p.Run()
+
+		Eventually(p.Stats).Should(Equal(processor.Stats{
+			Flushes: 1,
+			Dropped: 1,
+		}))
+		Expect(sink.writes()).To(HaveLen(1))
 	})
 })
 
@@ -229,40 +561,139 @@ func buildBloatedGaugeMessage() []byte {
 	return data
 }
 
-type post struct {
-	url         string
-	contentType string
-	body        []byte
+func buildTaggedMessage() []byte {
+	m := rfc5424.Message{
+		Priority:  rfc5424.Daemon | rfc5424.Info,
+		Timestamp: time.Unix(0, 0),
+		Hostname:  "myhostname",
+		AppName:   "someapp",
+		ProcessID: "[4]",
+		StructuredData: []rfc5424.StructuredData{
+			{
+				ID: "gauge@47450",
+				Parameters: []rfc5424.SDParam{
+					{Name: "name", Value: "cpu"},
+					{Name: "value", Value: "0.23"},
+					{Name: "unit", Value: "percentage"},
+					{Name: "core", Value: "1"},
+				},
+			},
+			{
+				ID: "tags@47450",
+				Parameters: []rfc5424.SDParam{
+					{Name: "deployment", Value: "cf"},
+					{Name: "job", Value: "router"},
+				},
+			},
+			{
+				ID: "counter@47450",
+				Parameters: []rfc5424.SDParam{
+					{Name: "name", Value: "requests"},
+					{Name: "total", Value: "1234"},
+					{Name: "delta", Value: "5"},
+					{Name: "status", Value: "200"},
+				},
+			},
+		},
+	}
+
+	data, err := m.MarshalBinary()
+	Expect(err).ToNot(HaveOccurred())
+	return data
 }
 
-type spyClient struct {
-	mu     sync.Mutex
-	_posts []post
+func buildNamedGaugeMessage(name string, value int) []byte {
+	m := rfc5424.Message{
+		Priority:  rfc5424.Daemon | rfc5424.Info,
+		Timestamp: time.Unix(0, 0),
+		Hostname:  "myhostname",
+		AppName:   "someapp",
+		ProcessID: "[4]",
+		StructuredData: []rfc5424.StructuredData{
+			{
+				ID: "gauge@47450",
+				Parameters: []rfc5424.SDParam{
+					{Name: "name", Value: name},
+					{Name: "value", Value: fmt.Sprintf("%d", value)},
+				},
+			},
+		},
+	}
+
+	data, err := m.MarshalBinary()
+	Expect(err).ToNot(HaveOccurred())
+	return data
 }
 
-func (s *spyClient) posts() []post {
+var flushFast = processor.WithFlushInterval(10 * time.Millisecond)
+
+// newGetter returns a Getter that returns each message once.
+func newGetter(msgs ...[]byte) processor.Getter {
+	return func() ([]byte, bool) {
+		if len(msgs) == 0 {
+			return nil, false
+		}
+		m := msgs[0]
+		msgs = msgs[1:]
+		return m, true
+	}
+}
+
+type spySink struct {
+	mu      sync.Mutex
+	_writes [][]processor.Metric
+	errs    []error
+	latency time.Duration
+	// block holds up every write until it is closed, if set.
+	block chan struct{}
+}
+
+func (s *spySink) Write(metrics []processor.Metric) error {
+	time.Sleep(s.latency)
+	if s.block != nil {
+		<-s.block
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s._posts
+
+	s._writes = append(s._writes, metrics)
+
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+
+	return nil
 }
 
-func (s *spyClient) Post(url, contentType string, body io.Reader) (*http.Response, error) {
+func (s *spySink) writes() [][]processor.Metric {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s._writes
+}
 
-	buf := bytes.NewBuffer(nil)
-	_, err := buf.ReadFrom(body)
-	Expect(err).ToNot(HaveOccurred())
+// withoutTimestamps checks every metric has the timestamp of the test
+// messages and clears it so metrics can be compared regardless of location.
+func withoutTimestamps(metrics []processor.Metric) []processor.Metric {
+	for i := range metrics {
+		Expect(metrics[i].Timestamp.Equal(time.Unix(0, 0))).To(BeTrue())
+		metrics[i].Timestamp = time.Time{}
+	}
+	return metrics
+}
 
-	s._posts = append(s._posts, post{
-		url,
-		contentType,
-		buf.Bytes(),
-	})
+// names returns the name of every metric written.
+func (s *spySink) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return &http.Response{
-			StatusCode: 201,
-			Body:       io.NopCloser(bytes.NewBuffer(nil)),
-		},
-		nil
+	var names []string
+	for _, w := range s._writes {
+		for _, m := range w {
+			names = append(names, m.Name)
+		}
+	}
+	return names
 }
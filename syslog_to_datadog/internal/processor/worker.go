@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// worker batches the metrics of its shard and writes them to the sink.
+type worker struct {
+	p       *Processor
+	metrics chan Metric
+
+	batch     []Metric
+	batchSize int
+}
+
+func newWorker(p *Processor) *worker {
+	return &worker{
+		p:       p,
+		metrics: make(chan Metric, 1000),
+	}
+}
+
+// run batches metrics until the metrics channel is closed, then writes the
+// last batch.
+func (w *worker) run() {
+	ticker := time.NewTicker(w.p.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case m, ok := <-w.metrics:
+			if !ok {
+				w.flush()
+				return
+			}
+
+			err := w.add(m)
+			if err != nil {
+				log.Printf("failed to batch metric %s: %s", m.Name, err)
+				atomic.AddInt64(&w.p.pending, -1)
+			}
+		case <-ticker.C:
+			w.flush()
+		}
+	}
+}
+
+func (w *worker) add(m Metric) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	// Account for the comma separating the metrics in a JSON payload.
+	size := len(data) + 1
+	if len(w.batch) > 0 && w.batchSize+size > w.p.maxPayloadBytes {
+		w.flush()
+	}
+
+	w.batch = append(w.batch, m)
+	w.batchSize += size
+
+	return nil
+}
+
+func (w *worker) flush() {
+	if len(w.batch) == 0 {
+		return
+	}
+
+	n := uint64(len(w.batch))
+	err := w.write(w.batch)
+	if err != nil {
+		log.Printf("failed to write %d metrics: %s", n, err)
+		atomic.AddUint64(&w.p.dropped, n)
+	} else {
+		atomic.AddUint64(&w.p.posted, n)
+	}
+	atomic.AddUint64(&w.p.flushes, 1)
+	atomic.AddInt64(&w.p.pending, -int64(n))
+
+	w.batch = nil
+	w.batchSize = 0
+}
+
+func (w *worker) write(batch []Metric) error {
+	backoff := w.p.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := w.p.sink.Write(batch)
+		if err == nil || !IsRetryable(err) || attempt >= w.p.maxRetries {
+			return err
+		}
+
+		log.Printf("retrying write in %s: %s", backoff, err)
+		atomic.AddUint64(&w.p.retries, 1)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,106 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"log"
+	"net/url"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
+)
+
+const (
+	datadogAPIEndpoint = "/api/v2/series"
+)
+
+// seriesTypes are the v2 series API's values for the metric types.
+var seriesTypes = map[string]int{
+	processor.Count: 1,
+	processor.Rate:  2,
+	processor.Gauge: 3,
+}
+
+// Datadog writes metrics to the datadog v2 series API, which unlike the v1
+// API accepts the unit of each series.
+type Datadog struct {
+	client HTTPClient
+	apiURL *url.URL
+	apiKey string
+}
+
+// NewDatadog creates a new Datadog sink.
+func NewDatadog(c HTTPClient, apiBaseURL, apiKey string) *Datadog {
+	apiURL, err := url.Parse(apiBaseURL + datadogAPIEndpoint)
+	if err != nil {
+		log.Fatalf("Failed to parse datadog URL: %s", err)
+	}
+
+	return &Datadog{
+		client: c,
+		apiURL: apiURL,
+		apiKey: apiKey,
+	}
+}
+
+// Write posts the metrics as a single gzipped payload.
+func (d *Datadog) Write(metrics []processor.Metric) error {
+	var pl payload
+	for _, m := range metrics {
+		s := series{
+			Metric:    m.Name,
+			Points:    []point{{Timestamp: m.Timestamp.Unix(), Value: m.Value}},
+			Type:      seriesTypes[m.Type],
+			Interval:  int64(m.Interval.Seconds()),
+			Unit:      m.Unit,
+			Resources: []resource{{Name: m.Host, Type: "host"}},
+		}
+		for _, t := range m.Tags {
+			s.Tags = append(s.Tags, t.Key+":"+t.Value)
+		}
+		pl.Series = append(pl.Series, s)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	err := json.NewEncoder(gz).Encode(pl)
+	if err != nil {
+		return err
+	}
+	err = gz.Close()
+	if err != nil {
+		return err
+	}
+
+	return post(d.client, d.apiURL.String(), buf.Bytes(), map[string]string{
+		"Content-Type":     "application/json",
+		"Content-Encoding": "gzip",
+		"DD-API-KEY":       d.apiKey,
+	})
+}
+
+type payload struct {
+	Series []series `json:"series"`
+}
+
+type series struct {
+	Metric    string     `json:"metric"`
+	Points    []point    `json:"points"`
+	Type      int        `json:"type"`
+	Interval  int64      `json:"interval,omitempty"`
+	Unit      string     `json:"unit,omitempty"`
+	Resources []resource `json:"resources"`
+	Tags      []string   `json:"tags"`
+}
+
+// point is a timestamp in seconds and a value.
+type point struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// resource is the host the series was reported from.
+type resource struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
@@ -0,0 +1,73 @@
+package sink_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/sink"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Datadog", func() {
+	It("posts gzipped series to the datadog API", func() {
+		server := newFakeServer()
+		defer server.Close()
+		d := sink.NewDatadog(http.DefaultClient, server.URL, "an-api-key")
+
+		Expect(d.Write(testMetrics())).To(Succeed())
+
+		req := server.lastRequest()
+		Expect(req.path).To(Equal("/api/v2/series"))
+		Expect(req.headers.Get("DD-API-KEY")).To(Equal("an-api-key"))
+		Expect(req.headers.Get("Content-Type")).To(Equal("application/json"))
+		Expect(req.headers.Get("Content-Encoding")).To(Equal("gzip"))
+
+		gz, err := gzip.NewReader(req.bodyReader())
+		Expect(err).ToNot(HaveOccurred())
+		body, err := io.ReadAll(gz)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(body).To(MatchJSON(`{
+			"series": [
+				{
+					"metric": "myhostname.cpu",
+					"points": [{"timestamp": 1, "value": 0.23}],
+					"type": 3,
+					"unit": "percentage",
+					"resources": [{"name": "myhostname", "type": "host"}],
+					"tags": ["instance_id:4"]
+				},
+				{
+					"metric": "myhostname.requests",
+					"points": [{"timestamp": 1, "value": 5}],
+					"type": 1,
+					"interval": 10,
+					"resources": [{"name": "myhostname", "type": "host"}],
+					"tags": ["instance_id:4", "status:200"]
+				}
+			]
+		}`))
+	})
+
+	It("returns retryable errors for rate limits and server errors", func() {
+		server := newFakeServer(http.StatusTooManyRequests, http.StatusBadGateway)
+		defer server.Close()
+		d := sink.NewDatadog(http.DefaultClient, server.URL, "an-api-key")
+
+		Expect(processor.IsRetryable(d.Write(testMetrics()))).To(BeTrue())
+		Expect(processor.IsRetryable(d.Write(testMetrics()))).To(BeTrue())
+	})
+
+	It("returns errors that are not retryable for client errors", func() {
+		server := newFakeServer(http.StatusBadRequest)
+		defer server.Close()
+		d := sink.NewDatadog(http.DefaultClient, server.URL, "an-api-key")
+
+		err := d.Write(testMetrics())
+		Expect(err).To(HaveOccurred())
+		Expect(processor.IsRetryable(err)).To(BeFalse())
+	})
+})
@@ -0,0 +1,97 @@
+package sink_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
+
+	. "github.com/onsi/gomega"
+)
+
+type request struct {
+	path    string
+	query   string
+	headers http.Header
+	body    []byte
+}
+
+// fakeServer records every request and responds with the scripted status
+// codes, then 200s.
+type fakeServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	_requests   []request
+	statusCodes []int
+}
+
+func newFakeServer(statusCodes ...int) *fakeServer {
+	f := &fakeServer{statusCodes: statusCodes}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+func (f *fakeServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	Expect(err).ToNot(HaveOccurred())
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f._requests = append(f._requests, request{
+		path:    r.URL.Path,
+		query:   r.URL.RawQuery,
+		headers: r.Header,
+		body:    body,
+	})
+
+	if len(f.statusCodes) > 0 {
+		w.WriteHeader(f.statusCodes[0])
+		f.statusCodes = f.statusCodes[1:]
+	}
+}
+
+func (f *fakeServer) requests() []request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f._requests
+}
+
+func (f *fakeServer) lastRequest() request {
+	reqs := f.requests()
+	Expect(reqs).ToNot(BeEmpty())
+	return reqs[len(reqs)-1]
+}
+
+func (r request) bodyReader() io.Reader {
+	return bytes.NewReader(r.body)
+}
+
+func testMetrics() []processor.Metric {
+	return []processor.Metric{
+		{
+			Name:      "myhostname.cpu",
+			Type:      processor.Gauge,
+			Value:     0.23,
+			Unit:      "percentage",
+			Timestamp: time.Unix(1, 0),
+			Host:      "myhostname",
+			Tags:      []processor.Tag{{Key: "instance_id", Value: "4"}},
+		},
+		{
+			Name:      "myhostname.requests",
+			Type:      processor.Count,
+			Value:     5,
+			Counter:   true,
+			Total:     1234,
+			Interval:  10 * time.Second,
+			Timestamp: time.Unix(1, 0),
+			Host:      "myhostname",
+			Tags:      []processor.Tag{{Key: "instance_id", Value: "4"}, {Key: "status", Value: "200"}},
+		},
+	}
+}
@@ -0,0 +1,48 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
+)
+
+// HTTPClient is used to communicate with HTTP based sinks.
+type HTTPClient interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
+// post sends the body to the given url. Transport errors, 429s and 5xxs
+// are marked as retryable.
+func post(c HTTPClient, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return processor.Retryable(err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+
+	if resp.StatusCode > 299 || resp.StatusCode < 200 {
+		body, readErr := io.ReadAll(resp.Body)
+		err = fmt.Errorf("expected success status code, got %d: %s", resp.StatusCode, body)
+		if readErr != nil {
+			err = fmt.Errorf("expected success status code, got %d", resp.StatusCode)
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return processor.Retryable(err)
+		}
+		return err
+	}
+
+	return nil
+}
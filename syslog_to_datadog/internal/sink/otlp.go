@@ -0,0 +1,153 @@
+package sink
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
+)
+
+// aggregationTemporalityCumulative is the OTLP enum value for sums that
+// report a running total.
+const aggregationTemporalityCumulative = 2
+
+// OTLP writes metrics to an OpenTelemetry OTLP/HTTP metrics endpoint using
+// the JSON encoding.
+type OTLP struct {
+	client HTTPClient
+	url    string
+}
+
+// NewOTLP creates a new OTLP sink that posts to the given URL, typically
+// ending in /v1/metrics.
+func NewOTLP(c HTTPClient, url string) *OTLP {
+	return &OTLP{
+		client: c,
+		url:    url,
+	}
+}
+
+// Write posts the metrics grouped by host. Counters are written as
+// cumulative monotonic sums of the counter's total, everything else is
+// written as a gauge.
+func (o *OTLP) Write(metrics []processor.Metric) error {
+	var req otlpRequest
+	resources := map[string]int{}
+	for _, m := range metrics {
+		i, ok := resources[m.Host]
+		if !ok {
+			i = len(req.ResourceMetrics)
+			resources[m.Host] = i
+			req.ResourceMetrics = append(req.ResourceMetrics, otlpResourceMetrics{
+				Resource: otlpResource{
+					Attributes: []otlpAttribute{stringAttribute("host.name", m.Host)},
+				},
+				ScopeMetrics: []otlpScopeMetrics{{
+					Scope: otlpScope{Name: "syslog_to_datadog"},
+				}},
+			})
+		}
+
+		sm := &req.ResourceMetrics[i].ScopeMetrics[0]
+		sm.Metrics = append(sm.Metrics, otlpMetricFor(m))
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	return post(o.client, o.url, body, map[string]string{
+		"Content-Type": "application/json",
+	})
+}
+
+func otlpMetricFor(m processor.Metric) otlpMetric {
+	dp := otlpDataPoint{
+		TimeUnixNano: strconv.FormatInt(m.Timestamp.UnixNano(), 10),
+		AsDouble:     m.Value,
+	}
+	for _, t := range m.Tags {
+		dp.Attributes = append(dp.Attributes, stringAttribute(t.Key, t.Value))
+	}
+
+	om := otlpMetric{
+		Name: m.Name,
+		Unit: m.Unit,
+	}
+	if m.Counter {
+		dp.AsDouble = m.Total
+		om.Sum = &otlpSum{
+			DataPoints:             []otlpDataPoint{dp},
+			AggregationTemporality: aggregationTemporalityCumulative,
+			IsMonotonic:            true,
+		}
+		return om
+	}
+
+	om.Gauge = &otlpGauge{
+		DataPoints: []otlpDataPoint{dp},
+	}
+	return om
+}
+
+func stringAttribute(k, v string) otlpAttribute {
+	return otlpAttribute{
+		Key:   k,
+		Value: otlpValue{StringValue: v},
+	}
+}
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Unit  string     `json:"unit,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
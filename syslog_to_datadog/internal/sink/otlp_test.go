@@ -0,0 +1,71 @@
+package sink_test
+
+import (
+	"net/http"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/sink"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OTLP", func() {
+	It("posts gauges and cumulative sums grouped by host", func() {
+		server := newFakeServer()
+		defer server.Close()
+		o := sink.NewOTLP(http.DefaultClient, server.URL+"/v1/metrics")
+
+		Expect(o.Write(testMetrics())).To(Succeed())
+
+		req := server.lastRequest()
+		Expect(req.path).To(Equal("/v1/metrics"))
+		Expect(req.headers.Get("Content-Type")).To(Equal("application/json"))
+		Expect(req.body).To(MatchJSON(`{
+			"resourceMetrics": [{
+				"resource": {
+					"attributes": [{"key": "host.name", "value": {"stringValue": "myhostname"}}]
+				},
+				"scopeMetrics": [{
+					"scope": {"name": "syslog_to_datadog"},
+					"metrics": [
+						{
+							"name": "myhostname.cpu",
+							"unit": "percentage",
+							"gauge": {
+								"dataPoints": [{
+									"attributes": [{"key": "instance_id", "value": {"stringValue": "4"}}],
+									"timeUnixNano": "1000000000",
+									"asDouble": 0.23
+								}]
+							}
+						},
+						{
+							"name": "myhostname.requests",
+							"sum": {
+								"dataPoints": [{
+									"attributes": [
+										{"key": "instance_id", "value": {"stringValue": "4"}},
+										{"key": "status", "value": {"stringValue": "200"}}
+									],
+									"timeUnixNano": "1000000000",
+									"asDouble": 1234
+								}],
+								"aggregationTemporality": 2,
+								"isMonotonic": true
+							}
+						}
+					]
+				}]
+			}]
+		}`))
+	})
+
+	It("returns retryable errors for rate limits", func() {
+		server := newFakeServer(http.StatusTooManyRequests)
+		defer server.Close()
+		o := sink.NewOTLP(http.DefaultClient, server.URL)
+
+		Expect(processor.IsRetryable(o.Write(testMetrics()))).To(BeTrue())
+	})
+})
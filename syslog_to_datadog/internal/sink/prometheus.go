@@ -0,0 +1,139 @@
+package sink
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
+)
+
+// Prometheus writes metrics to a Prometheus remote-write endpoint.
+type Prometheus struct {
+	client HTTPClient
+	url    string
+}
+
+// NewPrometheus creates a new Prometheus sink that posts to the given
+// remote-write URL.
+func NewPrometheus(c HTTPClient, url string) *Prometheus {
+	return &Prometheus{
+		client: c,
+		url:    url,
+	}
+}
+
+// Write posts the metrics as a snappy compressed remote-write request.
+// Counters are written as <name>_total with the counter's total, everything
+// else is written with its value. The host is written as the host label.
+func (p *Prometheus) Write(metrics []processor.Metric) error {
+	var req []byte
+	for _, m := range metrics {
+		req = appendBytesField(req, 1, timeSeries(m))
+	}
+
+	return post(p.client, p.url, snappyEncode(req), map[string]string{
+		"Content-Type":                      "application/x-protobuf",
+		"Content-Encoding":                  "snappy",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	})
+}
+
+// timeSeries encodes a metric as a prometheus.TimeSeries protobuf message.
+func timeSeries(m processor.Metric) []byte {
+	name := promName(m.Name)
+	value := m.Value
+	if m.Counter {
+		name += "_total"
+		value = m.Total
+	}
+
+	labels := map[string]string{}
+	for _, t := range m.Tags {
+		labels[promName(t.Key)] = t.Value
+	}
+	if m.Host != "" {
+		labels["host"] = m.Host
+	}
+	labels["__name__"] = name
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var ts []byte
+	for _, k := range keys {
+		var label []byte
+		label = appendBytesField(label, 1, []byte(k))
+		label = appendBytesField(label, 2, []byte(labels[k]))
+		ts = appendBytesField(ts, 1, label)
+	}
+
+	var sample []byte
+	sample = appendVarint(sample, 1<<3|1)
+	sample = binary.LittleEndian.AppendUint64(sample, math.Float64bits(value))
+	sample = appendVarint(sample, 2<<3)
+	sample = appendVarint(sample, uint64(m.Timestamp.UnixNano()/1e6))
+
+	return appendBytesField(ts, 2, sample)
+}
+
+// promName replaces the characters that are not valid in Prometheus metric
+// and label names with underscores.
+func promName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+
+	return name
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	return binary.AppendUvarint(b, v)
+}
+
+// appendBytesField appends a length delimited protobuf field.
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = appendVarint(b, uint64(field)<<3|2)
+	b = appendVarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// snappyEncode encodes b in the snappy block format using only literals.
+// It does not compress the data but can be read by any snappy decoder.
+func snappyEncode(b []byte) []byte {
+	out := appendVarint(nil, uint64(len(b)))
+	for len(b) > 0 {
+		n := len(b)
+		if n > 1<<16 {
+			n = 1 << 16
+		}
+
+		l := n - 1
+		switch {
+		case l < 60:
+			out = append(out, byte(l<<2))
+		case l < 1<<8:
+			out = append(out, 60<<2, byte(l))
+		default:
+			out = append(out, 61<<2, byte(l), byte(l>>8))
+		}
+
+		out = append(out, b[:n]...)
+		b = b[n:]
+	}
+
+	return out
+}
@@ -0,0 +1,186 @@
+package sink_test
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/sink"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Prometheus", func() {
+	It("posts a snappy compressed remote-write request", func() {
+		server := newFakeServer()
+		defer server.Close()
+		p := sink.NewPrometheus(http.DefaultClient, server.URL+"/api/v1/write")
+
+		Expect(p.Write(testMetrics())).To(Succeed())
+
+		req := server.lastRequest()
+		Expect(req.path).To(Equal("/api/v1/write"))
+		Expect(req.headers.Get("Content-Type")).To(Equal("application/x-protobuf"))
+		Expect(req.headers.Get("Content-Encoding")).To(Equal("snappy"))
+		Expect(req.headers.Get("X-Prometheus-Remote-Write-Version")).To(Equal("0.1.0"))
+
+		Expect(decodeWriteRequest(snappyDecode(req.body))).To(Equal([]timeSeries{
+			{
+				labels: []string{
+					"__name__=myhostname_cpu",
+					"host=myhostname",
+					"instance_id=4",
+				},
+				value:     0.23,
+				timestamp: 1000,
+			},
+			{
+				labels: []string{
+					"__name__=myhostname_requests_total",
+					"host=myhostname",
+					"instance_id=4",
+					"status=200",
+				},
+				value:     1234,
+				timestamp: 1000,
+			},
+		}))
+	})
+
+	It("sanitizes metric and label names", func() {
+		server := newFakeServer()
+		defer server.Close()
+		p := sink.NewPrometheus(http.DefaultClient, server.URL)
+
+		err := p.Write([]processor.Metric{{
+			Name: "2xx.responses-count",
+			Tags: []processor.Tag{{Key: "app.name", Value: "my-app"}},
+		}})
+		Expect(err).ToNot(HaveOccurred())
+
+		series := decodeWriteRequest(snappyDecode(server.lastRequest().body))
+		Expect(series[0].labels).To(Equal([]string{
+			"__name__=_2xx_responses_count",
+			"app_name=my-app",
+		}))
+	})
+
+	It("returns retryable errors for server errors", func() {
+		server := newFakeServer(http.StatusServiceUnavailable)
+		defer server.Close()
+		p := sink.NewPrometheus(http.DefaultClient, server.URL)
+
+		Expect(processor.IsRetryable(p.Write(testMetrics()))).To(BeTrue())
+	})
+})
+
+type timeSeries struct {
+	labels    []string
+	value     float64
+	timestamp int64
+}
+
+// snappyDecode decodes a snappy block. It only supports literals, which is
+// all the sink writes.
+func snappyDecode(b []byte) []byte {
+	n, l := binary.Uvarint(b)
+	Expect(l).To(BeNumerically(">", 0))
+	b = b[l:]
+
+	var out []byte
+	for len(b) > 0 {
+		tag := b[0]
+		Expect(tag&3).To(BeZero(), "only literals are supported")
+
+		length := int(tag >> 2)
+		b = b[1:]
+		switch length {
+		case 60:
+			length = int(b[0])
+			b = b[1:]
+		case 61:
+			length = int(b[0]) | int(b[1])<<8
+			b = b[2:]
+		}
+		length++
+
+		out = append(out, b[:length]...)
+		b = b[length:]
+	}
+	Expect(out).To(HaveLen(int(n)))
+
+	return out
+}
+
+type field struct {
+	num     int
+	varint  uint64
+	fixed64 uint64
+	bytes   []byte
+}
+
+// decodeFields decodes the fields of a protobuf message.
+func decodeFields(b []byte) []field {
+	var fields []field
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		Expect(n).To(BeNumerically(">", 0))
+		b = b[n:]
+
+		f := field{num: int(key >> 3)}
+		switch key & 7 {
+		case 0:
+			f.varint, n = binary.Uvarint(b)
+			b = b[n:]
+		case 1:
+			f.fixed64 = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			b = b[n:]
+			f.bytes = b[:l]
+			b = b[l:]
+		default:
+			Fail("unexpected wire type")
+		}
+		fields = append(fields, f)
+	}
+
+	return fields
+}
+
+func decodeWriteRequest(b []byte) []timeSeries {
+	var series []timeSeries
+	for _, tsField := range decodeFields(b) {
+		Expect(tsField.num).To(Equal(1))
+
+		var ts timeSeries
+		for _, f := range decodeFields(tsField.bytes) {
+			switch f.num {
+			case 1:
+				var name, value string
+				for _, lf := range decodeFields(f.bytes) {
+					if lf.num == 1 {
+						name = string(lf.bytes)
+					} else {
+						value = string(lf.bytes)
+					}
+				}
+				ts.labels = append(ts.labels, name+"="+value)
+			case 2:
+				for _, sf := range decodeFields(f.bytes) {
+					if sf.num == 1 {
+						ts.value = math.Float64frombits(sf.fixed64)
+					} else {
+						ts.timestamp = int64(sf.varint)
+					}
+				}
+			}
+		}
+		series = append(series, ts)
+	}
+
+	return series
+}
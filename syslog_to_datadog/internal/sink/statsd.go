@@ -0,0 +1,90 @@
+package sink
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
+)
+
+// maxDatagramBytes keeps datagrams within the payload of a 1500 byte MTU.
+const maxDatagramBytes = 1432
+
+// StatsD writes metrics to a StatsD server over UDP. Tags are written using
+// the DogStatsD extension.
+type StatsD struct {
+	conn net.Conn
+}
+
+// NewStatsD creates a new StatsD sink that writes to the given address.
+func NewStatsD(addr string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatsD{
+		conn: conn,
+	}, nil
+}
+
+// Write sends the metrics in as few datagrams as possible. Count metrics
+// are written as StatsD counters of their delta, everything else is written
+// as a gauge. Timestamps are not sent; StatsD uses the time of receipt.
+func (s *StatsD) Write(metrics []processor.Metric) error {
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		line := statsdLine(m)
+		if buf.Len() > 0 && buf.Len()+1+len(line) > maxDatagramBytes {
+			err := s.send(buf.Bytes())
+			if err != nil {
+				return err
+			}
+			buf.Reset()
+		}
+
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+
+	if buf.Len() == 0 {
+		return nil
+	}
+	return s.send(buf.Bytes())
+}
+
+func (s *StatsD) send(b []byte) error {
+	_, err := s.conn.Write(b)
+	return err
+}
+
+func statsdLine(m processor.Metric) string {
+	typ := "g"
+	if m.Type == processor.Count {
+		typ = "c"
+	}
+
+	line := statsdName.Replace(m.Name) + ":" + strconv.FormatFloat(m.Value, 'f', -1, 64) + "|" + typ
+
+	var tags []string
+	for _, t := range m.Tags {
+		tags = append(tags, statsdTag.Replace(t.Key)+":"+statsdTag.Replace(t.Value))
+	}
+	if m.Host != "" {
+		tags = append(tags, "host:"+statsdTag.Replace(m.Host))
+	}
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+
+	return line
+}
+
+var (
+	statsdName = strings.NewReplacer(":", "_", "|", "_", "@", "_", "\n", "_")
+	statsdTag  = strings.NewReplacer(",", "_", "|", "_", "\n", "_")
+)
@@ -0,0 +1,72 @@
+package sink_test
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/sink"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StatsD", func() {
+	var (
+		conn net.PacketConn
+	)
+
+	BeforeEach(func() {
+		var err error
+		conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		conn.Close() //nolint:errcheck
+	})
+
+	It("writes counters and gauges with DogStatsD tags", func() {
+		s, err := sink.NewStatsD(conn.LocalAddr().String())
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(s.Write(testMetrics())).To(Succeed())
+
+		Expect(readDatagram(conn)).To(Equal(strings.Join([]string{
+			"myhostname.cpu:0.23|g|#instance_id:4,host:myhostname",
+			"myhostname.requests:5|c|#instance_id:4,status:200,host:myhostname",
+		}, "\n")))
+	})
+
+	It("splits large batches into several datagrams", func() {
+		s, err := sink.NewStatsD(conn.LocalAddr().String())
+		Expect(err).ToNot(HaveOccurred())
+
+		var metrics []processor.Metric
+		for i := 0; i < 100; i++ {
+			metrics = append(metrics, processor.Metric{
+				Name:  "some.long.metric.name",
+				Type:  processor.Gauge,
+				Value: 1,
+			})
+		}
+		Expect(s.Write(metrics)).To(Succeed())
+
+		var lines int
+		for lines < 100 {
+			d := readDatagram(conn)
+			Expect(len(d)).To(BeNumerically("<=", 1432))
+			lines += len(strings.Split(d, "\n"))
+		}
+		Expect(lines).To(Equal(100))
+	})
+})
+
+func readDatagram(conn net.PacketConn) string {
+	buf := make([]byte, 65536)
+	Expect(conn.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+	n, _, err := conn.ReadFrom(buf)
+	Expect(err).ToNot(HaveOccurred())
+	return string(buf[:n])
+}
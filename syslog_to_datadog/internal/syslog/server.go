@@ -0,0 +1,130 @@
+package syslog
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"code.cloudfoundry.org/rfc5424"
+)
+
+// Setter is a func that can receive an rfc5424 encoded message.
+type Setter func([]byte)
+
+// Server receives RFC 5425 style octet counted streams of rfc 5424
+// messages. Wrap the listener with tls.NewListener to receive them over
+// TLS. To require client certificates set ClientAuth on the tls.Config.
+type Server struct {
+	listener net.Listener
+	setter   Setter
+	rejected uint64
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	wg    sync.WaitGroup
+}
+
+// NewServer returns a new Server that accepts connections on the given
+// listener.
+func NewServer(lis net.Listener, s Setter) *Server {
+	return &Server{
+		listener: lis,
+		setter:   s,
+		conns:    make(map[net.Conn]bool),
+	}
+}
+
+// Serve accepts connections and calls the Server's Setter func with every
+// message read from them. It blocks until the listener fails or the Server
+// is closed, in which case it returns net.ErrClosed.
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+// Close stops accepting connections and closes the open ones. It blocks
+// until the messages that were already read are passed to the Setter.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close() //nolint:errcheck
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return err
+}
+
+// Rejected returns the number of TLS connections rejected during the
+// handshake, e.g. for a missing or untrusted client certificate.
+func (s *Server) Rejected() uint64 {
+	return atomic.LoadUint64(&s.rejected)
+}
+
+// Addr returns the address the listener is bound to.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close() //nolint:errcheck
+		s.wg.Done()
+	}()
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		err := tlsConn.Handshake()
+		if err != nil {
+			atomic.AddUint64(&s.rejected, 1)
+			log.Printf("tls handshake with %s failed: %s", conn.RemoteAddr(), err)
+			return
+		}
+	}
+
+	r := bufio.NewReader(conn)
+	for {
+		var msg rfc5424.Message
+		_, err := msg.ReadFrom(r)
+		if err != nil {
+			// The whole frame has been read when the message itself is
+			// malformed, so the stream can carry on with the next one.
+			if _, ok := err.(rfc5424.ErrBadFormat); ok {
+				continue
+			}
+
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Printf("failed to read from %s: %s", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		data, err := msg.MarshalBinary()
+		if err != nil {
+			continue
+		}
+
+		s.setter(data)
+	}
+}
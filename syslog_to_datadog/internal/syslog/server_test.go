@@ -0,0 +1,239 @@
+package syslog_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/syslog"
+	"code.cloudfoundry.org/rfc5424"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		spy *spySetter
+	)
+
+	BeforeEach(func() {
+		spy = &spySetter{}
+	})
+
+	It("reads every message of an octet counted stream", func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		s := syslog.NewServer(lis, spy.set)
+		go s.Serve()      //nolint:errcheck
+		defer lis.Close() //nolint:errcheck
+
+		conn, err := net.Dial("tcp", s.Addr())
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close() //nolint:errcheck
+
+		writeMessage(conn, "cpu")
+		writeMessage(conn, "memory")
+
+		Eventually(spy.names).Should(Equal([]string{"cpu", "memory"}))
+	})
+
+	It("skips malformed messages", func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		s := syslog.NewServer(lis, spy.set)
+		go s.Serve()      //nolint:errcheck
+		defer lis.Close() //nolint:errcheck
+
+		conn, err := net.Dial("tcp", s.Addr())
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close() //nolint:errcheck
+
+		writeMessage(conn, "cpu")
+		_, err = fmt.Fprintf(conn, "%d %s", len("garbage"), "garbage")
+		Expect(err).ToNot(HaveOccurred())
+		writeMessage(conn, "memory")
+
+		Eventually(spy.names).Should(Equal([]string{"cpu", "memory"}))
+	})
+
+	It("reads messages over TLS", func() {
+		cert := generateCertificate()
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		lis = tls.NewListener(lis, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		})
+		s := syslog.NewServer(lis, spy.set)
+		go s.Serve()      //nolint:errcheck
+		defer lis.Close() //nolint:errcheck
+
+		pool := x509.NewCertPool()
+		pool.AddCert(cert.Leaf)
+		conn, err := tls.Dial("tcp", s.Addr(), &tls.Config{
+			RootCAs:    pool,
+			ServerName: "localhost",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close() //nolint:errcheck
+
+		writeMessage(conn, "cpu")
+
+		Eventually(spy.names).Should(Equal([]string{"cpu"}))
+	})
+
+	It("requires client certificates when configured", func() {
+		serverCert := generateCertificate()
+		clientCert := generateCertificate()
+		clientCAs := x509.NewCertPool()
+		clientCAs.AddCert(clientCert.Leaf)
+
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		lis = tls.NewListener(lis, &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientCAs:    clientCAs,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		})
+		s := syslog.NewServer(lis, spy.set)
+		go s.Serve()      //nolint:errcheck
+		defer lis.Close() //nolint:errcheck
+
+		rootCAs := x509.NewCertPool()
+		rootCAs.AddCert(serverCert.Leaf)
+
+		conn, err := tls.Dial("tcp", s.Addr(), &tls.Config{
+			RootCAs:    rootCAs,
+			ServerName: "localhost",
+		})
+		if err == nil {
+			// TLS 1.3 clients only learn about the rejection when reading.
+			_, err = conn.Read(make([]byte, 1))
+			conn.Close() //nolint:errcheck
+		}
+		Expect(err).To(HaveOccurred())
+		Eventually(s.Rejected).Should(Equal(uint64(1)))
+
+		conn, err = tls.Dial("tcp", s.Addr(), &tls.Config{
+			RootCAs:      rootCAs,
+			ServerName:   "localhost",
+			Certificates: []tls.Certificate{clientCert},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close() //nolint:errcheck
+
+		writeMessage(conn, "cpu")
+
+		Eventually(spy.names).Should(Equal([]string{"cpu"}))
+		Expect(s.Rejected()).To(Equal(uint64(1)))
+	})
+
+	It("closes the listener and open connections", func() {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		s := syslog.NewServer(lis, spy.set)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- s.Serve()
+		}()
+
+		conn, err := net.Dial("tcp", s.Addr())
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close() //nolint:errcheck
+		writeMessage(conn, "cpu")
+		Eventually(spy.names).Should(Equal([]string{"cpu"}))
+
+		Expect(s.Close()).To(Succeed())
+		Eventually(errs).Should(Receive(MatchError(net.ErrClosed)))
+
+		Expect(conn.SetReadDeadline(time.Now().Add(time.Second))).To(Succeed())
+		_, err = conn.Read(make([]byte, 1))
+		Expect(err).To(Equal(io.EOF))
+	})
+})
+
+func writeMessage(w io.Writer, name string) {
+	m := rfc5424.Message{
+		Priority:  rfc5424.Daemon | rfc5424.Info,
+		Timestamp: time.Unix(0, 0),
+		Hostname:  "myhostname",
+		AppName:   "someapp",
+		ProcessID: "[4]",
+		StructuredData: []rfc5424.StructuredData{
+			{
+				ID: "gauge@47450",
+				Parameters: []rfc5424.SDParam{
+					{Name: "name", Value: name},
+					{Name: "value", Value: "0.23"},
+				},
+			},
+		},
+	}
+
+	_, err := m.WriteTo(w)
+	Expect(err).ToNot(HaveOccurred())
+}
+
+// generateCertificate returns a self signed certificate for localhost.
+func generateCertificate() tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+
+	leaf, err := x509.ParseCertificate(der)
+	Expect(err).ToNot(HaveOccurred())
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
+
+type spySetter struct {
+	mu    sync.Mutex
+	_msgs [][]byte
+}
+
+func (s *spySetter) set(b []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s._msgs = append(s._msgs, b)
+}
+
+// names returns the gauge name of every message received.
+func (s *spySetter) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	for _, b := range s._msgs {
+		var m rfc5424.Message
+		Expect(m.UnmarshalBinary(b)).To(Succeed())
+		names = append(names, m.StructuredData[0].Parameters[0].Value)
+	}
+	return names
+}
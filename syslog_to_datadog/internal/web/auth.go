@@ -0,0 +1,97 @@
+package web
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sync/atomic"
+)
+
+// Authenticator rejects HTTP requests that do not carry one of the
+// configured credentials.
+type Authenticator struct {
+	token    string
+	username string
+	password string
+
+	rejected uint64
+}
+
+// AuthOption is a func that can be passed into NewAuthenticator to
+// configure the accepted credentials.
+type AuthOption func(*Authenticator)
+
+// WithToken accepts requests that carry the token as their path, e.g.
+// https://host/<token>, or as the token query parameter, e.g.
+// https://host/?token=<token>.
+func WithToken(token string) AuthOption {
+	return func(a *Authenticator) {
+		a.token = token
+	}
+}
+
+// WithBasicAuth accepts requests with the given basic auth credentials.
+func WithBasicAuth(username, password string) AuthOption {
+	return func(a *Authenticator) {
+		a.username = username
+		a.password = password
+	}
+}
+
+// NewAuthenticator returns a new Authenticator. Without any options every
+// request is accepted.
+func NewAuthenticator(opts ...AuthOption) *Authenticator {
+	a := &Authenticator{}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// Wrap returns a handler that answers requests without valid credentials
+// with 401 and passes every other request to h.
+func (a *Authenticator) Wrap(h http.Handler) http.Handler {
+	if a.token == "" && a.username == "" {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			atomic.AddUint64(&a.rejected, 1)
+			if a.username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="syslog_to_datadog"`)
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Rejected returns the number of requests rejected for missing or invalid
+// credentials.
+func (a *Authenticator) Rejected() uint64 {
+	return atomic.LoadUint64(&a.rejected)
+}
+
+func (a *Authenticator) authorized(r *http.Request) bool {
+	if a.token != "" {
+		if equal(r.URL.Path, "/"+a.token) || equal(r.URL.Query().Get("token"), a.token) {
+			return true
+		}
+	}
+
+	if a.username != "" {
+		username, password, ok := r.BasicAuth()
+		if ok && equal(username, a.username) && equal(password, a.password) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// equal compares secrets in constant time.
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
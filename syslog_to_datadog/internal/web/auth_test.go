@@ -0,0 +1,96 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/web"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Authenticator", func() {
+	var (
+		next http.Handler
+	)
+
+	BeforeEach(func() {
+		next = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		})
+	})
+
+	serve := func(a *web.Authenticator, r *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		a.Wrap(next).ServeHTTP(recorder, r)
+		return recorder
+	}
+
+	It("accepts every request without credentials configured", func() {
+		a := web.NewAuthenticator()
+
+		Expect(serve(a, httptest.NewRequest("POST", "/", nil)).Code).To(Equal(http.StatusAccepted))
+		Expect(a.Rejected()).To(BeZero())
+	})
+
+	Context("with a token", func() {
+		var a *web.Authenticator
+
+		BeforeEach(func() {
+			a = web.NewAuthenticator(web.WithToken("secret"))
+		})
+
+		It("accepts the token as the path", func() {
+			Expect(serve(a, httptest.NewRequest("POST", "/secret", nil)).Code).To(Equal(http.StatusAccepted))
+		})
+
+		It("accepts the token as a query parameter", func() {
+			Expect(serve(a, httptest.NewRequest("POST", "/?token=secret", nil)).Code).To(Equal(http.StatusAccepted))
+			Expect(serve(a, httptest.NewRequest("GET", "/stats?token=secret", nil)).Code).To(Equal(http.StatusAccepted))
+		})
+
+		It("rejects and counts requests with a missing or wrong token", func() {
+			Expect(serve(a, httptest.NewRequest("POST", "/", nil)).Code).To(Equal(http.StatusUnauthorized))
+			Expect(serve(a, httptest.NewRequest("POST", "/wrong", nil)).Code).To(Equal(http.StatusUnauthorized))
+			Expect(serve(a, httptest.NewRequest("POST", "/?token=wrong", nil)).Code).To(Equal(http.StatusUnauthorized))
+			Expect(a.Rejected()).To(Equal(uint64(3)))
+		})
+	})
+
+	Context("with basic auth", func() {
+		var a *web.Authenticator
+
+		BeforeEach(func() {
+			a = web.NewAuthenticator(web.WithBasicAuth("user", "pass"))
+		})
+
+		It("accepts valid credentials", func() {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.SetBasicAuth("user", "pass")
+
+			Expect(serve(a, r).Code).To(Equal(http.StatusAccepted))
+		})
+
+		It("rejects and counts invalid credentials", func() {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.SetBasicAuth("user", "wrong")
+
+			recorder := serve(a, r)
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+			Expect(recorder.Header().Get("WWW-Authenticate")).To(ContainSubstring("Basic"))
+			Expect(serve(a, httptest.NewRequest("POST", "/", nil)).Code).To(Equal(http.StatusUnauthorized))
+			Expect(a.Rejected()).To(Equal(uint64(2)))
+		})
+	})
+
+	It("accepts either credential when both are configured", func() {
+		a := web.NewAuthenticator(web.WithToken("secret"), web.WithBasicAuth("user", "pass"))
+
+		r := httptest.NewRequest("POST", "/", nil)
+		r.SetBasicAuth("user", "pass")
+		Expect(serve(a, r).Code).To(Equal(http.StatusAccepted))
+		Expect(serve(a, httptest.NewRequest("POST", "/secret", nil)).Code).To(Equal(http.StatusAccepted))
+		Expect(serve(a, httptest.NewRequest("POST", "/", nil)).Code).To(Equal(http.StatusUnauthorized))
+	})
+})
@@ -2,26 +2,61 @@ package web
 
 import (
 	"bytes"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 )
 
-// Setter is a func that can receive a slice of bytes.
-type Setter func([]byte)
+// Setter is a func that can receive a slice of bytes. It returns false if
+// the slice was dropped.
+type Setter func([]byte) bool
 
 // Handler satisfies the http.Handler interface for receiving rfc 5424
 // messages via HTTP.
 type Handler struct {
-	setter Setter
+	setter       Setter
+	multiple     bool
+	rejectStatus int
+}
+
+// HandlerOption is a func that can be passed into NewHandler to configure
+// optional settings on the Handler.
+type HandlerOption func(*Handler)
+
+// WithMultipleMessages configures the Handler to accept several messages
+// per request body. Each message is either octet counted, as in RFC 6587,
+// or terminated by a newline.
+func WithMultipleMessages() HandlerOption {
+	return func(h *Handler) {
+		h.multiple = true
+	}
+}
+
+// WithRejectStatus configures the Handler to respond with the given status
+// code, e.g. 429 or 503, when the Setter drops a message. The response asks
+// the sender to retry after a second. A request with multiple messages is
+// rejected if any of them is dropped, so retrying it can duplicate the
+// messages that were accepted. By default dropped messages are still
+// answered with 202.
+func WithRejectStatus(code int) HandlerOption {
+	return func(h *Handler) {
+		h.rejectStatus = code
+	}
 }
 
 // NewHandler returns a new Handler.
-func NewHandler(s Setter) *Handler {
-	return &Handler{setter: s}
+func NewHandler(s Setter, opts ...HandlerOption) *Handler {
+	h := &Handler{setter: s}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
 }
 
 // ServeHTTP receives HTTP requests and calls the handlers Setter func with
-// the request body.
+// the request body, or with each message in it when configured to accept
+// multiple messages.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	buf := bytes.NewBuffer(make([]byte, 0, r.ContentLength))
 	_, err := buf.ReadFrom(r.Body)
@@ -32,7 +67,66 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.setter(buf.Bytes())
+	msgs := [][]byte{buf.Bytes()}
+	if h.multiple {
+		msgs, err = splitMessages(buf.Bytes())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	accepted := true
+	for _, m := range msgs {
+		if !h.setter(m) {
+			accepted = false
+		}
+	}
+
+	if !accepted && h.rejectStatus != 0 {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(h.rejectStatus)
+		return
+	}
 
 	w.WriteHeader(http.StatusAccepted)
 }
+
+var errInvalidOctetCount = errors.New("invalid octet count")
+
+// splitMessages splits a body into octet counted or newline terminated
+// messages. The framing is detected per message: rfc 5424 messages start
+// with '<' while octet counts start with a digit.
+func splitMessages(b []byte) ([][]byte, error) {
+	var msgs [][]byte
+	for {
+		b = bytes.TrimLeft(b, "\r\n")
+		if len(b) == 0 {
+			return msgs, nil
+		}
+
+		if b[0] >= '0' && b[0] <= '9' {
+			i := bytes.IndexByte(b, ' ')
+			if i < 0 {
+				return nil, errInvalidOctetCount
+			}
+
+			n, err := strconv.Atoi(string(b[:i]))
+			if err != nil || len(b) < i+1+n {
+				return nil, errInvalidOctetCount
+			}
+
+			msgs = append(msgs, b[i+1:i+1+n])
+			b = b[i+1+n:]
+			continue
+		}
+
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			i = len(b)
+		}
+
+		msgs = append(msgs, bytes.TrimRight(b[:i], "\r"))
+		b = b[i:]
+	}
+}
@@ -14,8 +14,9 @@ import (
 var _ = Describe("Handler", func() {
 	It("returns http status code Accepted", func() {
 		var data []byte
-		setter := func(d []byte) {
+		setter := func(d []byte) bool {
 			data = d
+			return true
 		}
 
 		h := web.NewHandler(setter)
@@ -26,4 +27,88 @@ var _ = Describe("Handler", func() {
 		Expect(recorder.Code).To(Equal(http.StatusAccepted))
 		Expect(string(data)).To(Equal("hello"))
 	})
+
+	It("returns http status code Accepted when messages are dropped", func() {
+		h := web.NewHandler(func([]byte) bool { return false })
+		request := httptest.NewRequest("POST", "/", strings.NewReader("hello"))
+		recorder := httptest.NewRecorder()
+
+		h.ServeHTTP(recorder, request)
+		Expect(recorder.Code).To(Equal(http.StatusAccepted))
+	})
+
+	It("returns the reject status when messages are dropped", func() {
+		h := web.NewHandler(
+			func([]byte) bool { return false },
+			web.WithRejectStatus(http.StatusServiceUnavailable),
+		)
+		request := httptest.NewRequest("POST", "/", strings.NewReader("hello"))
+		recorder := httptest.NewRecorder()
+
+		h.ServeHTTP(recorder, request)
+		Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(recorder.Header().Get("Retry-After")).To(Equal("1"))
+	})
+})
+
+var _ = Describe("Handler with multiple messages", func() {
+	var (
+		msgs [][]byte
+		h    *web.Handler
+	)
+
+	BeforeEach(func() {
+		msgs = nil
+		h = web.NewHandler(func(d []byte) bool {
+			msgs = append(msgs, d)
+			return true
+		}, web.WithMultipleMessages())
+	})
+
+	It("splits newline framed messages", func() {
+		request := httptest.NewRequest("POST", "/", strings.NewReader("<30>1 first\r\n<30>1 second\n\n<30>1 third"))
+		recorder := httptest.NewRecorder()
+
+		h.ServeHTTP(recorder, request)
+		Expect(recorder.Code).To(Equal(http.StatusAccepted))
+		Expect(msgs).To(Equal([][]byte{
+			[]byte("<30>1 first"),
+			[]byte("<30>1 second"),
+			[]byte("<30>1 third"),
+		}))
+	})
+
+	It("splits octet counted messages", func() {
+		request := httptest.NewRequest("POST", "/", strings.NewReader("11 <30>1 first12 <30>1 second\n11 <30>1 third"))
+		recorder := httptest.NewRecorder()
+
+		h.ServeHTTP(recorder, request)
+		Expect(recorder.Code).To(Equal(http.StatusAccepted))
+		Expect(msgs).To(Equal([][]byte{
+			[]byte("<30>1 first"),
+			[]byte("<30>1 second"),
+			[]byte("<30>1 third"),
+		}))
+	})
+
+	It("splits a mix of framings", func() {
+		request := httptest.NewRequest("POST", "/", strings.NewReader("11 <30>1 first<30>1 second\n"))
+		recorder := httptest.NewRecorder()
+
+		h.ServeHTTP(recorder, request)
+		Expect(recorder.Code).To(Equal(http.StatusAccepted))
+		Expect(msgs).To(Equal([][]byte{
+			[]byte("<30>1 first"),
+			[]byte("<30>1 second"),
+		}))
+	})
+
+	It("rejects bodies with an invalid octet count", func() {
+		request := httptest.NewRequest("POST", "/", strings.NewReader("11 <30>1 first100 <30>1 second"))
+		recorder := httptest.NewRecorder()
+
+		h.ServeHTTP(recorder, request)
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(msgs).To(BeEmpty())
+	})
 })
@@ -1,23 +1,207 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/app"
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/processor"
+	"code.cloudfoundry.org/loggregator-tools/syslog_to_datadog/internal/sink"
 )
 
 func main() {
-	datadogAPIKey := os.Getenv("DATADOG_API_KEY")
-	if datadogAPIKey == "" {
-		log.Fatal("missing required environment variable DATADOG_API_KEY")
-	}
-
 	port := os.Getenv("PORT")
 	if port == "" {
 		log.Fatal("missing required environment variable PORT")
 	}
 
-	s := app.NewServer(":"+port, datadogAPIKey)
+	var opts []app.ServerOption
+	var datadogAPIKey string
+	switch sinkName := os.Getenv("SINK"); sinkName {
+	case "", "datadog":
+		datadogAPIKey = os.Getenv("DATADOG_API_KEY")
+		if datadogAPIKey == "" {
+			log.Fatal("missing required environment variable DATADOG_API_KEY")
+		}
+	case "prometheus":
+		opts = append(opts, app.WithSink(sink.NewPrometheus(httpClient, requiredEnv("PROMETHEUS_REMOTE_WRITE_URL"))))
+	case "otlp":
+		opts = append(opts, app.WithSink(sink.NewOTLP(httpClient, requiredEnv("OTLP_METRICS_URL"))))
+	case "statsd":
+		s, err := sink.NewStatsD(requiredEnv("STATSD_ADDR"))
+		if err != nil {
+			log.Fatalf("failed to create statsd sink: %s", err)
+		}
+		opts = append(opts, app.WithSink(s))
+	default:
+		log.Fatalf("invalid SINK: %q", sinkName)
+	}
+
+	if metricTypes := os.Getenv("METRIC_TYPES"); metricTypes != "" {
+		opts = append(opts, app.WithMetricTypes(parseMetricTypes(metricTypes)))
+	}
+
+	if countInterval := os.Getenv("COUNT_INTERVAL"); countInterval != "" {
+		d, err := time.ParseDuration(countInterval)
+		if err != nil || d <= 0 {
+			log.Fatalf("invalid COUNT_INTERVAL: %q", countInterval)
+		}
+		opts = append(opts, app.WithCountInterval(d))
+	}
+
+	if prefix, ok := os.LookupEnv("METRIC_PREFIX"); ok {
+		opts = append(opts, app.WithMetricPrefix(prefix))
+	}
+
+	if allowlist := os.Getenv("TAG_ALLOWLIST"); allowlist != "" {
+		opts = append(opts, app.WithTagAllowlist(strings.Split(allowlist, ",")))
+	}
+
+	if flushInterval := os.Getenv("FLUSH_INTERVAL"); flushInterval != "" {
+		d, err := time.ParseDuration(flushInterval)
+		if err != nil || d <= 0 {
+			log.Fatalf("invalid FLUSH_INTERVAL: %q", flushInterval)
+		}
+		opts = append(opts, app.WithFlushInterval(d))
+	}
+
+	if maxPayloadBytes := os.Getenv("MAX_PAYLOAD_BYTES"); maxPayloadBytes != "" {
+		n, err := strconv.Atoi(maxPayloadBytes)
+		if err != nil {
+			log.Fatalf("invalid MAX_PAYLOAD_BYTES: %s", err)
+		}
+		opts = append(opts, app.WithMaxPayloadBytes(n))
+	}
+
+	if queueSize := os.Getenv("QUEUE_SIZE"); queueSize != "" {
+		n, err := strconv.Atoi(queueSize)
+		if err != nil || n < 1 {
+			log.Fatalf("invalid QUEUE_SIZE: %q", queueSize)
+		}
+		opts = append(opts, app.WithQueueSize(n))
+	}
+
+	if status := os.Getenv("BACKPRESSURE_STATUS"); status != "" {
+		code, err := strconv.Atoi(status)
+		if err != nil || (code != http.StatusTooManyRequests && code != http.StatusServiceUnavailable) {
+			log.Fatalf("invalid BACKPRESSURE_STATUS, must be 429 or 503: %q", status)
+		}
+		opts = append(opts, app.WithBackpressure(code))
+	}
+
+	if tcpPort := os.Getenv("SYSLOG_TCP_PORT"); tcpPort != "" {
+		opts = append(opts, app.WithSyslogTCP(":"+tcpPort))
+	}
+
+	if tlsPort := os.Getenv("SYSLOG_TLS_PORT"); tlsPort != "" {
+		cert, err := tls.LoadX509KeyPair(
+			os.Getenv("SYSLOG_TLS_CERT_FILE"),
+			os.Getenv("SYSLOG_TLS_KEY_FILE"),
+		)
+		if err != nil {
+			log.Fatalf("failed to load SYSLOG_TLS_CERT_FILE and SYSLOG_TLS_KEY_FILE: %s", err)
+		}
+
+		tlsConfig := &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		}
+
+		if caFile := os.Getenv("SYSLOG_TLS_CLIENT_CA_FILE"); caFile != "" {
+			caCert, err := os.ReadFile(caFile)
+			if err != nil {
+				log.Fatalf("failed to read SYSLOG_TLS_CLIENT_CA_FILE: %s", err)
+			}
+
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(caCert) {
+				log.Fatal("SYSLOG_TLS_CLIENT_CA_FILE does not contain any certificates")
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+
+		opts = append(opts, app.WithSyslogTLS(":"+tlsPort, tlsConfig))
+	}
+
+	if token := os.Getenv("INGRESS_TOKEN"); token != "" {
+		opts = append(opts, app.WithToken(token))
+	}
+
+	if username := os.Getenv("BASIC_AUTH_USERNAME"); username != "" {
+		opts = append(opts, app.WithBasicAuth(username, requiredEnv("BASIC_AUTH_PASSWORD")))
+	}
+
+	if hostnames := os.Getenv("HOSTNAME_ALLOWLIST"); hostnames != "" {
+		opts = append(opts, app.WithHostnameAllowlist(strings.Split(hostnames, ",")))
+	}
+
+	if os.Getenv("HTTP_MULTIPLE_MESSAGES") == "true" {
+		opts = append(opts, app.WithHTTPMultipleMessages())
+	}
+
+	if workers := os.Getenv("WORKERS"); workers != "" {
+		n, err := strconv.Atoi(workers)
+		if err != nil || n < 1 {
+			log.Fatalf("invalid WORKERS: %q", workers)
+		}
+		opts = append(opts, app.WithWorkers(n))
+	}
+
+	s := app.NewServer(":"+port, datadogAPIKey, opts...)
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+		<-signals
+
+		log.Print("shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s.Stop(ctx)
+	}()
+
 	s.Run()
 }
+
+var httpClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+func requiredEnv(name string) string {
+	v := os.Getenv(name)
+	if v == "" {
+		log.Fatalf("missing required environment variable %s", name)
+	}
+	return v
+}
+
+// parseMetricTypes parses a comma separated list of name:type pairs, e.g.
+// "requests:rate,ingress:gauge".
+func parseMetricTypes(s string) map[string]string {
+	types := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 {
+			log.Fatalf("invalid METRIC_TYPES entry: %q", pair)
+		}
+
+		switch parts[1] {
+		case processor.Count, processor.Gauge, processor.Rate:
+		default:
+			log.Fatalf("invalid METRIC_TYPES type for %s: %q", parts[0], parts[1])
+		}
+		types[parts[0]] = parts[1]
+	}
+
+	return types
+}